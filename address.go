@@ -0,0 +1,22 @@
+package serial
+
+// WriteAddressed writes a frame of a 9-bit multi-drop protocol, like on RS-485 buses:
+// the address character addr is sent with ParityMark, which sets its 9th bit,
+// and the data with ParitySpace, which clears it.
+//
+// The parity is switched only after the previously written characters are transmitted,
+// which makes WriteAddressed slow, but keeps the parity of every character right.
+// It leaves the port with ParitySpace, to receive the replies of the addressed device.
+func WriteAddressed(p Port, addr byte, data []byte) error {
+	if err := p.SetParity(ParityMark); err != nil {
+		return err
+	}
+	if _, err := p.Write([]byte{addr}); err != nil {
+		return err
+	}
+	if err := p.SetParity(ParitySpace); err != nil {
+		return err
+	}
+	_, err := p.Write(data)
+	return err
+}
@@ -0,0 +1,233 @@
+// Package at sends AT commands, like the ones of cellular modems and Bluetooth or Wi-Fi modules,
+// and collects their responses:
+//
+//	c := at.NewClient(p, at.Config{
+//		Unsolicited:   []string{"RING", "+CMTI:", "+CREG:"},
+//		OnUnsolicited: func(line string) { log.Println("modem:", line) },
+//	})
+//	lines, err := c.Command(ctx, "AT+CSQ")
+//
+// The client reads the port in a goroutine, until the port is closed, so that the unsolicited
+// result codes are received between the commands too.
+package at
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+// DefaultTimeout is the time a command waits for its final result code, unless configured otherwise.
+const DefaultTimeout = 5 * time.Second
+
+// ErrClosed is returned by the commands once the client has stopped reading the port.
+var ErrClosed = errors.New("at: client stopped")
+
+// Error is the final result code of a failed command, like ERROR or +CME ERROR: 10.
+type Error struct {
+	Command string
+	Result  string   // the final result code, like "+CME ERROR: SIM not inserted"
+	Lines   []string // the response lines before it
+}
+
+func (e *Error) Error() string {
+	return "at: " + e.Command + ": " + e.Result
+}
+
+// errorResults are the prefixes of the final result codes of the commands which fail.
+// The ones which succeed end with OK, or with CONNECT, which switches the modem to the data mode.
+var errorResults = []string{"ERROR", "+CME ERROR", "+CMS ERROR", "NO CARRIER", "BUSY", "NO ANSWER", "NO DIALTONE"}
+
+// Config describes how a Client talks to the device.
+type Config struct {
+	// Timeout is the time a command waits for its final result code. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	// Unsolicited are the prefixes of the unsolicited result codes, like "RING" or "+CMTI:",
+	// which may be received in the middle of the response of a command. A line with one of
+	// them is a response line of the command which has the same name, like "+CREG:" for AT+CREG?.
+	// The lines received between the commands are unsolicited whatever their prefix.
+	Unsolicited []string
+
+	// OnUnsolicited, if not nil, is called with the unsolicited result codes. It is called
+	// by the goroutine reading the port, which it must not block, and must not send commands.
+	OnUnsolicited func(line string)
+
+	// MaxLineLength is the maximum length of a line. Zero means serial.DefaultMaxLineLength.
+	MaxLineLength int
+}
+
+// Client sends the commands to a device, and receives their responses.
+// It is safe for concurrent use; the commands are sent one at a time.
+type Client struct {
+	p   serial.Port
+	cfg Config
+	mu  sync.Mutex // serializes the commands
+
+	state   sync.Mutex
+	pending *command
+	err     error // why the reading stopped
+}
+
+// command is a command waiting for its final result code.
+type command struct {
+	cmd    string
+	echoed bool   // the echo of the command has been suppressed, once
+	name   string // the prefix of its response lines, like "+CSQ:"
+	lines  []string
+	result chan error
+}
+
+// NewClient returns a client using p, which should not be read by anyone else.
+func NewClient(p serial.Port, cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	c := &Client{p: p, cfg: cfg}
+	go c.read(serial.NewLineReader(p, []byte("\n"), cfg.MaxLineLength))
+	return c
+}
+
+// Command sends cmd, like "AT+CGMI", and returns the lines of its response, without the echo of
+// the command, the empty lines, the unsolicited result codes, and the final result code.
+// A failure of the command is returned as an *Error.
+//
+// If the final result code is not received within Config.Timeout, or before ctx is done,
+// Command returns an error wrapping os.ErrDeadlineExceeded, or ctx.Err(). A response which
+// comes after that is handled as unsolicited.
+func (c *Client) Command(ctx context.Context, cmd string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmd = strings.TrimRight(cmd, "\r\n")
+	pc := &command{cmd: cmd, name: responseName(cmd), result: make(chan error, 1)}
+	c.state.Lock()
+	if c.err != nil {
+		c.state.Unlock()
+		return nil, c.err
+	}
+	c.pending = pc
+	c.state.Unlock()
+
+	timer := time.NewTimer(c.cfg.Timeout)
+	defer timer.Stop()
+	var err error
+	if _, err = c.p.Write([]byte(cmd + "\r")); err != nil {
+		err = fmt.Errorf("at: %s: %w", cmd, err)
+	} else {
+		select {
+		case err = <-pc.result:
+			return pc.lines, err
+		case <-timer.C:
+			err = fmt.Errorf("at: %s: no final result code in %v: %w", cmd, c.cfg.Timeout, os.ErrDeadlineExceeded)
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	c.state.Lock()
+	defer c.state.Unlock()
+	if c.pending != pc {
+		// The final result code came in the meantime.
+		if rerr := <-pc.result; rerr != nil {
+			return pc.lines, rerr
+		}
+		return pc.lines, nil
+	}
+	c.pending = nil
+	return nil, err
+}
+
+// read reads the lines of the port, and dispatches them, until the port fails.
+func (c *Client) read(lr *serial.LineReader) {
+	for {
+		b, err := lr.ReadLine()
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, serial.ErrLineTooLong) {
+				// Config.ReadTimeout of the port, which does not end the reading.
+				continue
+			}
+			c.stop(err)
+			return
+		}
+		line := strings.TrimSpace(string(b))
+		if line == "" {
+			continue
+		}
+		if c.dispatch(line) && c.cfg.OnUnsolicited != nil {
+			c.cfg.OnUnsolicited(line)
+		}
+	}
+}
+
+// dispatch hands line to the pending command, and tells whether it is unsolicited instead.
+func (c *Client) dispatch(line string) (unsolicited bool) {
+	c.state.Lock()
+	defer c.state.Unlock()
+	pc := c.pending
+	if pc == nil {
+		return true
+	}
+	if !pc.echoed && line == pc.cmd {
+		pc.echoed = true
+		return false
+	}
+	if hasPrefix(line, c.cfg.Unsolicited) && (pc.name == "" || !strings.HasPrefix(line, pc.name)) {
+		return true
+	}
+	switch {
+	case line == "OK":
+		pc.result <- nil
+	case strings.HasPrefix(line, "CONNECT"):
+		// The rate after CONNECT is the response.
+		pc.lines = append(pc.lines, line)
+		pc.result <- nil
+	case hasPrefix(line, errorResults):
+		pc.result <- &Error{Command: pc.cmd, Result: line, Lines: pc.lines}
+	default:
+		pc.lines = append(pc.lines, line)
+		return false
+	}
+	c.pending = nil
+	return false
+}
+
+// stop ends the pending command, and the later ones, with err.
+func (c *Client) stop(err error) {
+	c.state.Lock()
+	defer c.state.Unlock()
+	c.err = fmt.Errorf("%w: %w", ErrClosed, err)
+	if c.pending != nil {
+		c.pending.result <- c.err
+		c.pending = nil
+	}
+}
+
+// responseName returns the prefix of the information responses of the extended command cmd,
+// like "+CSQ:" for AT+CSQ or AT+CSQ=?, or "" for a basic command.
+func responseName(cmd string) string {
+	if len(cmd) < 3 || !strings.EqualFold(cmd[:2], "AT") {
+		return ""
+	}
+	name := cmd[2:]
+	if name[0] != '+' && name[0] != '^' && name[0] != '$' && name[0] != '%' && name[0] != '#' {
+		return ""
+	}
+	if i := strings.IndexAny(name, "=?;"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToUpper(name) + ":"
+}
+
+func hasPrefix(line string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(line, p) {
+			return true
+		}
+	}
+	return false
+}
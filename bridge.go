@@ -0,0 +1,125 @@
+package serial
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultBridgeBufferSize is the size of the reads of Bridge, unless configured otherwise.
+const DefaultBridgeBufferSize = 4096
+
+// BridgeConfig describes how Bridge copies the data.
+type BridgeConfig struct {
+	// Rate, if positive, is the maximum rate of each direction, in bytes per second,
+	// like to feed a device which has no flow control with the data of a faster link.
+	Rate int
+
+	// TapAB and TapBA, if not nil, are called with the data copied from a to b, and from b to a,
+	// before it is written, like to log the traffic of a gateway or to dissect a protocol.
+	// They must not retain the data, nor block.
+	TapAB func(data []byte)
+	TapBA func(data []byte)
+
+	// BufferSize is the size of the reads. Zero means DefaultBridgeBufferSize.
+	BufferSize int
+}
+
+// Bridge copies the data read from a to b, and the data read from b to a, like a ser2net gateway between
+// a port and a net.Conn, or between two ports to watch the traffic of a device with BridgeConfig.TapAB.
+//
+// Once either side ends or fails, Bridge closes both, and returns the first error, or nil at the end
+// of the input. The timeouts of the reads, like with Config.ReadTimeout, do not end it.
+func Bridge(a, b io.ReadWriteCloser, cfg BridgeConfig) error {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBridgeBufferSize
+	}
+	var (
+		once     sync.Once
+		first    error
+		wg       sync.WaitGroup
+		shutdown = make(chan struct{})
+	)
+	end := func(err error) {
+		once.Do(func() {
+			first = err
+			close(shutdown)
+			a.Close()
+			b.Close()
+		})
+	}
+	copyData := func(dst, src io.ReadWriter, tap func([]byte)) {
+		defer wg.Done()
+		end(bridgeCopy(dst, src, tap, cfg, shutdown))
+	}
+	wg.Add(2)
+	go copyData(b, a, cfg.TapAB)
+	go copyData(a, b, cfg.TapBA)
+	wg.Wait()
+	return first
+}
+
+// bridgeCopy copies the data of src to dst, until src ends, either fails, or shutdown is closed.
+func bridgeCopy(dst, src io.ReadWriter, tap func([]byte), cfg BridgeConfig, shutdown chan struct{}) error {
+	size := cfg.BufferSize
+	var ct time.Duration // the time a byte takes at the rate
+	if cfg.Rate > 0 {
+		ct = time.Second / time.Duration(cfg.Rate)
+		// Make the reads no larger than the data due in a pace interval.
+		size = max(1, min(size, int(paceInterval/max(ct, 1))))
+	}
+	buf := make([]byte, size)
+	var next time.Time // when the data copied so far is due at the rate
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if tap != nil {
+				tap(buf[:n])
+			}
+			if ct > 0 {
+				if wait := time.Until(next); wait > 0 {
+					t := time.NewTimer(wait)
+					select {
+					case <-t.C:
+					case <-shutdown:
+						t.Stop()
+						return nil
+					}
+				}
+				if now := time.Now(); next.Before(now) {
+					next = now
+				}
+				next = next.Add(ct * time.Duration(n))
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return closedByBridge(werr, shutdown)
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			return closedByBridge(err, shutdown)
+		}
+	}
+}
+
+// closedByBridge returns err, or nil if it comes from Bridge closing the sides.
+func closedByBridge(err error, shutdown chan struct{}) error {
+	select {
+	case <-shutdown:
+		return nil
+	default:
+	}
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+		// The side has been closed by its owner, which ends the bridge.
+		return nil
+	}
+	return err
+}
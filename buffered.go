@@ -0,0 +1,151 @@
+package serial
+
+import (
+	"bufio"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReadBufferSize is the size of the buffer of a BufferedPort, unless given otherwise.
+// It is the size of the buffer of the line discipline of Linux, which a single Read returns at most.
+const DefaultReadBufferSize = 4096
+
+// BufferedPort is a port reading through a buffer, which lets the framing code look ahead
+// for the start of a frame with Peek, and drop the noise with Discard, without consuming the input.
+// A larger buffer takes more of the input with every Read of the port.
+//
+// The reading methods and ResetInput must be called by one goroutine at a time.
+// Events reports the data of the port only, not the data already buffered; see Buffered.
+// A Mux takes the buffered data into account.
+type BufferedPort struct {
+	Port
+	r        *bufio.Reader
+	src      *stampedReader
+	buffered atomic.Int64 // r.Buffered(), for waitData
+}
+
+// NewBufferedPort returns p, reading through a buffer of size bytes.
+// Non-positive size means DefaultReadBufferSize.
+func NewBufferedPort(p Port, size int) *BufferedPort {
+	if size <= 0 {
+		size = DefaultReadBufferSize
+	}
+	src := &stampedReader{p: p}
+	return &BufferedPort{Port: p, r: bufio.NewReaderSize(src, size), src: src}
+}
+
+// Read implements io.Reader. It returns the buffered data first.
+func (p *BufferedPort) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port. The time is when the first byte returned was received,
+// even if it was buffered before, like by Peek.
+func (p *BufferedPort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	defer p.update()
+	off := p.src.read - int64(p.r.Buffered())
+	n, err := p.r.Read(buf)
+	if n == 0 {
+		return 0, time.Time{}, err
+	}
+	return n, p.src.timeAt(off), err
+}
+
+// ReadByte implements io.ByteReader
+func (p *BufferedPort) ReadByte() (byte, error) {
+	defer p.update()
+	return p.r.ReadByte()
+}
+
+// Buffered returns the number of bytes which can be read from the buffer, without reading the port.
+func (p *BufferedPort) Buffered() int {
+	return p.r.Buffered()
+}
+
+// Peek returns the next n bytes without consuming them, reading the port until they are received.
+// The bytes are only valid until the next read. If fewer than n bytes are returned,
+// the error tells why, like a timeout, or bufio.ErrBufferFull if n is larger than the buffer.
+func (p *BufferedPort) Peek(n int) ([]byte, error) {
+	if n > p.r.Size() {
+		// Without waiting for the buffer to fill up, like bufio.Reader.Peek does.
+		return nil, bufio.ErrBufferFull
+	}
+	defer p.update()
+	return p.r.Peek(n)
+}
+
+// Discard skips the next n bytes, reading the port until they are received, and returns
+// the number of bytes skipped. If it is less than n, the error tells why.
+func (p *BufferedPort) Discard(n int) (int, error) {
+	defer p.update()
+	return p.r.Discard(n)
+}
+
+// ResetInput implements Port. It discards the buffered data too.
+func (p *BufferedPort) ResetInput() error {
+	if err := p.Port.ResetInput(); err != nil {
+		return err
+	}
+	p.r.Discard(p.r.Buffered())
+	p.update()
+	return nil
+}
+
+// update records the amount of the buffered data, and forgets the times of the data consumed.
+func (p *BufferedPort) update() {
+	p.buffered.Store(int64(p.r.Buffered()))
+	p.src.forget(p.src.read - int64(p.r.Buffered()))
+}
+
+// waitData waits until there is data to read, in the buffer or from the port, for Mux.
+func (p *BufferedPort) waitData(done <-chan struct{}) error {
+	if p.buffered.Load() > 0 {
+		return nil
+	}
+	if w, ok := underlying(p.Port).(dataWaiter); ok {
+		return w.waitData(done)
+	}
+	return waitEvent(p.Port.Events(), done)
+}
+
+// stampedReader reads the port for the buffer of a BufferedPort, and keeps the times the data was received.
+type stampedReader struct {
+	p      Port
+	read   int64   // the bytes read from the port so far
+	stamps []stamp // the times of the data not consumed yet, in order
+}
+
+// stamp is the time of the data of a read from the port, which ends at the offset end of the input.
+type stamp struct {
+	end int64
+	ts  time.Time
+}
+
+func (r *stampedReader) Read(buf []byte) (int, error) {
+	n, ts, err := r.p.ReadTimestamped(buf)
+	if n > 0 {
+		r.read += int64(n)
+		r.stamps = append(r.stamps, stamp{end: r.read, ts: ts})
+	}
+	return n, err
+}
+
+// timeAt returns the time the byte at the offset off of the input was received.
+func (r *stampedReader) timeAt(off int64) time.Time {
+	for _, s := range r.stamps {
+		if off < s.end {
+			return s.ts
+		}
+	}
+	return time.Time{}
+}
+
+// forget drops the times of the data before the offset off, which is consumed.
+func (r *stampedReader) forget(off int64) {
+	i := 0
+	for i < len(r.stamps) && r.stamps[i].end <= off {
+		i++
+	}
+	r.stamps = append(r.stamps[:0], r.stamps[i:]...)
+}
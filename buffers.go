@@ -0,0 +1,44 @@
+package serial
+
+// maxIovecs is the number of buffers written by a single writev, IOV_MAX on Linux and the BSDs.
+const maxIovecs = 1024
+
+// buffersWriter is implemented by the ports which can write several buffers at once, with writev.
+type buffersWriter interface {
+	writeBuffers(bufs [][]byte) (int64, error)
+}
+
+// WriteBuffers writes the contents of bufs to p in order, like a protocol header and payload,
+// as a single Write, which the concurrent Writes do not interleave with. On Linux, macOS and the BSDs,
+// the buffers are passed to the kernel with a single writev, without joining them into one buffer first.
+// On the other ports, and with Config.PaceWrites, they are joined, and written with Write.
+// It returns the number of bytes written.
+func WriteBuffers(p Port, bufs [][]byte) (int64, error) {
+	if w, ok := p.(buffersWriter); ok {
+		return w.writeBuffers(bufs)
+	}
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
+	data := make([]byte, 0, size)
+	for _, buf := range bufs {
+		data = append(data, buf...)
+	}
+	n, err := p.Write(data)
+	return int64(n), err
+}
+
+// consumeBuffers drops the first n bytes of bufs.
+func consumeBuffers(bufs [][]byte, n int64) [][]byte {
+	for len(bufs) > 0 {
+		if l := int64(len(bufs[0])); l > n {
+			bufs[0] = bufs[0][n:]
+			break
+		} else {
+			n -= l
+		}
+		bufs = bufs[1:]
+	}
+	return bufs
+}
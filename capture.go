@@ -0,0 +1,104 @@
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// CaptureRecord is a record of a capture: the data of a Read or a Write of a port, with its time.
+//
+// A capture is a text file with a record per line: the time in RFC 3339 with nanoseconds,
+// the direction, "read" or "write", and the data in hexadecimal, like:
+//
+//	2024-05-01T10:15:30.123456789Z write 41540d
+//	2024-05-01T10:15:30.131002113Z read 0d0a4f4b0d0a
+//
+// The empty lines, and the lines starting with #, are ignored. A capture is replayed by serialtest.Replay.
+type CaptureRecord struct {
+	Time time.Time
+	Dir  Direction
+	Data []byte
+}
+
+// CaptureTrace returns a TraceFunc which writes the data to w as a capture, like with Config.Trace.
+// The errors of w are ignored, so that they do not disturb the port.
+func CaptureTrace(w io.Writer) TraceFunc {
+	var mu sync.Mutex
+	var line []byte
+	return func(dir Direction, data []byte, t time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		line = t.UTC().AppendFormat(line[:0], time.RFC3339Nano)
+		line = append(line, ' ')
+		line = append(line, dir.String()...)
+		line = append(line, ' ')
+		line = append(line, hex.EncodeToString(data)...)
+		line = append(line, '\n')
+		w.Write(line)
+	}
+}
+
+// CaptureReader reads the records of a capture.
+type CaptureReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewCaptureReader returns a CaptureReader which reads the capture from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	s := bufio.NewScanner(r)
+	// A record holds the data of a Read or a Write, twice as long in hexadecimal.
+	s.Buffer(nil, 1<<24)
+	return &CaptureReader{s: s}
+}
+
+// Next returns the next record, or io.EOF at the end of the capture.
+func (r *CaptureReader) Next() (CaptureRecord, error) {
+	for r.s.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.s.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		rec, err := parseCaptureRecord(line)
+		if err != nil {
+			return CaptureRecord{}, fmt.Errorf("capture line %d: %w", r.line, err)
+		}
+		return rec, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return CaptureRecord{}, err
+	}
+	return CaptureRecord{}, io.EOF
+}
+
+func parseCaptureRecord(line []byte) (CaptureRecord, error) {
+	fields := bytes.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return CaptureRecord{}, fmt.Errorf("malformed record %q", line)
+	}
+	var rec CaptureRecord
+	var err error
+	if rec.Time, err = time.Parse(time.RFC3339Nano, string(fields[0])); err != nil {
+		return CaptureRecord{}, err
+	}
+	switch string(fields[1]) {
+	case DirRead.String():
+		rec.Dir = DirRead
+	case DirWrite.String():
+		rec.Dir = DirWrite
+	default:
+		return CaptureRecord{}, fmt.Errorf("unknown direction %q", fields[1])
+	}
+	if len(fields) == 3 {
+		if rec.Data, err = hex.DecodeString(string(fields[2])); err != nil {
+			return CaptureRecord{}, err
+		}
+	}
+	return rec, nil
+}
@@ -0,0 +1,83 @@
+package serial
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// OpenContext is like OpenWithConfig, but binds the opened port to ctx.
+// Once ctx is done, the port is closed, which unblocks pending Read and Write calls.
+// Those calls, as well as the later ones, return ctx.Err().
+// With Config.WaitForDevice, ctx also ends the wait for the device.
+func OpenContext(ctx context.Context, name string, cfg Config) (Port, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := open(ctx, name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cp := &ctxPort{Port: p, name: name, ctx: ctx}
+	cp.stop = context.AfterFunc(ctx, func() { p.Close() })
+	return cp, nil
+}
+
+// ctxPort is a port which is closed when its context is done.
+type ctxPort struct {
+	Port
+	name   string
+	ctx    context.Context
+	stop   func() bool
+	closed atomic.Bool // set by the first Close
+}
+
+// Read implements io.Reader
+func (p *ctxPort) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port
+func (p *ctxPort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	n, ts, err := p.Port.ReadTimestamped(buf)
+	if err != nil && p.ctx.Err() != nil {
+		err = p.ctx.Err()
+	}
+	return n, ts, err
+}
+
+// Write implements io.Writer
+func (p *ctxPort) Write(buf []byte) (int, error) {
+	n, err := p.Port.Write(buf)
+	if err != nil && p.ctx.Err() != nil {
+		err = p.ctx.Err()
+	}
+	return n, err
+}
+
+// writeBuffers fails with ctx.Err() like Write.
+func (p *ctxPort) writeBuffers(bufs [][]byte) (int64, error) {
+	n, err := WriteBuffers(p.Port, bufs)
+	if err != nil && p.ctx.Err() != nil {
+		err = p.ctx.Err()
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (p *ctxPort) Close() error {
+	if !p.closed.CompareAndSwap(false, true) {
+		return &os.PathError{Op: "close", Path: p.name, Err: os.ErrClosed}
+	}
+	if !p.stop() {
+		// The port has been closed, because the context is done.
+		return nil
+	}
+	return p.Port.Close()
+}
+
+func (p *ctxPort) unwrap() Port {
+	return p.Port
+}
@@ -0,0 +1,125 @@
+// Package crc computes the CRCs common on serial links, and appends and checks them on the wire,
+// like the frames of the framing package do with Config.Checksum.
+package crc
+
+import "hash/crc32"
+
+// Algorithm is a checksum appended to the data on the wire.
+type Algorithm struct {
+	Name string
+
+	// Size is the length of the checksum on the wire: 1, 2 or 4 bytes.
+	Size int
+
+	// BigEndian, if true, sends the most significant byte of the checksum first.
+	BigEndian bool
+
+	// Sum returns the checksum of data.
+	Sum func(data []byte) uint32
+}
+
+// The CRCs common on serial links, with the byte order they are usually sent in.
+var (
+	// Maxim is the CRC-8 of the Dallas/Maxim 1-Wire devices, see CRC8Maxim.
+	Maxim = &Algorithm{Name: "CRC-8/MAXIM", Size: 1, Sum: func(b []byte) uint32 { return uint32(CRC8Maxim(b)) }}
+
+	// CCITT is the CRC-16 of HDLC framed protocols and many sensors, see CRC16CCITT. It is sent big-endian.
+	CCITT = &Algorithm{Name: "CRC-16/CCITT-FALSE", Size: 2, BigEndian: true, Sum: func(b []byte) uint32 { return uint32(CRC16CCITT(b)) }}
+
+	// XModem is the CRC-16 of XMODEM, see CRC16XModem. It is sent big-endian.
+	XModem = &Algorithm{Name: "CRC-16/XMODEM", Size: 2, BigEndian: true, Sum: func(b []byte) uint32 { return uint32(CRC16XModem(b)) }}
+
+	// Modbus is the CRC-16 of Modbus RTU, see CRC16Modbus. It is sent little-endian.
+	Modbus = &Algorithm{Name: "CRC-16/MODBUS", Size: 2, Sum: func(b []byte) uint32 { return uint32(CRC16Modbus(b)) }}
+
+	// IEEE is the CRC-32 of Ethernet, zlib and PNG, see CRC32. It is sent little-endian.
+	IEEE = &Algorithm{Name: "CRC-32", Size: 4, Sum: CRC32}
+)
+
+// Append appends the checksum of b to b, and returns the extended buffer.
+func (a *Algorithm) Append(b []byte) []byte {
+	sum := a.Sum(b)
+	for i := 0; i < a.Size; i++ {
+		shift := 8 * i
+		if a.BigEndian {
+			shift = 8 * (a.Size - 1 - i)
+		}
+		b = append(b, byte(sum>>shift))
+	}
+	return b
+}
+
+// Stored returns the checksum at the end of b, which must be at least Size bytes long.
+func (a *Algorithm) Stored(b []byte) uint32 {
+	var sum uint32
+	for i, c := range b[len(b)-a.Size:] {
+		shift := 8 * i
+		if a.BigEndian {
+			shift = 8 * (a.Size - 1 - i)
+		}
+		sum |= uint32(c) << shift
+	}
+	return sum
+}
+
+// CRC8Maxim returns the CRC-8/MAXIM of b: the reflected polynomial 0x8c with the initial value 0.
+func CRC8Maxim(b []byte) uint8 {
+	var crc uint8
+	for _, c := range b {
+		crc ^= c
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8c
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// CRC16CCITT returns the CRC-16/CCITT-FALSE of b: the polynomial 0x1021 with the initial value 0xffff.
+func CRC16CCITT(b []byte) uint16 {
+	return crc16(0xffff, b)
+}
+
+// CRC16XModem returns the CRC-16/XMODEM of b: the polynomial 0x1021 with the initial value 0.
+func CRC16XModem(b []byte) uint16 {
+	return crc16(0, b)
+}
+
+// crc16 returns the CRC of b with the polynomial 0x1021, not reflected, from the initial value crc.
+func crc16(crc uint16, b []byte) uint16 {
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// CRC16Modbus returns the CRC-16/MODBUS of b: the reflected polynomial 0xa001 with the initial value 0xffff.
+func CRC16Modbus(b []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, c := range b {
+		crc ^= uint16(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// CRC32 returns the CRC-32 of b, with the IEEE polynomial, like hash/crc32.ChecksumIEEE.
+func CRC32(b []byte) uint32 {
+	return crc32.ChecksumIEEE(b)
+}
@@ -0,0 +1,63 @@
+package crc_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jangocheng/serial/crc"
+)
+
+// The check values of the catalogue of parametrised CRC algorithms, the CRCs of "123456789".
+var checkTests = []struct {
+	alg   *crc.Algorithm
+	sum   func([]byte) uint32
+	check uint32
+	empty uint32 // the CRC of no data, the initial value with the final XOR
+	wire  []byte // the check value appended to the data, in the byte order of the algorithm
+}{
+	{crc.Maxim, func(b []byte) uint32 { return uint32(crc.CRC8Maxim(b)) }, 0xa1, 0, []byte{0xa1}},
+	{crc.CCITT, func(b []byte) uint32 { return uint32(crc.CRC16CCITT(b)) }, 0x29b1, 0xffff, []byte{0x29, 0xb1}},
+	{crc.XModem, func(b []byte) uint32 { return uint32(crc.CRC16XModem(b)) }, 0x31c3, 0, []byte{0x31, 0xc3}},
+	{crc.Modbus, func(b []byte) uint32 { return uint32(crc.CRC16Modbus(b)) }, 0x4b37, 0xffff, []byte{0x37, 0x4b}},
+	{crc.IEEE, crc.CRC32, 0xcbf43926, 0, []byte{0x26, 0x39, 0xf4, 0xcb}},
+}
+
+func TestCheck(t *testing.T) {
+	data := []byte("123456789")
+	for _, tt := range checkTests {
+		if got := tt.sum(data); got != tt.check {
+			t.Errorf("%s: the function returns %#x, want %#x", tt.alg.Name, got, tt.check)
+		}
+		if got := tt.alg.Sum(data); got != tt.check {
+			t.Errorf("%s: Sum = %#x, want %#x", tt.alg.Name, got, tt.check)
+		}
+		if got := tt.alg.Sum(nil); got != tt.empty {
+			t.Errorf("%s: Sum(nil) = %#x, want %#x", tt.alg.Name, got, tt.empty)
+		}
+		if tt.alg.Size != len(tt.wire) {
+			t.Errorf("%s: Size = %d, want %d", tt.alg.Name, tt.alg.Size, len(tt.wire))
+		}
+	}
+}
+
+func TestAppendStored(t *testing.T) {
+	for _, tt := range checkTests {
+		data := []byte("123456789")
+		b := tt.alg.Append(data[:len(data):len(data)])
+		if want := append([]byte("123456789"), tt.wire...); !bytes.Equal(b, want) {
+			t.Errorf("%s: Append = % x, want % x", tt.alg.Name, b, want)
+		}
+		if got := tt.alg.Stored(b); got != tt.check {
+			t.Errorf("%s: Stored = %#x, want %#x", tt.alg.Name, got, tt.check)
+		}
+		// The checksum of the data received matches the stored one, unless a byte is corrupted.
+		n := len(b) - tt.alg.Size
+		if tt.alg.Sum(b[:n]) != tt.alg.Stored(b) {
+			t.Errorf("%s: the appended checksum does not match", tt.alg.Name)
+		}
+		b[3] ^= 0x10
+		if tt.alg.Sum(b[:n]) == tt.alg.Stored(b) {
+			t.Errorf("%s: the checksum of corrupted data matches", tt.alg.Name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrBaudNotDetected is returned by DetectBaud when none of the candidate baud rates matches.
+var ErrBaudNotDetected = errors.New("serial: baud rate not detected")
+
+// DefaultBaudRates are the candidates of DetectBaud, in the order they are tried, unless given otherwise.
+var DefaultBaudRates = []int{115200, 9600, 57600, 38400, 19200, 230400, 460800, 921600, 4800, 2400, 1200, 74880, 250000}
+
+const (
+	// detectWindow is how long DetectBaud listens at every baud rate.
+	detectWindow = 500 * time.Millisecond
+
+	// detectSampleSize is the amount of input after which DetectBaud stops listening at a baud rate.
+	detectSampleSize = 256
+
+	// detectMinScore is the minimum score of the input for a baud rate to be detected.
+	detectMinScore = 0.9
+)
+
+// DetectBaud finds the baud rate of the device behind the port name, trying every candidate in turn.
+// Nil candidates means DefaultBaudRates. The port is opened with the 8N1 framing, and closed on return.
+//
+// If probe is not nil, it is called at every baud rate, and the first one for which it returns true
+// is detected. It can send a request to the device, like a newline to a console, and check the answer.
+//
+// Otherwise, DetectBaud listens to the device at every baud rate, and detects
+// the one with the most printable input and the fewest framing and parity errors,
+// which suits consoles and boot logs. The device must be sending meanwhile.
+func DetectBaud(name string, candidates []int, probe func(Port) bool) (int, error) {
+	if len(candidates) == 0 {
+		candidates = DefaultBaudRates
+	}
+	p, err := Open(name, candidates[0])
+	if err != nil {
+		return 0, err
+	}
+	defer p.Close()
+
+	best, bestScore := 0, 0.0
+	for _, baud := range candidates {
+		if err := p.SetBaudRate(baud); err != nil {
+			if errors.Is(err, ErrUnsupportedBaudRate) || errors.Is(err, ErrBaudMismatch) {
+				continue
+			}
+			return 0, err
+		}
+		if err := p.ResetInput(); err != nil {
+			return 0, err
+		}
+		if probe != nil {
+			if probe(p) {
+				return baud, nil
+			}
+			continue
+		}
+		score, err := listen(p)
+		if err != nil {
+			return 0, err
+		}
+		if score > bestScore {
+			best, bestScore = baud, score
+		}
+		if score == 1 {
+			break
+		}
+	}
+	if bestScore < detectMinScore {
+		return 0, fmt.Errorf("%w: at %d candidate rates", ErrBaudNotDetected, len(candidates))
+	}
+	return best, nil
+}
+
+// listen reads from p for detectWindow, and scores the input from 0 to 1 by the ratio of the printable characters,
+// lowered by the framing and parity errors. A perfect score needs at least detectSampleSize bytes.
+func listen(p Port) (float64, error) {
+	before, err := p.Stats()
+	if err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(detectWindow)
+	if err := p.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	defer p.SetReadDeadline(time.Time{})
+	buf := make([]byte, detectSampleSize)
+	n := 0
+	for n < len(buf) && time.Now().Before(deadline) {
+		m, err := p.Read(buf[n:])
+		n += m
+		if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			return 0, err
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	after, err := p.Stats()
+	if err != nil {
+		return 0, err
+	}
+	printable := 0
+	for _, c := range buf[:n] {
+		if c >= 0x20 && c < 0x7f || c == '\r' || c == '\n' || c == '\t' {
+			printable++
+		}
+	}
+	bad := (after.FrameErrors - before.FrameErrors) + (after.ParityErrors - before.ParityErrors) + (after.Breaks - before.Breaks)
+	score := (float64(printable) - float64(bad)) / float64(n)
+	if n < len(buf) && score == 1 {
+		// Too little input to be sure.
+		score = detectMinScore
+	}
+	return score, nil
+}
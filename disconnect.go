@@ -0,0 +1,74 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPortDisconnected is returned by the operations on a port whose device
+// has gone away, like an unplugged USB adapter. The error returned by
+// the system is wrapped along with it.
+var ErrPortDisconnected = errors.New("serial: port disconnected")
+
+// disconnectCheckInterval is how often a port with Config.OnDisconnect set
+// checks that its device is still there.
+const disconnectCheckInterval = time.Second
+
+// disconnectMonitor detects the disconnection of a port, and reports it to Config.OnDisconnect once.
+type disconnectMonitor struct {
+	onDisconnect func(error)
+	once         sync.Once
+	done         chan struct{} // closed when the port is closed
+	stopOnce     sync.Once
+}
+
+func newDisconnectMonitor(onDisconnect func(error)) *disconnectMonitor {
+	return &disconnectMonitor{onDisconnect: onDisconnect, done: make(chan struct{})}
+}
+
+// check converts err to ErrPortDisconnected, if isDisconnect reports that
+// it is caused by the disconnection, and reports it.
+func (m *disconnectMonitor) check(err error) error {
+	if err == nil || !isDisconnect(err) {
+		return err
+	}
+	return m.report(err)
+}
+
+// report wraps err, which is caused by the disconnection, with ErrPortDisconnected, and reports it.
+func (m *disconnectMonitor) report(err error) error {
+	err = fmt.Errorf("%w: %w", ErrPortDisconnected, err)
+	if m.onDisconnect != nil {
+		m.once.Do(func() { go m.onDisconnect(err) })
+	}
+	return err
+}
+
+// watch calls probe periodically until it detects the disconnection, or the monitor is stopped.
+// It does nothing if there is no one to report the disconnection to.
+func (m *disconnectMonitor) watch(probe func() error) {
+	if m.onDisconnect == nil {
+		return
+	}
+	go func() {
+		t := time.NewTicker(disconnectCheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-t.C:
+			}
+			if errors.Is(m.check(probe()), ErrPortDisconnected) {
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the watch, when the port is closed.
+func (m *disconnectMonitor) stop() {
+	m.stopOnce.Do(func() { close(m.done) })
+}
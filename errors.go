@@ -0,0 +1,50 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Errors returned when opening and configuring ports. They wrap the error
+// reported by the system, if any, so both can be checked with errors.Is and errors.As.
+// A port which does not exist is reported with an error wrapping fs.ErrNotExist.
+var (
+	// ErrUnsupportedBaudRate is returned for a baud rate which the system or the device can not use.
+	ErrUnsupportedBaudRate = errors.New("serial: unsupported baud rate")
+
+	// ErrBaudMismatch is returned when the baud rate read back from the device
+	// differs from the requested one.
+	ErrBaudMismatch = errors.New("serial: failed to set baud rate")
+
+	// ErrPortBusy is returned by Open when the port is in use by another process.
+	ErrPortBusy = errors.New("serial: port busy")
+
+	// ErrPermissionDenied is returned by Open when the user may not access the port,
+	// like when they are not a member of the dialout group on Linux.
+	ErrPermissionDenied = errors.New("serial: permission denied")
+)
+
+// WriteTimeoutError is returned by Write when the write deadline, or Config.WriteTimeout, passes
+// before all the data is written. Written is also returned by Write. It wraps os.ErrDeadlineExceeded,
+// and os.IsTimeout reports true for it.
+type WriteTimeoutError struct {
+	Written int // the number of bytes written before the timeout
+}
+
+func (e *WriteTimeoutError) Error() string {
+	return fmt.Sprintf("serial: write timed out after %d bytes", e.Written)
+}
+
+// Timeout reports true, like for net.Error.
+func (e *WriteTimeoutError) Timeout() bool { return true }
+
+func (e *WriteTimeoutError) Unwrap() error { return os.ErrDeadlineExceeded }
+
+// writeTimeout returns err, or a *WriteTimeoutError if it is a timeout after n bytes in all.
+func writeTimeout(n int, err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return &WriteTimeoutError{Written: n}
+	}
+	return err
+}
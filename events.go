@@ -0,0 +1,179 @@
+package serial
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	// DataReady reports that there is data to Read. It is not sent again until Read is called.
+	DataReady EventType = iota + 1
+	// LineStateChanged reports a change of the modem status lines, which are in Event.Status.
+	LineStateChanged
+	// Error reports a failure of the port, which is in Event.Err.
+	// No DataReady events follow it.
+	Error
+	// Closed reports that the port has been closed. It is the last event.
+	Closed
+)
+
+// Event is a notification sent on the channel of Port.Events.
+type Event struct {
+	Type   EventType
+	Status ModemStatus // the state of the lines, for LineStateChanged
+	Err    error       // for Error
+}
+
+const (
+	// eventsBuffer is the capacity of the channel returned by Port.Events.
+	eventsBuffer = 16
+
+	// lineCheckInterval is how often the modem lines are checked for the events.
+	// TIOCMIWAIT is not used, because the ioctl can not be interrupted by closing the port.
+	lineCheckInterval = 100 * time.Millisecond
+
+	// dataCheckInterval is how often the input is checked for the events,
+	// when the port can not wait for it.
+	dataCheckInterval = 20 * time.Millisecond
+)
+
+// dataWaiter is implemented by the ports which can wait for the input without reading it.
+type dataWaiter interface {
+	// waitData waits until there is data to read, or done is closed.
+	waitData(done <-chan struct{}) error
+}
+
+// events produces the events of a port for Port.Events.
+type events struct {
+	once     sync.Once
+	ch       chan Event
+	consumed chan struct{} // signaled by Read
+	done     chan struct{} // closed when the port is closed
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newEvents() *events {
+	return &events{consumed: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// start starts producing the events of the port on the first call, and returns their channel.
+func (e *events) start(w dataWaiter, status func() (ModemStatus, error)) <-chan Event {
+	e.once.Do(func() {
+		e.ch = make(chan Event, eventsBuffer)
+		e.wg.Add(2)
+		go e.watchData(w)
+		go e.watchLines(status)
+		go func() {
+			<-e.done
+			e.wg.Wait()
+			// Do not block forever, if no one receives the events anymore.
+			select {
+			case e.ch <- Event{Type: Closed}:
+			default:
+			}
+			close(e.ch)
+		}()
+	})
+	return e.ch
+}
+
+func (e *events) watchData(w dataWaiter) {
+	defer e.wg.Done()
+	for {
+		err := w.waitData(e.done)
+		if e.stopped() {
+			return
+		}
+		if err != nil {
+			e.send(Event{Type: Error, Err: err})
+			return
+		}
+		// Forget the reads before the data arrived.
+		select {
+		case <-e.consumed:
+		default:
+		}
+		if !e.send(Event{Type: DataReady}) {
+			return
+		}
+		select {
+		case <-e.consumed:
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *events) watchLines(status func() (ModemStatus, error)) {
+	defer e.wg.Done()
+	last, err := status()
+	if err != nil {
+		// The port has no modem lines, like a pty.
+		return
+	}
+	t := time.NewTicker(lineCheckInterval)
+	defer t.Stop()
+	failed := false
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-t.C:
+		}
+		s, err := status()
+		switch {
+		case e.stopped():
+			return
+		case err != nil:
+			// Report the failure once, the lines may come back, like with a ReconnectingPort.
+			if !failed && !e.send(Event{Type: Error, Err: err}) {
+				return
+			}
+			failed = true
+		case s != last:
+			failed = false
+			last = s
+			if !e.send(Event{Type: LineStateChanged, Status: s}) {
+				return
+			}
+		default:
+			failed = false
+		}
+	}
+}
+
+// send sends ev, unless the port is closed meanwhile.
+func (e *events) send(ev Event) bool {
+	select {
+	case e.ch <- ev:
+		return true
+	case <-e.done:
+		return false
+	}
+}
+
+func (e *events) stopped() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// read records a Read call which returned data, which allows the next DataReady event.
+func (e *events) read() {
+	select {
+	case e.consumed <- struct{}{}:
+	default:
+	}
+}
+
+// stop ends the events, when the port is closed.
+func (e *events) stop() {
+	e.stopOnce.Do(func() { close(e.done) })
+}
@@ -0,0 +1,58 @@
+package framing
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// cobsMaxBlock is the length of the longest COBS block, its code byte included, which is not followed by a zero.
+const cobsMaxBlock = 0xff
+
+// COBS is the codec of Consistent Overhead Byte Stuffing: the frames end with a zero, and the packet
+// is split at its zeros into blocks, each starting with its length plus one instead of the zero.
+// It adds at most one byte per 254 bytes of the packet, plus the delimiter.
+var COBS Codec = cobs{}
+
+type cobs struct{}
+
+func (cobs) Append(dst, packet []byte) []byte {
+	code := len(dst) // the position of the code byte of the current block
+	dst = append(dst, 0)
+	for _, b := range packet {
+		if b != 0 {
+			dst = append(dst, b)
+		}
+		if b == 0 || len(dst)-code == cobsMaxBlock {
+			dst[code] = byte(len(dst) - code)
+			code = len(dst)
+			dst = append(dst, 0)
+		}
+	}
+	dst[code] = byte(len(dst) - code)
+	return append(dst, 0)
+}
+
+func (cobs) Decode(dst, frame []byte) ([]byte, error) {
+	for i := 0; i < len(frame); {
+		code := int(frame[i])
+		if code == 0 {
+			return dst, fmt.Errorf("%w: zero in a COBS frame", ErrMalformedFrame)
+		}
+		end := i + code
+		if end > len(frame) {
+			return dst, fmt.Errorf("%w: COBS block of %d bytes past the end of the frame", ErrMalformedFrame, code)
+		}
+		block := frame[i+1 : end]
+		if bytes.IndexByte(block, 0) >= 0 {
+			return dst, fmt.Errorf("%w: zero in a COBS frame", ErrMalformedFrame)
+		}
+		dst = append(dst, block...)
+		if code < cobsMaxBlock && end < len(frame) {
+			dst = append(dst, 0)
+		}
+		i = end
+	}
+	return dst, nil
+}
+
+func (cobs) Delimiter() byte { return 0 }
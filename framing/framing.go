@@ -0,0 +1,167 @@
+// Package framing sends and receives packets over a serial port, delimited and escaped
+// with SLIP (RFC 1055) or COBS, as the binary protocols over a UART usually are.
+package framing
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jangocheng/serial/crc"
+)
+
+// DefaultMaxFrameLength is the maximum length of a frame on the wire, unless configured otherwise.
+const DefaultMaxFrameLength = 4096
+
+var (
+	// ErrFrameTooLong is returned by ReadPacket for a frame longer than Config.MaxFrameLength.
+	ErrFrameTooLong = errors.New("framing: frame too long")
+
+	// ErrMalformedFrame is returned by Decode for a frame which is not valid for the codec,
+	// like a SLIP escape followed by a byte which can not be escaped, or a COBS block past the end of the frame.
+	ErrMalformedFrame = errors.New("framing: malformed frame")
+
+	// ErrChecksum is wrapped by the ChecksumError returned for a packet whose checksum does not match.
+	ErrChecksum = errors.New("framing: checksum mismatch")
+)
+
+// ChecksumError is returned by ReadPacket for a packet whose checksum, Config.Checksum, does not match.
+type ChecksumError struct {
+	Algorithm string // the name of the checksum
+	Frame     []byte // the frame received, without its delimiter
+	Want      uint32 // the checksum received
+	Got       uint32 // the checksum computed
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%v: %s %#x received, %#x computed for the frame % x", ErrChecksum, e.Algorithm, e.Want, e.Got, e.Frame)
+}
+
+func (e *ChecksumError) Unwrap() error {
+	return ErrChecksum
+}
+
+// Codec turns the packets into frames on the wire, and back. The frames end with a delimiter,
+// which the encoding ensures does not appear anywhere else.
+type Codec interface {
+	// Append appends the frame of packet to dst, its delimiter included, and returns the extended buffer.
+	Append(dst, packet []byte) []byte
+
+	// Decode appends the packet of frame, received without its delimiter, to dst, and returns the extended buffer.
+	Decode(dst, frame []byte) ([]byte, error)
+
+	// Delimiter returns the byte which ends the frames.
+	Delimiter() byte
+}
+
+// Config describes how a Conn handles the frames.
+type Config struct {
+	// MaxFrameLength is the maximum length of a frame on the wire, its escapes included.
+	// Zero means DefaultMaxFrameLength.
+	MaxFrameLength int
+
+	// Checksum, if not nil, is appended to the packets written, and checked and removed from the packets read.
+	Checksum *crc.Algorithm
+}
+
+// Conn exchanges packets over a port, or any other stream, with a codec.
+// ReadPacket must be called by one goroutine at a time; WritePacket may be called concurrently.
+type Conn struct {
+	r     *bufio.Reader
+	w     io.Writer
+	codec Codec
+	cfg   Config
+
+	frame      []byte // the frame read so far
+	discarding bool   // the frame is too long, and is being skipped
+
+	wmu    sync.Mutex
+	wbuf   []byte
+	sumBuf []byte // the packet with its checksum
+}
+
+// NewConn returns a Conn exchanging packets over rw, like a serial.Port, framed with codec, like SLIP or COBS.
+func NewConn(rw io.ReadWriter, codec Codec, cfg Config) *Conn {
+	if cfg.MaxFrameLength <= 0 {
+		cfg.MaxFrameLength = DefaultMaxFrameLength
+	}
+	return &Conn{r: bufio.NewReader(rw), w: rw, codec: codec, cfg: cfg}
+}
+
+// ReadPacket returns the next packet. The empty frames, like the ones the sender inserts to flush
+// the noise of the line, are skipped.
+//
+// A frame which fails to decode, is too long, or fails its checksum, is returned as an error,
+// like ErrMalformedFrame, ErrFrameTooLong or a *ChecksumError, and the next call continues with the following frame.
+// If reading fails in the middle of a frame, like with a timeout, the part of the frame read so far is kept,
+// and the next call continues the frame. The input ending in the middle of a frame is io.ErrUnexpectedEOF.
+func (c *Conn) ReadPacket() ([]byte, error) {
+	delim := c.codec.Delimiter()
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && (len(c.frame) > 0 || c.discarding) {
+				c.frame, c.discarding = c.frame[:0], false
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b != delim {
+			if c.discarding {
+				continue
+			}
+			if len(c.frame) >= c.cfg.MaxFrameLength {
+				c.discarding = true
+				c.frame = c.frame[:0]
+				continue
+			}
+			c.frame = append(c.frame, b)
+			continue
+		}
+		if c.discarding {
+			c.discarding = false
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLong, c.cfg.MaxFrameLength)
+		}
+		if len(c.frame) == 0 {
+			continue
+		}
+		frame := c.frame
+		c.frame = c.frame[:0]
+		packet, err := c.codec.Decode(nil, frame)
+		if err != nil {
+			return nil, err
+		}
+		return c.check(packet, frame)
+	}
+}
+
+// check checks and removes the checksum of the packet, decoded from frame.
+func (c *Conn) check(packet, frame []byte) ([]byte, error) {
+	sum := c.cfg.Checksum
+	if sum == nil {
+		return packet, nil
+	}
+	n := len(packet) - sum.Size
+	if n < 0 {
+		return nil, fmt.Errorf("%w: %d bytes, shorter than the %s checksum", ErrMalformedFrame, len(packet), sum.Name)
+	}
+	if want, got := sum.Stored(packet), sum.Sum(packet[:n]); want != got {
+		return nil, &ChecksumError{Algorithm: sum.Name, Frame: append([]byte(nil), frame...), Want: want, Got: got}
+	}
+	return packet[:n], nil
+}
+
+// WritePacket sends packet, with its checksum if configured, as a single write of its frame.
+func (c *Conn) WritePacket(packet []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.cfg.Checksum != nil {
+		c.sumBuf = c.cfg.Checksum.Append(append(c.sumBuf[:0], packet...))
+		packet = c.sumBuf
+	}
+	c.wbuf = c.codec.Append(c.wbuf[:0], packet)
+	_, err := c.w.Write(c.wbuf)
+	return err
+}
@@ -0,0 +1,216 @@
+package framing_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/jangocheng/serial/crc"
+	"github.com/jangocheng/serial/framing"
+)
+
+// seq returns the bytes from first to last.
+func seq(first, last byte) []byte {
+	var b []byte
+	for c := int(first); c <= int(last); c++ {
+		b = append(b, byte(c))
+	}
+	return b
+}
+
+// cat concatenates its arguments, which are bytes or slices of bytes.
+func cat(parts ...any) []byte {
+	var b []byte
+	for _, p := range parts {
+		switch p := p.(type) {
+		case int:
+			b = append(b, byte(p))
+		case []byte:
+			b = append(b, p...)
+		}
+	}
+	return b
+}
+
+type codecTest struct {
+	packet []byte
+	frame  []byte // the frame on the wire, its delimiter included
+}
+
+// The examples of Cheshire and Baker, "Consistent Overhead Byte Stuffing": the packet is followed
+// by a zero, which is not sent, so a block of 254 bytes without a zero is followed by an empty one.
+var cobsTests = []codecTest{
+	{nil, cat(0x01, 0x00)},
+	{cat(0x00), cat(0x01, 0x01, 0x00)},
+	{cat(0x00, 0x00), cat(0x01, 0x01, 0x01, 0x00)},
+	{cat(0x11, 0x22, 0x00, 0x33), cat(0x03, 0x11, 0x22, 0x02, 0x33, 0x00)},
+	{cat(0x11, 0x22, 0x33, 0x44), cat(0x05, 0x11, 0x22, 0x33, 0x44, 0x00)},
+	{cat(0x11, 0x00, 0x00, 0x00), cat(0x02, 0x11, 0x01, 0x01, 0x01, 0x00)},
+	{seq(0x01, 0xfe), cat(0xff, seq(0x01, 0xfe), 0x01, 0x00)},
+	{seq(0x00, 0xfe), cat(0x01, 0xff, seq(0x01, 0xfe), 0x01, 0x00)},
+	{seq(0x01, 0xff), cat(0xff, seq(0x01, 0xfe), 0x02, 0xff, 0x00)},
+	{cat(seq(0x02, 0xff), 0x00), cat(0xff, seq(0x02, 0xff), 0x01, 0x01, 0x00)},
+	{cat(seq(0x03, 0xff), 0x00, 0x01), cat(0xfe, seq(0x03, 0xff), 0x02, 0x01, 0x00)},
+	{bytes.Repeat([]byte{0x42}, 600), cat(0xff, bytes.Repeat([]byte{0x42}, 254), 0xff, bytes.Repeat([]byte{0x42}, 254), 0x5d, bytes.Repeat([]byte{0x42}, 92), 0x00)},
+}
+
+// The escapes of RFC 1055, with the END the frames start with.
+var slipTests = []codecTest{
+	{nil, cat(0xc0, 0xc0)},
+	{cat(0x01, 0x02), cat(0xc0, 0x01, 0x02, 0xc0)},
+	{cat(0x01, 0xc0, 0x02), cat(0xc0, 0x01, 0xdb, 0xdc, 0x02, 0xc0)},
+	{cat(0xdb), cat(0xc0, 0xdb, 0xdd, 0xc0)},
+	{cat(0xc0, 0xdb), cat(0xc0, 0xdb, 0xdc, 0xdb, 0xdd, 0xc0)},
+	{cat(0xdb, 0xdc), cat(0xc0, 0xdb, 0xdd, 0xdc, 0xc0)},
+	{cat(0xdc, 0xdd), cat(0xc0, 0xdc, 0xdd, 0xc0)},
+	{cat(0xc0, 0xc0), cat(0xc0, 0xdb, 0xdc, 0xdb, 0xdc, 0xc0)},
+}
+
+func TestCodecs(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		codec framing.Codec
+		tests []codecTest
+		// skip is the number of delimiters the frames start with, which are not part of the frame read.
+		skip int
+	}{
+		{"COBS", framing.COBS, cobsTests, 0},
+		{"SLIP", framing.SLIP, slipTests, 1},
+	} {
+		for _, tt := range c.tests {
+			prefix := []byte("prefix")
+			got := c.codec.Append(append([]byte(nil), prefix...), tt.packet)
+			if !bytes.Equal(got, cat(prefix, tt.frame)) {
+				t.Errorf("%s: Append(% x) = % x, want % x", c.name, tt.packet, got[len(prefix):], tt.frame)
+			}
+			frame := tt.frame[c.skip : len(tt.frame)-1]
+			if i := bytes.IndexByte(frame, c.codec.Delimiter()); i >= 0 {
+				t.Errorf("%s: the delimiter in the frame of % x at %d", c.name, tt.packet, i)
+			}
+			packet, err := c.codec.Decode(append([]byte(nil), prefix...), frame)
+			if err != nil || !bytes.Equal(packet, cat(prefix, tt.packet)) {
+				t.Errorf("%s: Decode(% x) = % x, %v, want % x", c.name, frame, packet[len(prefix):], err, tt.packet)
+			}
+		}
+	}
+}
+
+func TestCOBSDecodeLongBlockAtEnd(t *testing.T) {
+	// A block of 254 bytes at the end of the frame is not followed by a zero, with or without the empty block after it.
+	for _, frame := range [][]byte{cat(0xff, seq(0x01, 0xfe)), cat(0xff, seq(0x01, 0xfe), 0x01)} {
+		if packet, err := framing.COBS.Decode(nil, frame); err != nil || !bytes.Equal(packet, seq(0x01, 0xfe)) {
+			t.Errorf("Decode of %d bytes = % x, %v, want % x", len(frame), packet, err, seq(0x01, 0xfe))
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		codec framing.Codec
+		frame []byte
+	}{
+		{"COBS zero", framing.COBS, cat(0x03, 0x11, 0x00, 0x01)},
+		{"COBS zero code", framing.COBS, cat(0x00)},
+		{"COBS truncated block", framing.COBS, cat(0x05, 0x11, 0x22)},
+		{"COBS truncated long block", framing.COBS, cat(0xff, seq(0x01, 0xfd))},
+		{"COBS truncated second block", framing.COBS, cat(0x02, 0x11, 0x04, 0x22)},
+		{"SLIP escape at the end", framing.SLIP, cat(0x01, 0xdb)},
+		{"SLIP escape alone", framing.SLIP, cat(0xdb)},
+		{"SLIP escape of a plain byte", framing.SLIP, cat(0xdb, 0x01)},
+		{"SLIP escape of an escape", framing.SLIP, cat(0xdb, 0xdb, 0xdd)},
+	} {
+		if packet, err := tt.codec.Decode(nil, tt.frame); !errors.Is(err, framing.ErrMalformedFrame) {
+			t.Errorf("%s: Decode(% x) = % x, %v, want ErrMalformedFrame", tt.name, tt.frame, packet, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var packets [][]byte
+	for i := 0; i < 200; i++ {
+		// Mostly the special bytes of the codecs, to exercise the escapes and the short blocks.
+		packet := make([]byte, 1+rng.Intn(700))
+		for j := range packet {
+			if rng.Intn(2) == 0 {
+				packet[j] = []byte{0x00, 0xc0, 0xdb, 0xdc, 0xdd, 0xff}[rng.Intn(6)]
+			} else {
+				packet[j] = byte(rng.Intn(256))
+			}
+		}
+		packets = append(packets, packet)
+	}
+	packets = append(packets, bytes.Repeat([]byte{0}, 300), bytes.Repeat([]byte{0xc0}, 300), bytes.Repeat([]byte{1}, 254*3))
+
+	for _, codec := range []framing.Codec{framing.COBS, framing.SLIP} {
+		for _, sum := range []*crc.Algorithm{nil, crc.CCITT, crc.IEEE} {
+			var wire bytes.Buffer
+			c := framing.NewConn(&wire, codec, framing.Config{Checksum: sum})
+			for _, packet := range packets {
+				if err := c.WritePacket(packet); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, want := range packets {
+				got, err := c.ReadPacket()
+				if err != nil || !bytes.Equal(got, want) {
+					t.Fatalf("%T with checksum %v: packet %d: % x, %v, want % x", codec, sum, i, got, err, want)
+				}
+			}
+			if _, err := c.ReadPacket(); err != io.EOF {
+				t.Errorf("%T with checksum %v: ReadPacket at the end: %v, want io.EOF", codec, sum, err)
+			}
+		}
+	}
+}
+
+func TestReadPacketErrors(t *testing.T) {
+	slip := func(packet []byte) []byte { return framing.SLIP.Append(nil, packet) }
+	withSum := func(packet []byte) []byte { return crc.CCITT.Append(append([]byte(nil), packet...)) }
+	corrupted := slip(withSum([]byte("corrupted")))
+	corrupted[3] ^= 1
+
+	var wire bytes.Buffer
+	wire.Write(slip(withSum([]byte("first"))))
+	wire.Write(cat(0xc0, 0x01, 0xdb, 0x02, 0xc0))              // a malformed escape
+	wire.Write(slip(withSum(bytes.Repeat([]byte{0x42}, 100)))) // longer than MaxFrameLength
+	wire.Write(corrupted)                                      // with a wrong checksum
+	wire.Write(cat(0xc0, 0x01, 0xc0))                          // shorter than the checksum
+	wire.Write(cat(0xc0, 0xc0, 0xc0))                          // empty frames, skipped
+	wire.Write(slip(withSum([]byte("second"))))                // the errors do not lose the next frame
+	wire.Write(slip(withSum([]byte("truncated")))[:6])         // the input ends in the middle of a frame
+	c := framing.NewConn(&wire, framing.SLIP, framing.Config{MaxFrameLength: 32, Checksum: crc.CCITT})
+
+	check := func(want string, wantErr error) {
+		t.Helper()
+		packet, err := c.ReadPacket()
+		if !errors.Is(err, wantErr) || string(packet) != want {
+			t.Errorf("ReadPacket = %q, %v, want %q, %v", packet, err, want, wantErr)
+		}
+	}
+	check("first", nil)
+	check("", framing.ErrMalformedFrame)
+	check("", framing.ErrFrameTooLong)
+	check("", framing.ErrChecksum)
+	check("", framing.ErrMalformedFrame)
+	check("second", nil)
+	check("", io.ErrUnexpectedEOF)
+	check("", io.EOF)
+}
+
+func TestReadPacketChecksumError(t *testing.T) {
+	frame := framing.COBS.Append(nil, crc.Modbus.Append([]byte{1, 2, 3}))
+	frame[1] ^= 0x80
+	c := framing.NewConn(bytes.NewBuffer(frame), framing.COBS, framing.Config{Checksum: crc.Modbus})
+	_, err := c.ReadPacket()
+	var cerr *framing.ChecksumError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("ReadPacket: %v, want a *ChecksumError", err)
+	}
+	if want := crc.Modbus.Sum([]byte{0x81, 2, 3}); cerr.Algorithm != crc.Modbus.Name || cerr.Got != want || !bytes.Equal(cerr.Frame, frame[:len(frame)-1]) {
+		t.Errorf("ChecksumError %+v, want the %s %#x of the frame % x", cerr, crc.Modbus.Name, want, frame[:len(frame)-1])
+	}
+}
@@ -0,0 +1,58 @@
+package framing
+
+import "fmt"
+
+// The special characters of SLIP.
+const (
+	slipEnd    = 0xc0
+	slipEsc    = 0xdb
+	slipEscEnd = 0xdc
+	slipEscEsc = 0xdd
+)
+
+// SLIP is the codec of RFC 1055: the frames end with 0xC0, whose occurrences in the packet are escaped
+// as 0xDB 0xDC, and the ones of the escape 0xDB as 0xDB 0xDD. The frames start with 0xC0 too,
+// as the RFC recommends, to flush the noise received by the other end since the previous frame.
+var SLIP Codec = slip{}
+
+type slip struct{}
+
+func (slip) Append(dst, packet []byte) []byte {
+	dst = append(dst, slipEnd)
+	for _, b := range packet {
+		switch b {
+		case slipEnd:
+			dst = append(dst, slipEsc, slipEscEnd)
+		case slipEsc:
+			dst = append(dst, slipEsc, slipEscEsc)
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return append(dst, slipEnd)
+}
+
+func (slip) Decode(dst, frame []byte) ([]byte, error) {
+	for i := 0; i < len(frame); i++ {
+		b := frame[i]
+		if b != slipEsc {
+			dst = append(dst, b)
+			continue
+		}
+		i++
+		if i == len(frame) {
+			return dst, fmt.Errorf("%w: SLIP escape at the end of the frame", ErrMalformedFrame)
+		}
+		switch frame[i] {
+		case slipEscEnd:
+			dst = append(dst, slipEnd)
+		case slipEscEsc:
+			dst = append(dst, slipEsc)
+		default:
+			return dst, fmt.Errorf("%w: SLIP escape of %#02x", ErrMalformedFrame, frame[i])
+		}
+	}
+	return dst, nil
+}
+
+func (slip) Delimiter() byte { return slipEnd }
@@ -0,0 +1,57 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ReadFull reads exactly len(buf) bytes from p, like a fixed-length binary frame.
+// If timeout is positive, it limits the whole call, and the number of the bytes read so far is returned
+// along with an error wrapping os.ErrDeadlineExceeded. ReadFull uses the read deadline of the port,
+// and clears it before returning.
+func ReadFull(p Port, buf []byte, timeout time.Duration) (int, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := p.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	defer p.SetReadDeadline(time.Time{})
+	n := 0
+	for n < len(buf) {
+		m, err := p.Read(buf[n:])
+		n += m
+		if err != nil && n < len(buf) {
+			timedOut := errors.Is(err, os.ErrDeadlineExceeded)
+			// Config.ReadTimeout may end a Read before the deadline of the call.
+			if timedOut && (deadline.IsZero() || time.Now().Before(deadline)) {
+				continue
+			}
+			if timedOut {
+				return n, fmt.Errorf("serial: %d of %d bytes read in %v: %w", n, len(buf), timeout, err)
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// WriteAll writes all of buf to p, continuing after the short writes.
+func WriteAll(p Port, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := p.Write(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,104 @@
+package serial
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// gapped returns p, which applies Config.InterByteTimeout of cfg, if set.
+// p is opened without Config.ReadTimeout then, which gapped applies too.
+func gapped(p Port, cfg Config) Port {
+	if cfg.InterByteTimeout <= 0 {
+		return p
+	}
+	return &gapPort{Port: p, readTimeout: cfg.ReadTimeout, gap: cfg.InterByteTimeout}
+}
+
+// gapPort is a port whose Read continues until the line is silent for a while.
+type gapPort struct {
+	Port
+	readTimeout time.Duration
+	gap         time.Duration
+
+	mu       sync.Mutex
+	deadline time.Time // set by SetReadDeadline
+}
+
+// Read implements io.Reader
+func (p *gapPort) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port. The time is when the first part of the data was received.
+func (p *gapPort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	var timeout time.Time
+	if p.readTimeout > 0 {
+		timeout = time.Now().Add(p.readTimeout)
+	}
+	// deadline returns the end of the whole Read.
+	deadline := func() time.Time {
+		if !timeout.IsZero() {
+			return timeout
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.deadline
+	}
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.Port.SetReadDeadline(p.deadline)
+	}()
+
+	if err := p.Port.SetReadDeadline(deadline()); err != nil {
+		return 0, time.Time{}, err
+	}
+	n, ts, err := p.Port.ReadTimestamped(buf)
+	for err == nil && n > 0 && n < len(buf) {
+		end := time.Now().Add(p.gap)
+		if d := deadline(); !d.IsZero() && d.Before(end) {
+			end = d
+		}
+		if err := p.Port.SetReadDeadline(end); err != nil {
+			return n, ts, err
+		}
+		var m int
+		m, err = p.Port.Read(buf[n:])
+		n += m
+	}
+	if n > 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+		// The silence, or the timeout, ends the data received so far.
+		err = nil
+	}
+	return n, ts, err
+}
+
+// SetReadDeadline implements Port
+func (p *gapPort) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.Port.SetReadDeadline(t); err != nil {
+		return err
+	}
+	p.deadline = t
+	return nil
+}
+
+// writeBuffers writes with the wrapped port, which InterByteTimeout does not concern.
+func (p *gapPort) writeBuffers(bufs [][]byte) (int64, error) {
+	return WriteBuffers(p.Port, bufs)
+}
+
+// Config implements Port
+func (p *gapPort) Config() Config {
+	cfg := p.Port.Config()
+	cfg.ReadTimeout = p.readTimeout
+	return cfg
+}
+
+func (p *gapPort) unwrap() Port {
+	return p.Port
+}
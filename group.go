@@ -0,0 +1,171 @@
+package serial
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PortGroup is a set of ports managed together, like the identical lines of an array of LED controllers
+// or of a rig of sensors. The operations on the group run on all its ports at once, and report the
+// failures of each port in a *GroupError. It is safe for concurrent use, as far as its ports are.
+type PortGroup struct {
+	names []string
+	ports []Port
+}
+
+// GroupError reports the ports of a group for which an operation failed.
+type GroupError struct {
+	Op     string           // the operation, like "open" or "write"
+	Errors map[string]error // the errors, by port name
+	names  []string         // the names of the failed ports, in the order of the group
+}
+
+func (e *GroupError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "serial: %s failed on %d ports", e.Op, len(e.Errors))
+	for i, name := range e.names {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s: %v", name, e.Errors[name])
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the ports, for errors.Is and errors.As.
+func (e *GroupError) Unwrap() []error {
+	errs := make([]error, len(e.names))
+	for i, name := range e.names {
+		errs[i] = e.Errors[name]
+	}
+	return errs
+}
+
+// OpenGroup opens the ports names concurrently, all configured as described by cfg.
+// If some of them fail to open, OpenGroup returns a *GroupError for them, along with
+// the group of the ports which did open, so that a rig keeps working without a broken line;
+// the caller closes the group if it needs all of them. The names must be unique.
+func OpenGroup(names []string, cfg Config) (*PortGroup, error) {
+	if err := uniqueNames(names); err != nil {
+		return nil, err
+	}
+	ports := make([]Port, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			ports[i], errs[i] = OpenWithConfig(name, cfg)
+		}(i, name)
+	}
+	wg.Wait()
+	g := new(PortGroup)
+	for i, p := range ports {
+		if errs[i] == nil {
+			g.names = append(g.names, names[i])
+			g.ports = append(g.ports, p)
+		}
+	}
+	return g, groupError("open", names, errs)
+}
+
+// NewGroup returns a group of ports already open, named by the unique names, one for each port.
+func NewGroup(names []string, ports []Port) (*PortGroup, error) {
+	if len(names) != len(ports) {
+		return nil, fmt.Errorf("serial: %d names for %d ports", len(names), len(ports))
+	}
+	if err := uniqueNames(names); err != nil {
+		return nil, err
+	}
+	return &PortGroup{names: append([]string(nil), names...), ports: append([]Port(nil), ports...)}, nil
+}
+
+// Len returns the number of ports of the group.
+func (g *PortGroup) Len() int {
+	return len(g.ports)
+}
+
+// Names returns the names of the ports of the group, in order.
+func (g *PortGroup) Names() []string {
+	return append([]string(nil), g.names...)
+}
+
+// Ports returns the ports of the group, in the order of Names.
+func (g *PortGroup) Ports() []Port {
+	return append([]Port(nil), g.ports...)
+}
+
+// Port returns the port of the group named name, or nil if there is none.
+func (g *PortGroup) Port(name string) Port {
+	for i, n := range g.names {
+		if n == name {
+			return g.ports[i]
+		}
+	}
+	return nil
+}
+
+// Do calls fn for every port of the group concurrently, like to change the baud rate of all of them,
+// and returns a *GroupError named op for the calls which fail, or nil.
+func (g *PortGroup) Do(op string, fn func(name string, p Port) error) error {
+	errs := make([]error, len(g.ports))
+	var wg sync.WaitGroup
+	for i, p := range g.ports {
+		wg.Add(1)
+		go func(i int, p Port) {
+			defer wg.Done()
+			errs[i] = fn(g.names[i], p)
+		}(i, p)
+	}
+	wg.Wait()
+	return groupError(op, g.names, errs)
+}
+
+// BroadcastWrite writes data to every port of the group concurrently, like a frame addressed to all
+// the controllers of an array, and returns a *GroupError for the ports it fails on, or nil.
+func (g *PortGroup) BroadcastWrite(data []byte) error {
+	return g.Do("write", func(_ string, p Port) error {
+		_, err := p.Write(data)
+		return err
+	})
+}
+
+// Close closes every port of the group, and returns a *GroupError for the ports which fail to, or nil.
+func (g *PortGroup) Close() error {
+	return g.Do("close", func(_ string, p Port) error { return p.Close() })
+}
+
+// uniqueNames checks that no port of a group is named twice, since the errors are reported by name.
+func uniqueNames(names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("serial: duplicate port name %q in group", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// groupError returns the *GroupError of the errors of the ports names, or nil if they are all nil.
+func groupError(op string, names []string, errs []error) error {
+	var e *GroupError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if e == nil {
+			e = &GroupError{Op: op, Errors: make(map[string]error)}
+		}
+		e.Errors[names[i]] = err
+		e.names = append(e.names, names[i])
+	}
+	if e == nil {
+		return nil
+	}
+	return e
+}
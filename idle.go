@@ -0,0 +1,97 @@
+package serial
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idled returns p, which watches for the idle periods of its input as configured by cfg, unless disabled.
+func idled(p Port, cfg Config) Port {
+	if cfg.IdleTimeout <= 0 || (cfg.OnIdle == nil && len(cfg.KeepAlive) == 0) {
+		return p
+	}
+	ip := &idlePort{
+		Port:      p,
+		timeout:   cfg.IdleTimeout,
+		onIdle:    cfg.OnIdle,
+		keepAlive: append([]byte(nil), cfg.KeepAlive...),
+		done:      make(chan struct{}),
+	}
+	ip.last.Store(time.Now().UnixNano())
+	go ip.watch()
+	return ip
+}
+
+// idlePort is a port which reports the periods without input, and sends a keepalive then.
+type idlePort struct {
+	Port
+	timeout   time.Duration
+	onIdle    func(d time.Duration)
+	keepAlive []byte
+	last      atomic.Int64 // UnixNano of the last data read, or of the open
+	done      chan struct{}
+	doneOnce  sync.Once
+}
+
+// Read implements io.Reader
+func (p *idlePort) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port
+func (p *idlePort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	n, ts, err := p.Port.ReadTimestamped(buf)
+	if n > 0 {
+		p.last.Store(time.Now().UnixNano())
+	}
+	return n, ts, err
+}
+
+// writeBuffers writes with the wrapped port; only the input counts for the idle periods.
+func (p *idlePort) writeBuffers(bufs [][]byte) (int64, error) {
+	return WriteBuffers(p.Port, bufs)
+}
+
+// Close implements io.Closer
+func (p *idlePort) Close() error {
+	p.doneOnce.Do(func() { close(p.done) })
+	return p.Port.Close()
+}
+
+// watch checks the input every time it may have been idle for the timeout, until the port is closed.
+func (p *idlePort) watch() {
+	t := time.NewTimer(p.timeout)
+	defer t.Stop()
+	// The time of the last data, or of the last report, the next one is due after.
+	since := time.Unix(0, p.last.Load())
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		if last := time.Unix(0, p.last.Load()); last.After(since) {
+			since = last
+		}
+		if wait := since.Add(p.timeout).Sub(now); wait > 0 {
+			t.Reset(wait)
+			continue
+		}
+		if p.onIdle != nil {
+			p.onIdle(now.Sub(time.Unix(0, p.last.Load())))
+		}
+		if len(p.keepAlive) > 0 {
+			// A failure shows up in the Read and Write calls of the user.
+			p.Port.Write(p.keepAlive)
+		}
+		since = now
+		t.Reset(p.timeout)
+	}
+}
+
+func (p *idlePort) unwrap() Port {
+	return p.Port
+}
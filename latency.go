@@ -0,0 +1,13 @@
+package serial
+
+import "time"
+
+// SetLatencyTimer sets the latency timer of the USB adapter behind the port name, like an FTDI one:
+// how long it buffers the input before sending it to the host, 16 ms by default, from 1 to 255 ms.
+// It is only supported on Linux, through the latency_timer attribute of the device in sysfs,
+// which is writable by root. A udev rule can make it writable by others, or set it when the adapter is plugged in:
+//
+//	ACTION=="add", SUBSYSTEM=="usb-serial", DRIVER=="ftdi_sio", ATTR{latency_timer}="1"
+func SetLatencyTimer(name string, d time.Duration) error {
+	return setLatencyTimer(name, d)
+}
@@ -0,0 +1,77 @@
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DefaultMaxLineLength is the maximum length of a line read by LineReader, unless configured otherwise.
+const DefaultMaxLineLength = 4096
+
+// ErrLineTooLong is returned by LineReader.ReadLine for the lines longer than the maximum length.
+var ErrLineTooLong = errors.New("serial: line too long")
+
+// LineReader reads the lines of a line-based protocol, like NMEA or AT commands, from a port.
+type LineReader struct {
+	r          *bufio.Reader
+	terminator []byte
+	maxLen     int
+
+	line       []byte // the line read so far
+	discarding bool   // the line is too long, and is being skipped
+}
+
+// NewLineReader returns a LineReader which reads from r the lines ended with terminator,
+// like []byte("\r\n"), []byte("\r") or []byte{0x03}. An empty terminator means "\n".
+// The lines longer than maxLen bytes are skipped. Non-positive maxLen means DefaultMaxLineLength.
+func NewLineReader(r io.Reader, terminator []byte, maxLen int) *LineReader {
+	if len(terminator) == 0 {
+		terminator = []byte("\n")
+	}
+	if maxLen <= 0 {
+		maxLen = DefaultMaxLineLength
+	}
+	return &LineReader{
+		r:          bufio.NewReader(r),
+		terminator: append([]byte(nil), terminator...),
+		maxLen:     maxLen,
+	}
+}
+
+// ReadLine returns the next line without the terminator.
+//
+// If the line is longer than the maximum length, ReadLine skips it up to the next terminator,
+// and returns ErrLineTooLong. The following call returns the line after it.
+// If reading fails in the middle of a line, like with a timeout, the part of
+// the line read so far is kept, and the next call continues the line.
+// At the end of the input, the unterminated rest is returned as the last line.
+func (l *LineReader) ReadLine() ([]byte, error) {
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(l.line) > 0 && !l.discarding {
+				line := l.line
+				l.line = nil
+				return line, nil
+			}
+			return nil, err
+		}
+		l.line = append(l.line, c)
+		if bytes.HasSuffix(l.line, l.terminator) {
+			line := l.line[:len(l.line)-len(l.terminator)]
+			l.line = nil
+			if l.discarding {
+				l.discarding = false
+				return nil, ErrLineTooLong
+			}
+			return line, nil
+		}
+		if tail := len(l.terminator) - 1; len(l.line) > l.maxLen+tail {
+			// Keep only the bytes which may start the terminator.
+			l.discarding = true
+			l.line = append(l.line[:0], l.line[len(l.line)-tail:]...)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// usbPollInterval is how often OpenByID looks for the device, with Config.WaitForDevice.
+const usbPollInterval = 500 * time.Millisecond
+
+// PortInfo describes a serial port found on the system.
+type PortInfo struct {
+	// Name is the name of the port to pass to Open, like /dev/ttyUSB0 or COM3.
+	Name string
+
+	// IsUSB reports whether the port belongs to a USB device.
+	// The fields below are only set for USB ports.
+	IsUSB bool
+
+	VID          uint16 // USB vendor ID
+	PID          uint16 // USB product ID
+	SerialNumber string
+	Manufacturer string
+	Product      string
+	Interface    int // the number of the USB interface, which tells apart the ports of a multi-port adapter
+
+	// Driver is the name of the driver of the port, like ftdi_sio or cdc_acm on Linux,
+	// or the service, like FTDIBUS or usbser, on Windows.
+	Driver string
+
+	// ByID and ByPath are the links to the port created by udev on Linux in /dev/serial/by-id,
+	// which stays the same for the same adapter, and /dev/serial/by-path, which stays the same
+	// for the same USB socket.
+	ByID   string
+	ByPath string
+}
+
+// ListPorts returns the serial ports available on the system.
+// The USB details are read from sysfs on Linux and from SetupAPI on Windows.
+// On macOS and the BSDs only the names of the ports are reported.
+func ListPorts() ([]PortInfo, error) {
+	return listPorts()
+}
+
+// LookupPort returns the details of the port name, like ListPorts does, to check that the expected
+// adapter is behind a port. On Linux, the name may be a link, like /dev/serial/by-id/....
+// A name which is not a serial port of the system is reported with an error wrapping fs.ErrNotExist.
+func LookupPort(name string) (PortInfo, error) {
+	return lookupPort(name)
+}
+
+// OpenByID opens the port of the USB device with the vendor ID vid and the product ID pid,
+// and the serial number, unless it is empty, like OpenWithConfig does. Unlike the names
+// like /dev/ttyUSB0, which depend on the order the devices appear in, the IDs stay the same
+// for the same adapter. With Config.WaitForDevice, OpenByID waits until the device is plugged in;
+// use OpenByIDContext to stop waiting.
+// The device is looked for with ListPorts, so it is only found on Linux and Windows;
+// elsewhere OpenByID fails with an error wrapping errors.ErrUnsupported.
+//
+// A device which is not found is reported with an error wrapping fs.ErrNotExist.
+// Several matching ports, like the ones of a multi-port adapter, are an error;
+// pick one of them from ListPorts with PortInfo.Interface instead.
+func OpenByID(vid, pid uint16, serialNumber string, cfg Config) (Port, error) {
+	name, err := waitUSBPort(context.Background(), vid, pid, serialNumber, cfg.WaitForDevice)
+	if err != nil {
+		return nil, err
+	}
+	return OpenWithConfig(name, cfg)
+}
+
+// OpenByIDContext is like OpenByID, but binds the opened port to ctx, like OpenContext does.
+// With Config.WaitForDevice, ctx also ends the wait for the device.
+func OpenByIDContext(ctx context.Context, vid, pid uint16, serialNumber string, cfg Config) (Port, error) {
+	name, err := waitUSBPort(ctx, vid, pid, serialNumber, cfg.WaitForDevice)
+	if err != nil {
+		return nil, err
+	}
+	return OpenContext(ctx, name, cfg)
+}
+
+// waitUSBPort returns the name of the only port of the USB device, waiting until it is plugged in
+// or ctx is done if wait is true.
+func waitUSBPort(ctx context.Context, vid, pid uint16, serialNumber string, wait bool) (string, error) {
+	if !listsUSB {
+		return "", fmt.Errorf("serial: finding the ports of the USB devices: %w", errors.ErrUnsupported)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	t := time.NewTicker(usbPollInterval)
+	defer t.Stop()
+	for {
+		name, err := findUSBPort(vid, pid, serialNumber)
+		if err == nil || !wait || !errors.Is(err, fs.ErrNotExist) {
+			return name, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// findUSBPort returns the name of the only port of the USB device.
+func findUSBPort(vid, pid uint16, serialNumber string) (string, error) {
+	id := fmt.Sprintf("usb:%04x:%04x", vid, pid)
+	if serialNumber != "" {
+		id += ":" + serialNumber
+	}
+	ports, err := ListPorts()
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, p := range ports {
+		if p.IsUSB && p.VID == vid && p.PID == pid && (serialNumber == "" || p.SerialNumber == serialNumber) {
+			names = append(names, p.Name)
+		}
+	}
+	switch len(names) {
+	case 0:
+		return "", &fs.PathError{Op: "open", Path: id, Err: fs.ErrNotExist}
+	case 1:
+		return names[0], nil
+	}
+	return "", fmt.Errorf("serial: %d ports match %s: %s", len(names), id, strings.Join(names, ", "))
+}
+
+// findPort returns the port name from ports, comparing the names with equal.
+func findPort(ports []PortInfo, name string, equal func(a, b string) bool) (PortInfo, error) {
+	for _, p := range ports {
+		if equal(p.Name, name) {
+			return p, nil
+		}
+	}
+	return PortInfo{}, &fs.PathError{Op: "lookup", Path: name, Err: fs.ErrNotExist}
+}
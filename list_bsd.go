@@ -0,0 +1,48 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package serial
+
+import (
+	"path/filepath"
+	"runtime"
+)
+
+// listsUSB is false, as only the names of the ports are listed.
+const listsUSB = false
+
+// portPatterns are the names of the callout devices of serial ports,
+// which can be opened without waiting for the carrier.
+var portPatterns = map[string][]string{
+	"darwin":    {"/dev/cu.*"},
+	"dragonfly": {"/dev/cuaa*", "/dev/cuaU*"},
+	"freebsd":   {"/dev/cuau*", "/dev/cuaU*"},
+	"netbsd":    {"/dev/dty0*", "/dev/dtyU*"},
+	"openbsd":   {"/dev/cua0*", "/dev/cuaU*"},
+}
+
+func lookupPort(name string) (PortInfo, error) {
+	ports, err := listPorts()
+	if err != nil {
+		return PortInfo{}, err
+	}
+	return findPort(ports, name, func(a, b string) bool { return a == b })
+}
+
+func listPorts() ([]PortInfo, error) {
+	var ports []PortInfo
+	for _, pattern := range portPatterns[runtime.GOOS] {
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			// Skip the .init and .lock control devices of FreeBSD.
+			if ext := filepath.Ext(name); ext == ".init" || ext == ".lock" {
+				continue
+			}
+			ports = append(ports, PortInfo{Name: name})
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,138 @@
+package serial
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listsUSB is true, as the USB details of the ports are read from sysfs.
+const listsUSB = true
+
+const sysClassTTY = "/sys/class/tty"
+
+func listPorts() ([]PortInfo, error) {
+	entries, err := os.ReadDir(sysClassTTY)
+	if err != nil {
+		return nil, err
+	}
+	links := serialLinks()
+	var ports []PortInfo
+	for _, e := range entries {
+		if info, ok := portInfo(e.Name(), links); ok {
+			ports = append(ports, info)
+		}
+	}
+	return ports, nil
+}
+
+func lookupPort(name string) (PortInfo, error) {
+	dev, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return PortInfo{}, err
+	}
+	// The sysfs names have ! instead of the / of the subdirectories of /dev.
+	tty := strings.Replace(strings.TrimPrefix(dev, "/dev/"), "/", "!", -1)
+	info, ok := portInfo(tty, serialLinks())
+	if !ok {
+		return PortInfo{}, &fs.PathError{Op: "lookup", Path: name, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
+
+// portInfo returns the details of the tty of the sysfs name tty, if it is a serial port.
+// links maps the devices to their links in /dev/serial.
+func portInfo(tty string, links map[string][]string) (PortInfo, bool) {
+	dir := filepath.Join(sysClassTTY, tty)
+	// Virtual terminals and ptys are not backed by a device.
+	if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+		return PortInfo{}, false
+	}
+	// The serial core registers ports for every possible UART,
+	// and reports type 0 (PORT_UNKNOWN) for those which are not present.
+	if typ, ok := readSysfs(dir, "type"); ok && typ == "0" {
+		return PortInfo{}, false
+	}
+	info := PortInfo{Name: "/dev/" + strings.Replace(tty, "!", "/", -1)}
+	if driver, err := filepath.EvalSymlinks(filepath.Join(dir, "device", "driver")); err == nil {
+		info.Driver = filepath.Base(driver)
+	}
+	for _, link := range links[info.Name] {
+		switch filepath.Base(filepath.Dir(link)) {
+		case "by-id":
+			info.ByID = link
+		case "by-path":
+			info.ByPath = link
+		}
+	}
+	readUSBInfo(&info, filepath.Join(dir, "device"))
+	return info, true
+}
+
+// serialLinks returns the links created by udev in /dev/serial/by-id and /dev/serial/by-path,
+// keyed by the device they point to.
+func serialLinks() map[string][]string {
+	links := make(map[string][]string)
+	for _, dir := range []string{"/dev/serial/by-id", "/dev/serial/by-path"} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			link := filepath.Join(dir, e.Name())
+			if dev, err := filepath.EvalSymlinks(link); err == nil {
+				links[dev] = append(links[dev], link)
+			}
+		}
+	}
+	return links
+}
+
+// readUSBInfo fills the USB fields of info if the sysfs device dev belongs to a USB device.
+func readUSBInfo(info *PortInfo, dev string) {
+	dir, err := filepath.EvalSymlinks(dev)
+	if err != nil {
+		return
+	}
+	// The tty is a child of a USB interface, which is a child of the USB device.
+	for ; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if n, ok := readSysfsHex(dir, "bInterfaceNumber"); ok {
+			info.Interface = int(n)
+		}
+		vid, ok := readSysfsHex(dir, "idVendor")
+		if !ok {
+			continue
+		}
+		info.IsUSB = true
+		info.VID = vid
+		info.PID, _ = readSysfsHex(dir, "idProduct")
+		info.SerialNumber, _ = readSysfs(dir, "serial")
+		info.Manufacturer, _ = readSysfs(dir, "manufacturer")
+		info.Product, _ = readSysfs(dir, "product")
+		return
+	}
+}
+
+// readSysfs returns the contents of the sysfs attribute dir/name.
+func readSysfs(dir, name string) (string, bool) {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
+
+// readSysfsHex returns the value of the sysfs attribute dir/name, which holds a 16-bit hex number.
+func readSysfsHex(dir, name string) (uint16, bool) {
+	s, ok := readSysfs(dir, name)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(v), true
+}
@@ -0,0 +1,33 @@
+package serial_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+func TestOpenByIDContext(t *testing.T) {
+	// No device has these IDs, so OpenByIDContext waits until ctx is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := serial.OpenByIDContext(ctx, 0xffff, 0xfffe, "", serial.Config{BaudRate: 115200, WaitForDevice: true})
+	switch runtime.GOOS {
+	case "linux", "windows":
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("OpenByIDContext: %v, want context.DeadlineExceeded", err)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("OpenByIDContext returned %v after the end of its context", d)
+		}
+	default:
+		// The ports of the USB devices are not known, so the wait would never end.
+		if !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("OpenByIDContext: %v, want errors.ErrUnsupported", err)
+		}
+	}
+}
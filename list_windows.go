@@ -0,0 +1,228 @@
+package serial
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// listsUSB is true, as the USB details of the ports are read from SetupAPI.
+const listsUSB = true
+
+var (
+	modadvapi32 = syscall.NewLazyDLL("advapi32.dll")
+	modsetupapi = syscall.NewLazyDLL("setupapi.dll")
+
+	procRegEnumValueW = modadvapi32.NewProc("RegEnumValueW")
+
+	procSetupDiGetClassDevsW              = modsetupapi.NewProc("SetupDiGetClassDevsW")
+	procSetupDiEnumDeviceInfo             = modsetupapi.NewProc("SetupDiEnumDeviceInfo")
+	procSetupDiGetDeviceInstanceIdW       = modsetupapi.NewProc("SetupDiGetDeviceInstanceIdW")
+	procSetupDiGetDeviceRegistryPropertyW = modsetupapi.NewProc("SetupDiGetDeviceRegistryPropertyW")
+	procSetupDiOpenDevRegKey              = modsetupapi.NewProc("SetupDiOpenDevRegKey")
+	procSetupDiDestroyDeviceInfoList      = modsetupapi.NewProc("SetupDiDestroyDeviceInfoList")
+)
+
+// guidDevClassPorts is GUID_DEVCLASS_PORTS, the setup class of COM and LPT ports.
+var guidDevClassPorts = syscall.GUID{
+	Data1: 0x4d36e978, Data2: 0xe325, Data3: 0x11ce,
+	Data4: [8]byte{0xbf, 0xc1, 0x08, 0x00, 0x2b, 0xe1, 0x03, 0x18},
+}
+
+const (
+	digcfPresent = 0x2
+
+	dicsFlagGlobal = 1
+	diregDev       = 1
+
+	spdrpDeviceDesc = 0x0
+	spdrpMfg        = 0xB
+	spdrpService    = 0x4
+)
+
+// spDevinfoData is the SP_DEVINFO_DATA structure of SetupAPI.
+type spDevinfoData struct {
+	cbSize    uint32
+	ClassGuid syscall.GUID
+	DevInst   uint32
+	Reserved  uintptr
+}
+
+func lookupPort(name string) (PortInfo, error) {
+	ports, err := listPorts()
+	if err != nil {
+		return PortInfo{}, err
+	}
+	return findPort(ports, strings.TrimPrefix(name, `\\.\`), strings.EqualFold)
+}
+
+func listPorts() ([]PortInfo, error) {
+	// SERIALCOMM lists every COM port, including the ones without a PnP driver.
+	names, err := serialCommNames()
+	if err != nil {
+		return nil, err
+	}
+	details := setupAPIPorts()
+	ports := make([]PortInfo, 0, len(names))
+	for _, name := range names {
+		info, ok := details[name]
+		if !ok {
+			info = PortInfo{Name: name}
+		}
+		ports = append(ports, info)
+	}
+	return ports, nil
+}
+
+// serialCommNames returns the names of the COM ports from HKLM\HARDWARE\DEVICEMAP\SERIALCOMM.
+func serialCommNames() ([]string, error) {
+	var key syscall.Handle
+	path, _ := syscall.UTF16PtrFromString(`HARDWARE\DEVICEMAP\SERIALCOMM`)
+	if err := syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, path, 0, syscall.KEY_READ, &key); err != nil {
+		if err == syscall.ERROR_FILE_NOT_FOUND {
+			// The key only exists when there is at least one port.
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer syscall.RegCloseKey(key)
+
+	var count, maxNameLen, maxValueLen uint32
+	if err := syscall.RegQueryInfoKey(key, nil, nil, nil, nil, nil, nil, &count, &maxNameLen, &maxValueLen, nil, nil); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, count)
+	for i := uint32(0); i < count; i++ {
+		name := make([]uint16, maxNameLen+1)
+		value := make([]uint16, maxValueLen/2+1)
+		nameLen := uint32(len(name))
+		valueLen := uint32(len(value) * 2)
+		r, _, _ := procRegEnumValueW.Call(uintptr(key), uintptr(i),
+			uintptr(unsafe.Pointer(&name[0])), uintptr(unsafe.Pointer(&nameLen)), 0, 0,
+			uintptr(unsafe.Pointer(&value[0])), uintptr(unsafe.Pointer(&valueLen)))
+		if r != 0 {
+			return nil, syscall.Errno(r)
+		}
+		names = append(names, syscall.UTF16ToString(value))
+	}
+	return names, nil
+}
+
+// setupAPIPorts returns the details of the present COM ports known to SetupAPI, keyed by port name.
+func setupAPIPorts() map[string]PortInfo {
+	ports := make(map[string]PortInfo)
+	devs, _, _ := procSetupDiGetClassDevsW.Call(uintptr(unsafe.Pointer(&guidDevClassPorts)), 0, 0, digcfPresent)
+	if syscall.Handle(devs) == syscall.InvalidHandle {
+		return ports
+	}
+	defer procSetupDiDestroyDeviceInfoList.Call(devs)
+
+	for i := 0; ; i++ {
+		var data spDevinfoData
+		data.cbSize = uint32(unsafe.Sizeof(data))
+		if r, _, _ := procSetupDiEnumDeviceInfo.Call(devs, uintptr(i), uintptr(unsafe.Pointer(&data))); r == 0 {
+			break
+		}
+		name := devicePortName(devs, &data)
+		if !strings.HasPrefix(name, "COM") {
+			// Skip LPT ports, which share the setup class.
+			continue
+		}
+		info := PortInfo{Name: name}
+		parseInstanceID(&info, deviceInstanceID(devs, &data))
+		info.Driver = deviceProperty(devs, &data, spdrpService)
+		if info.IsUSB {
+			info.Manufacturer = deviceProperty(devs, &data, spdrpMfg)
+			info.Product = deviceProperty(devs, &data, spdrpDeviceDesc)
+		}
+		ports[name] = info
+	}
+	return ports
+}
+
+// devicePortName returns the PortName value of the device registry key.
+func devicePortName(devs uintptr, data *spDevinfoData) string {
+	r, _, _ := procSetupDiOpenDevRegKey.Call(devs, uintptr(unsafe.Pointer(data)),
+		dicsFlagGlobal, 0, diregDev, syscall.KEY_READ)
+	key := syscall.Handle(r)
+	if key == syscall.InvalidHandle {
+		return ""
+	}
+	defer syscall.RegCloseKey(key)
+
+	var buf [256]uint16
+	n := uint32(len(buf) * 2)
+	valueName, _ := syscall.UTF16PtrFromString("PortName")
+	if err := syscall.RegQueryValueEx(key, valueName, nil, nil, (*byte)(unsafe.Pointer(&buf[0])), &n); err != nil {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:])
+}
+
+// deviceInstanceID returns the device instance ID, like USB\VID_0403&PID_6001\A600XYZ.
+func deviceInstanceID(devs uintptr, data *spDevinfoData) string {
+	var buf [512]uint16
+	r, _, _ := procSetupDiGetDeviceInstanceIdW.Call(devs, uintptr(unsafe.Pointer(data)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+	if r == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:])
+}
+
+// deviceProperty returns a string registry property of the device.
+func deviceProperty(devs uintptr, data *spDevinfoData, property uint32) string {
+	var buf [512]uint16
+	r, _, _ := procSetupDiGetDeviceRegistryPropertyW.Call(devs, uintptr(unsafe.Pointer(data)),
+		uintptr(property), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)*2), 0)
+	if r == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:])
+}
+
+// parseInstanceID fills the USB fields of info from a device instance ID.
+// USB devices look like USB\VID_0403&PID_6001\A600XYZ, and the ports of
+// the FTDI driver like FTDIBUS\VID_0403+PID_6001+A600XYZA\0000.
+func parseInstanceID(info *PortInfo, id string) {
+	parts := strings.Split(strings.ToUpper(id), `\`)
+	if len(parts) < 3 {
+		return
+	}
+	var fields []string
+	switch parts[0] {
+	case "USB":
+		fields = strings.Split(parts[1], "&")
+		// Composite devices get a generated ID, which contains '&', instead of the serial number.
+		if !strings.Contains(parts[2], "&") {
+			info.SerialNumber = parts[2]
+		}
+	case "FTDIBUS":
+		fields = strings.Split(parts[1], "+")
+		if len(fields) > 2 {
+			// The driver appends the port letter to the serial number.
+			info.SerialNumber = strings.TrimSuffix(fields[2], "A")
+		}
+	default:
+		return
+	}
+	for _, f := range fields {
+		if strings.HasPrefix(f, "VID_") {
+			if v, err := strconv.ParseUint(f[4:], 16, 16); err == nil {
+				info.VID = uint16(v)
+				info.IsUSB = true
+			}
+		}
+		if strings.HasPrefix(f, "PID_") {
+			if v, err := strconv.ParseUint(f[4:], 16, 16); err == nil {
+				info.PID = uint16(v)
+			}
+		}
+		if strings.HasPrefix(f, "MI_") {
+			if v, err := strconv.ParseUint(f[3:], 16, 8); err == nil {
+				info.Interface = int(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// lockPort creates the UUCP style lock file LCK..<device> of the port in dir,
+// which holds the PID of the process in the HDB UUCP format. A lock file left
+// by a process which has exited is replaced. It returns a function removing the lock file.
+func lockPort(dir, name string) (unlock func(), err error) {
+	dev := name
+	if resolved, err := filepath.EvalSymlinks(name); err == nil {
+		// Lock /dev/ttyUSB0 when opened as /dev/serial/by-id/..., like other programs do.
+		dev = resolved
+	}
+	path := filepath.Join(dir, "LCK.."+filepath.Base(dev))
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%10d\n", os.Getpid())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return sync.OnceFunc(func() { os.Remove(path) }), nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if pid, ok := readLockPID(path); ok && processExists(pid) {
+			return nil, fmt.Errorf("%w: locked by process %d with %s", ErrPortBusy, pid, path)
+		}
+		// The lock is stale.
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: failed to lock with %s", ErrPortBusy, path)
+}
+
+// readLockPID returns the PID stored in a lock file, either in the HDB UUCP (ASCII)
+// or in the old binary format.
+func readLockPID(path string) (int, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+		return pid, pid > 0
+	}
+	if len(b) == 4 {
+		pid := int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24
+		return pid, pid > 0
+	}
+	return 0, false
+}
+
+// processExists reports whether the process with the given PID is running.
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,119 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLoopbackMismatch is returned by Loopback when the pattern is not echoed back as it was sent.
+var ErrLoopbackMismatch = errors.New("serial: loopback mismatch")
+
+// loopbackMargin is added to the transmission time of the pattern, for the default timeout of Loopback.
+const loopbackMargin = time.Second
+
+// LoopbackResult is the outcome of Loopback.
+type LoopbackResult struct {
+	Sent       int // the bytes of the pattern written
+	Received   int // the bytes echoed back
+	Mismatches int // the echoed bytes which differ from the pattern
+
+	// Latency is the time from the start of the Write to the first echoed byte,
+	// and Duration to the last one.
+	Latency  time.Duration
+	Duration time.Duration
+
+	// The errors counted by the driver during the test, see Stats.
+	FrameErrors    uint64
+	ParityErrors   uint64
+	Overruns       uint64
+	BufferOverruns uint64
+}
+
+// Loopback writes pattern to p, and checks that it is echoed back, like by a cable or an adapter
+// with TX and RX jumpered, or by an RS-485 transceiver receiving while sending (RS485Config.RxDuringTx).
+// The pending input is discarded first. timeout limits the whole test; zero means the transmission time
+// of the pattern at the baud rate of the port, plus a second. Loopback uses the deadlines of the port,
+// and clears them before returning.
+//
+// If the echo is short or differs from the pattern, the result comes with an error wrapping ErrLoopbackMismatch.
+func Loopback(p Port, pattern []byte, timeout time.Duration) (LoopbackResult, error) {
+	var r LoopbackResult
+	cfg := p.Config()
+	if timeout <= 0 {
+		timeout = charTime(cfg, cfg.BaudRate)*time.Duration(len(pattern)) + loopbackMargin
+	}
+	before, err := p.Stats()
+	if err != nil {
+		return r, err
+	}
+	if err := p.ResetInput(); err != nil {
+		return r, err
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	if err := p.SetReadDeadline(deadline); err != nil {
+		return r, err
+	}
+	defer p.SetReadDeadline(time.Time{})
+	if err := p.SetWriteDeadline(deadline); err != nil {
+		return r, err
+	}
+	defer p.SetWriteDeadline(time.Time{})
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		r.Sent, err = WriteAll(p, pattern)
+		written <- err
+	}()
+
+	buf := make([]byte, len(pattern))
+	n := 0
+	var readErr error
+	for n < len(buf) {
+		m, err := p.Read(buf[n:])
+		if m > 0 {
+			if n == 0 {
+				r.Latency = time.Since(start)
+			}
+			n += m
+			r.Duration = time.Since(start)
+		}
+		if err != nil && n < len(buf) {
+			timedOut := errors.Is(err, os.ErrDeadlineExceeded)
+			if timedOut && time.Now().Before(deadline) {
+				// Config.ReadTimeout of the port ended the Read first.
+				continue
+			}
+			if !timedOut {
+				readErr = err
+			}
+			break
+		}
+	}
+	writeErr := <-written
+	r.Received = n
+	for i := range buf[:n] {
+		if buf[i] != pattern[i] {
+			r.Mismatches++
+		}
+	}
+	if after, err := p.Stats(); err == nil {
+		r.FrameErrors = after.FrameErrors - before.FrameErrors
+		r.ParityErrors = after.ParityErrors - before.ParityErrors
+		r.Overruns = after.Overruns - before.Overruns
+		r.BufferOverruns = after.BufferOverruns - before.BufferOverruns
+	}
+
+	switch {
+	case readErr != nil:
+		return r, readErr
+	case writeErr != nil && !errors.Is(writeErr, os.ErrDeadlineExceeded):
+		return r, writeErr
+	case r.Received < len(pattern) || r.Mismatches > 0:
+		return r, fmt.Errorf("%w: %d of %d bytes echoed in %v, %d differ", ErrLoopbackMismatch, r.Received, len(pattern), timeout, r.Mismatches)
+	}
+	return r, nil
+}
@@ -0,0 +1,96 @@
+package serial
+
+import "io"
+
+// CharError is the kind of error of a character received with Config.MarkErrors.
+type CharError int
+
+const (
+	// CharOK is a character received correctly.
+	CharOK CharError = iota
+	// CharInvalid is a character received with a parity or a framing error,
+	// which the system does not tell apart.
+	CharInvalid
+	// CharBreak is a break condition of the line.
+	CharBreak
+)
+
+// Char is a character read by MarkedReader.
+type Char struct {
+	Value byte // the received character, zero for a break
+	Err   CharError
+}
+
+// markedBufferSize is the size of the input read by MarkedReader at once.
+const markedBufferSize = 256
+
+// MarkedReader reads the input of a port opened with Config.MarkErrors, where the system
+// marks the characters received with an error and the breaks: it decodes the marks,
+// which are the sequences \xff\x00 followed by the character, or by \x00 for a break,
+// and \xff\xff for the character \xff itself.
+type MarkedReader struct {
+	r     io.Reader
+	buf   []byte
+	chars []Char // decoded, but not returned yet
+	err   error  // returned after chars
+	state int    // the length of the mark read so far
+}
+
+// NewMarkedReader returns a MarkedReader which reads the marked input from r.
+func NewMarkedReader(r io.Reader) *MarkedReader {
+	return &MarkedReader{r: r, buf: make([]byte, markedBufferSize)}
+}
+
+// ReadChars reads up to len(chars) characters into chars, along with their errors,
+// and returns their number. Like Read, it waits until at least one character is available.
+func (m *MarkedReader) ReadChars(chars []Char) (int, error) {
+	if len(chars) == 0 {
+		return 0, nil
+	}
+	for len(m.chars) == 0 && m.err == nil {
+		n, err := m.r.Read(m.buf)
+		m.decode(m.buf[:n])
+		m.err = err
+	}
+	n := copy(chars, m.chars)
+	m.chars = m.chars[n:]
+	if len(m.chars) > 0 {
+		return n, nil
+	}
+	err := m.err
+	m.err = nil
+	return n, err
+}
+
+// decode appends the characters of the input to chars.
+func (m *MarkedReader) decode(input []byte) {
+	for _, b := range input {
+		switch m.state {
+		case 0:
+			if b == 0xff {
+				m.state = 1
+				continue
+			}
+			m.chars = append(m.chars, Char{Value: b})
+		case 1:
+			switch b {
+			case 0xff:
+				m.chars = append(m.chars, Char{Value: 0xff})
+			case 0x00:
+				m.state = 2
+				continue
+			default:
+				// Not a mark, which the system does not produce.
+				m.chars = append(m.chars, Char{Value: 0xff}, Char{Value: b})
+			}
+			m.state = 0
+		case 2:
+			if b == 0 {
+				m.chars = append(m.chars, Char{Err: CharBreak})
+			} else {
+				m.chars = append(m.chars, Char{Value: b, Err: CharInvalid})
+			}
+			m.state = 0
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package serial
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Metrics receives the measurements of the ports opened with Config.Metrics, like to monitor
+// the links of a gateway; package metrics collects them, and exports them to Prometheus and expvar.
+// The ports are identified by the name they were opened with.
+// The methods are called concurrently, by all the ports sharing the Metrics, and must not block.
+type Metrics interface {
+	// PortOpened and PortClosed are called when the port is opened and closed.
+	PortOpened(name string)
+	PortClosed(name string)
+
+	// Reconnected is called when a ReconnectingPort has reopened its device,
+	// after the PortOpened of the new connection.
+	Reconnected(name string)
+
+	// BytesRead and BytesWritten are called after every Read and Write which transferred any data.
+	BytesRead(name string, n int)
+	BytesWritten(name string, n int)
+
+	// ReadLatency is called after every Read which returned data, with how long it waited for it.
+	ReadLatency(name string, d time.Duration)
+
+	// Error is called when a Read or a Write fails, op telling which, "read" or "write".
+	// The timeouts and the end of the input are not errors.
+	Error(name string, op string, err error)
+}
+
+// metered returns p, which reports its measurements to m, unless it is nil.
+func metered(p Port, name string, m Metrics) Port {
+	if m == nil {
+		return p
+	}
+	m.PortOpened(name)
+	return &meteredPort{Port: p, name: name, m: m}
+}
+
+// meteredPort is a port which reports its measurements to a Metrics.
+type meteredPort struct {
+	Port
+	name  string
+	m     Metrics
+	close sync.Once
+}
+
+// Read implements io.Reader
+func (p *meteredPort) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port
+func (p *meteredPort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	start := time.Now()
+	n, ts, err := p.Port.ReadTimestamped(buf)
+	if n > 0 {
+		p.m.BytesRead(p.name, n)
+		p.m.ReadLatency(p.name, time.Since(start))
+	}
+	p.failed("read", err)
+	return n, ts, err
+}
+
+// Write implements io.Writer
+func (p *meteredPort) Write(buf []byte) (int, error) {
+	n, err := p.Port.Write(buf)
+	if n > 0 {
+		p.m.BytesWritten(p.name, n)
+	}
+	p.failed("write", err)
+	return n, err
+}
+
+// writeBuffers meters the buffers like a Write.
+func (p *meteredPort) writeBuffers(bufs [][]byte) (int64, error) {
+	n, err := WriteBuffers(p.Port, bufs)
+	if n > 0 {
+		p.m.BytesWritten(p.name, int(n))
+	}
+	p.failed("write", err)
+	return n, err
+}
+
+// Close implements io.Closer
+func (p *meteredPort) Close() error {
+	err := p.Port.Close()
+	p.close.Do(func() { p.m.PortClosed(p.name) })
+	return err
+}
+
+// failed reports err, unless it is not an error for Metrics.
+func (p *meteredPort) failed(op string, err error) {
+	if err == nil || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, os.ErrClosed) || err == io.EOF {
+		return
+	}
+	p.m.Error(p.name, op, err)
+}
+
+func (p *meteredPort) unwrap() Port {
+	return p.Port
+}
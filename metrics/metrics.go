@@ -0,0 +1,225 @@
+// Package metrics collects the measurements of serial ports, through serial.Config.Metrics,
+// and exports them in the text format of Prometheus, or with expvar:
+//
+//	c := metrics.NewCollector()
+//	http.Handle("/metrics", c)
+//	expvar.Publish("serial", c)
+//	p, err := serial.OpenWithConfig("/dev/ttyUSB0", serial.Config{BaudRate: 115200, Metrics: c})
+//
+// The Prometheus format is written by the package itself, so it does not depend on a client library.
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the buckets of the read latency histogram, unless configured otherwise.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Port holds the measurements of a port.
+type Port struct {
+	Open         int    // the connections open, 0 or 1 unless the name is opened more than once
+	Opens        uint64 // the times the port was opened
+	Reconnects   uint64
+	BytesRead    uint64
+	BytesWritten uint64
+	ReadErrors   uint64
+	WriteErrors  uint64
+	ReadLatency  Histogram
+}
+
+// Histogram counts the observations in buckets.
+type Histogram struct {
+	Buckets []time.Duration // the upper bounds of the buckets
+	Counts  []uint64        // the observations in each bucket, not larger than its bound, nor than the previous one
+	Count   uint64          // the observations, the ones larger than the last bound included
+	Sum     time.Duration   // the sum of the observations
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })
+	if i < len(h.Counts) {
+		h.Counts[i]++
+	}
+	h.Count++
+	h.Sum += d
+}
+
+// Collector collects the measurements of the ports. It implements serial.Metrics,
+// http.Handler, which serves them to Prometheus, and expvar.Var.
+type Collector struct {
+	// LatencyBuckets are the buckets of the read latency histogram, in increasing order.
+	// Nil means DefaultLatencyBuckets. They must not be changed once the Collector is used.
+	LatencyBuckets []time.Duration
+
+	mu    sync.Mutex
+	ports map[string]*Port
+}
+
+var _ serial.Metrics = (*Collector)(nil)
+
+// NewCollector returns an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// port returns the measurements of the port name. Must be called with mu held.
+func (c *Collector) port(name string) *Port {
+	p := c.ports[name]
+	if p == nil {
+		if c.ports == nil {
+			c.ports = make(map[string]*Port)
+		}
+		buckets := c.LatencyBuckets
+		if buckets == nil {
+			buckets = DefaultLatencyBuckets
+		}
+		p = &Port{ReadLatency: Histogram{Buckets: buckets, Counts: make([]uint64, len(buckets))}}
+		c.ports[name] = p
+	}
+	return p
+}
+
+func (c *Collector) update(name string, fn func(p *Port)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(c.port(name))
+}
+
+// PortOpened implements serial.Metrics
+func (c *Collector) PortOpened(name string) {
+	c.update(name, func(p *Port) { p.Open++; p.Opens++ })
+}
+
+// PortClosed implements serial.Metrics
+func (c *Collector) PortClosed(name string) {
+	c.update(name, func(p *Port) { p.Open-- })
+}
+
+// Reconnected implements serial.Metrics
+func (c *Collector) Reconnected(name string) {
+	c.update(name, func(p *Port) { p.Reconnects++ })
+}
+
+// BytesRead implements serial.Metrics
+func (c *Collector) BytesRead(name string, n int) {
+	c.update(name, func(p *Port) { p.BytesRead += uint64(n) })
+}
+
+// BytesWritten implements serial.Metrics
+func (c *Collector) BytesWritten(name string, n int) {
+	c.update(name, func(p *Port) { p.BytesWritten += uint64(n) })
+}
+
+// ReadLatency implements serial.Metrics
+func (c *Collector) ReadLatency(name string, d time.Duration) {
+	c.update(name, func(p *Port) { p.ReadLatency.observe(d) })
+}
+
+// Error implements serial.Metrics
+func (c *Collector) Error(name string, op string, err error) {
+	c.update(name, func(p *Port) {
+		if op == "write" {
+			p.WriteErrors++
+		} else {
+			p.ReadErrors++
+		}
+	})
+}
+
+// Snapshot returns a copy of the measurements, by port name.
+func (c *Collector) Snapshot() map[string]Port {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := make(map[string]Port, len(c.ports))
+	for name, p := range c.ports {
+		cp := *p
+		cp.ReadLatency.Counts = append([]uint64(nil), p.ReadLatency.Counts...)
+		s[name] = cp
+	}
+	return s
+}
+
+// String implements expvar.Var: the snapshot in JSON, with the durations in nanoseconds.
+func (c *Collector) String() string {
+	b, err := json.Marshal(c.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// ServeHTTP implements http.Handler: it serves the measurements in the text format of Prometheus.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WritePrometheus(w)
+}
+
+// WritePrometheus writes the measurements to w in the text format of Prometheus, labeled with the port names.
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	snap := c.Snapshot()
+	names := make([]string, 0, len(snap))
+	for name := range snap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metric := func(name, typ, help string, value func(p Port) uint64) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, n := range names {
+			fmt.Fprintf(b, "%s{port=%s} %d\n", name, quote(n), value(snap[n]))
+		}
+	}
+	metric("serial_port_open", "gauge", "Connections open to the port.", func(p Port) uint64 { return uint64(max(p.Open, 0)) })
+	metric("serial_port_opens_total", "counter", "Times the port was opened.", func(p Port) uint64 { return p.Opens })
+	metric("serial_port_reconnects_total", "counter", "Times the port was reopened after a disconnection.", func(p Port) uint64 { return p.Reconnects })
+	metric("serial_read_bytes_total", "counter", "Bytes read from the port.", func(p Port) uint64 { return p.BytesRead })
+	metric("serial_written_bytes_total", "counter", "Bytes written to the port.", func(p Port) uint64 { return p.BytesWritten })
+
+	fmt.Fprintf(b, "# HELP serial_errors_total Failed reads and writes.\n# TYPE serial_errors_total counter\n")
+	for _, n := range names {
+		fmt.Fprintf(b, "serial_errors_total{port=%s,op=\"read\"} %d\n", quote(n), snap[n].ReadErrors)
+		fmt.Fprintf(b, "serial_errors_total{port=%s,op=\"write\"} %d\n", quote(n), snap[n].WriteErrors)
+	}
+
+	fmt.Fprintf(b, "# HELP serial_read_latency_seconds Time the reads waited for the data.\n# TYPE serial_read_latency_seconds histogram\n")
+	for _, n := range names {
+		h := snap[n].ReadLatency
+		var cumulative uint64
+		for i, le := range h.Buckets {
+			cumulative += h.Counts[i]
+			fmt.Fprintf(b, "serial_read_latency_seconds_bucket{port=%s,le=\"%g\"} %d\n", quote(n), le.Seconds(), cumulative)
+		}
+		fmt.Fprintf(b, "serial_read_latency_seconds_bucket{port=%s,le=\"+Inf\"} %d\n", quote(n), h.Count)
+		fmt.Fprintf(b, "serial_read_latency_seconds_sum{port=%s} %g\n", quote(n), h.Sum.Seconds())
+		fmt.Fprintf(b, "serial_read_latency_seconds_count{port=%s} %d\n", quote(n), h.Count)
+	}
+	return b.Flush()
+}
+
+// quote returns the label value s, quoted and escaped as Prometheus expects.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,156 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+const (
+	// DefaultTimeout is the time a Client waits for the start of a response, unless configured otherwise.
+	DefaultTimeout = time.Second
+
+	// DefaultMinSilence is the shortest silence which ends a response of an unknown length.
+	// It is longer than the frame gap of Modbus at the usual rates, since USB adapters
+	// deliver the input in chunks, every few milliseconds.
+	DefaultMinSilence = 20 * time.Millisecond
+)
+
+// Client sends requests to the devices on a bus, and receives their responses.
+// It is safe for concurrent use; the requests are sent one at a time.
+type Client struct {
+	// Timeout is the time to wait for the start of a response. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	// MinSilence is the shortest silence which ends a response, if the length of the response
+	// is not known from its function. Zero means DefaultMinSilence.
+	MinSilence time.Duration
+
+	p    serial.Port
+	mu   sync.Mutex
+	last time.Time // the end of the last frame on the bus
+}
+
+// NewClient returns a client using p, which should not be read by anyone else.
+func NewClient(p serial.Port) *Client {
+	return &Client{p: p}
+}
+
+// Transact sends the request, and returns the response of the device.
+// A broadcast request, to the address 0, has no response, and Transact returns a zero Frame.
+// An exception response is returned as an *ExceptionError.
+//
+// The silence of the frame gap, derived from the configuration of the port, is kept
+// before the request. The response ends when its length is complete, or with the silence of the line.
+func (c *Client) Transact(req Frame) (Frame, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg := c.p.Config()
+	gap := FrameGap(cfg)
+	if wait := time.Until(c.last.Add(gap)); wait > 0 {
+		time.Sleep(wait)
+	}
+	if err := c.p.ResetInput(); err != nil {
+		return Frame{}, err
+	}
+	b := req.Encode()
+	if _, err := c.p.Write(b); err != nil {
+		return Frame{}, err
+	}
+	sent := time.Now().Add(CharTime(cfg) * time.Duration(len(b)))
+	c.last = sent
+	if req.Address == 0 {
+		return Frame{}, nil
+	}
+	resp, err := c.receive(sent, gap)
+	c.last = time.Now()
+	if err != nil {
+		return Frame{}, err
+	}
+	f, err := Decode(resp)
+	if err != nil {
+		return Frame{}, err
+	}
+	if f.Address != req.Address || f.Function&^0x80 != req.Function {
+		return Frame{}, fmt.Errorf("modbus: response of device %d to function %d received for device %d and function %d",
+			f.Address, f.Function, req.Address, req.Function)
+	}
+	if f.Function&0x80 != 0 {
+		code := byte(0)
+		if len(f.Data) > 0 {
+			code = f.Data[0]
+		}
+		return Frame{}, &ExceptionError{Function: req.Function, Code: code}
+	}
+	return f, nil
+}
+
+// receive reads a response, whose transmission starts after the request is sent.
+func (c *Client) receive(sent time.Time, gap time.Duration) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	silence := c.MinSilence
+	if silence <= 0 {
+		silence = DefaultMinSilence
+	}
+	silence = max(silence, gap)
+	defer c.p.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, MaxFrameLength)
+	n := 0
+	deadline := sent.Add(timeout)
+	for n < len(buf) {
+		if err := c.p.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		m, err := c.p.Read(buf[n:])
+		n += m
+		if m > 0 {
+			if want := responseLength(buf[:n]); want > 0 && n >= want {
+				return buf[:want], nil
+			}
+			deadline = time.Now().Add(silence)
+		}
+		if err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, err
+			}
+			if time.Now().Before(deadline) {
+				// Config.ReadTimeout of the port ended the Read first.
+				continue
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("modbus: no response in %v: %w", timeout, err)
+			}
+			return buf[:n], nil
+		}
+	}
+	return buf[:n], nil
+}
+
+// responseLength returns the length of the response starting with b, if it is known
+// from its function, or 0 otherwise.
+func responseLength(b []byte) int {
+	if len(b) < 2 {
+		return 0
+	}
+	switch fn := b[1]; {
+	case fn&0x80 != 0:
+		return 5
+	case fn >= 1 && fn <= 4, fn == 23:
+		// The byte count follows the function.
+		if len(b) < 3 {
+			return 0
+		}
+		return 5 + int(b[2])
+	case fn == 5, fn == 6, fn == 15, fn == 16:
+		return 8
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+// Package modbus implements the framing of Modbus RTU over a serial port,
+// and a client which exchanges requests and responses with the devices on the bus.
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jangocheng/serial"
+	"github.com/jangocheng/serial/crc"
+)
+
+// MaxFrameLength is the maximum length of an RTU frame, the address and the CRC included.
+const MaxFrameLength = 256
+
+var (
+	// ErrCRC is returned by Decode for a frame with a wrong CRC.
+	ErrCRC = errors.New("modbus: CRC mismatch")
+
+	// ErrShortFrame is returned by Decode for a frame too short to hold an address, a function and the CRC.
+	ErrShortFrame = errors.New("modbus: frame too short")
+)
+
+// Frame is a Modbus RTU frame, without its CRC.
+type Frame struct {
+	Address  byte // the address of the device, 0 for a broadcast
+	Function byte // the function code, with the bit 0x80 set for an exception response
+	Data     []byte
+}
+
+// Encode returns the frame on the wire, with its CRC.
+func (f Frame) Encode() []byte {
+	b := make([]byte, 0, len(f.Data)+4)
+	b = append(b, f.Address, f.Function)
+	b = append(b, f.Data...)
+	return crc.Modbus.Append(b)
+}
+
+// Decode parses a frame received from the wire, and checks its CRC.
+// The data of the returned frame refers to b.
+func Decode(b []byte) (Frame, error) {
+	if len(b) < 4 {
+		return Frame{}, ErrShortFrame
+	}
+	n := len(b) - 2
+	if crc.Modbus.Sum(b[:n]) != crc.Modbus.Stored(b) {
+		return Frame{}, ErrCRC
+	}
+	return Frame{Address: b[0], Function: b[1], Data: b[2:n]}, nil
+}
+
+// ExceptionError is returned by Client.Transact for an exception response of a device.
+type ExceptionError struct {
+	Function byte // the function of the request
+	Code     byte // the exception code, like 2 for an illegal data address
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus: exception %d for function %d", e.Code, e.Function)
+}
+
+// CharTime returns the time to transmit one character with the configuration of a port,
+// its start, parity and stop bits included.
+func CharTime(cfg serial.Config) time.Duration {
+	if cfg.BaudRate <= 0 {
+		return 0
+	}
+	bits := 1 + 8 + 1
+	if cfg.DataBits != 0 {
+		bits = 1 + cfg.DataBits + 1
+	}
+	if cfg.Parity != serial.ParityNone {
+		bits++
+	}
+	if cfg.StopBits == serial.TwoStopBits {
+		bits++
+	}
+	return time.Duration(bits) * time.Second / time.Duration(cfg.BaudRate)
+}
+
+// FrameGap returns the silence which separates the frames, 3.5 characters with the configuration of a port.
+// Above 19200 baud, it is fixed to 1.75 ms, as the specification of Modbus over serial lines recommends.
+func FrameGap(cfg serial.Config) time.Duration {
+	if cfg.BaudRate > 19200 {
+		return 1750 * time.Microsecond
+	}
+	return CharTime(cfg) * 7 / 2
+}
@@ -0,0 +1,281 @@
+package modbus_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jangocheng/serial"
+	"github.com/jangocheng/serial/modbus"
+	"github.com/jangocheng/serial/serialtest"
+)
+
+// unhex decodes the bytes of a frame written like in the Modbus specification, "11 03 00 6B".
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The frames of the specification and of the usual Modbus references, with their CRCs.
+var frameTests = []struct {
+	frame modbus.Frame
+	wire  string
+}{
+	{modbus.Frame{Address: 0x11, Function: 3, Data: unhex("00 6B 00 03")}, "11 03 00 6B 00 03 76 87"},
+	{modbus.Frame{Address: 0x11, Function: 3, Data: unhex("06 AE 41 56 52 43 40")}, "11 03 06 AE 41 56 52 43 40 49 AD"},
+	{modbus.Frame{Address: 0x11, Function: 1, Data: unhex("00 13 00 25")}, "11 01 00 13 00 25 0E 84"},
+	{modbus.Frame{Address: 0x11, Function: 1, Data: unhex("05 CD 6B B2 0E 1B")}, "11 01 05 CD 6B B2 0E 1B 45 E6"},
+	{modbus.Frame{Address: 0x11, Function: 5, Data: unhex("00 AC FF 00")}, "11 05 00 AC FF 00 4E 8B"},
+	{modbus.Frame{Address: 0x11, Function: 6, Data: unhex("00 01 00 03")}, "11 06 00 01 00 03 9A 9B"},
+	{modbus.Frame{Address: 0x11, Function: 0x83, Data: unhex("02")}, "11 83 02 C1 34"},
+	{modbus.Frame{Address: 0x11, Function: 0x11}, "11 11 CD EC"},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, tt := range frameTests {
+		want := unhex(tt.wire)
+		if got := tt.frame.Encode(); !bytes.Equal(got, want) {
+			t.Errorf("Encode(%+v) = % X, want % X", tt.frame, got, want)
+		}
+		f, err := modbus.Decode(want)
+		if err != nil {
+			t.Errorf("Decode(% X): %v", want, err)
+			continue
+		}
+		if f.Address != tt.frame.Address || f.Function != tt.frame.Function || !bytes.Equal(f.Data, tt.frame.Data) {
+			t.Errorf("Decode(% X) = %+v, want %+v", want, f, tt.frame)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		wire string
+		err  error
+	}{
+		{"", modbus.ErrShortFrame},
+		{"11 03 76", modbus.ErrShortFrame},
+		{"11 03 00 6B 00 03 76 88", modbus.ErrCRC}, // the CRC corrupted
+		{"11 03 00 6B 00 03 87 76", modbus.ErrCRC}, // the CRC sent big-endian
+		{"11 03 00 6A 00 03 76 87", modbus.ErrCRC}, // the data corrupted
+		{"11 83 02 C1", modbus.ErrCRC},             // the exception response truncated
+	} {
+		if _, err := modbus.Decode(unhex(tt.wire)); err != tt.err {
+			t.Errorf("Decode(%s): %v, want %v", tt.wire, err, tt.err)
+		}
+	}
+}
+
+func TestTransact(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		req       modbus.Frame
+		wire      string // the request on the wire
+		resp      string // the response of the device
+		want      modbus.Frame
+		err       error // the error wrapped by the one of Transact
+		exception byte  // the exception code of the error of Transact
+	}{{
+		name: "read holding registers",
+		req:  modbus.Frame{Address: 0x11, Function: 3, Data: unhex("00 6B 00 03")},
+		wire: "11 03 00 6B 00 03 76 87",
+		resp: "11 03 06 AE 41 56 52 43 40 49 AD",
+		want: modbus.Frame{Address: 0x11, Function: 3, Data: unhex("06 AE 41 56 52 43 40")},
+	}, {
+		name: "read coils",
+		req:  modbus.Frame{Address: 0x11, Function: 1, Data: unhex("00 13 00 25")},
+		wire: "11 01 00 13 00 25 0E 84",
+		resp: "11 01 05 CD 6B B2 0E 1B 45 E6",
+		want: modbus.Frame{Address: 0x11, Function: 1, Data: unhex("05 CD 6B B2 0E 1B")},
+	}, {
+		name: "write single coil",
+		req:  modbus.Frame{Address: 0x11, Function: 5, Data: unhex("00 AC FF 00")},
+		wire: "11 05 00 AC FF 00 4E 8B",
+		resp: "11 05 00 AC FF 00 4E 8B",
+		want: modbus.Frame{Address: 0x11, Function: 5, Data: unhex("00 AC FF 00")},
+	}, {
+		name: "write multiple registers",
+		req:  modbus.Frame{Address: 0x11, Function: 16, Data: unhex("00 01 00 02 04 00 0A 01 02")},
+		wire: "11 10 00 01 00 02 04 00 0A 01 02 C6 F0",
+		resp: "11 10 00 01 00 02 12 98",
+		want: modbus.Frame{Address: 0x11, Function: 16, Data: unhex("00 01 00 02")},
+	}, {
+		// The length of the response is not known from its function: the silence ends it.
+		name: "report server ID",
+		req:  modbus.Frame{Address: 0x11, Function: 0x11},
+		wire: "11 11 CD EC",
+		resp: "11 11 03 01 02 FF EF FD",
+		want: modbus.Frame{Address: 0x11, Function: 0x11, Data: unhex("03 01 02 FF")},
+	}, {
+		name:      "exception",
+		req:       modbus.Frame{Address: 0x11, Function: 3, Data: unhex("00 6B 00 03")},
+		wire:      "11 03 00 6B 00 03 76 87",
+		resp:      "11 83 02 C1 34",
+		exception: 2,
+	}, {
+		name: "CRC mismatch",
+		req:  modbus.Frame{Address: 0x11, Function: 3, Data: unhex("00 6B 00 03")},
+		wire: "11 03 00 6B 00 03 76 87",
+		resp: "11 03 06 AE 41 56 52 43 41 49 AD",
+		err:  modbus.ErrCRC,
+	}, {
+		name: "exception with a wrong CRC",
+		req:  modbus.Frame{Address: 0x11, Function: 3, Data: unhex("00 6B 00 03")},
+		wire: "11 03 00 6B 00 03 76 87",
+		resp: "11 83 02 C1 35",
+		err:  modbus.ErrCRC,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, dev := serialtest.Pipe(serialtest.Config{BaudRate: 115200})
+			defer p.Close()
+			defer dev.Close()
+			errc := make(chan error, 1)
+			go func() {
+				req, _, err := readFrame(dev, len(unhex(tt.wire)))
+				if err == nil && !bytes.Equal(req, unhex(tt.wire)) {
+					t.Errorf("request % X, want %s", req, tt.wire)
+				}
+				if err == nil {
+					_, err = dev.Write(unhex(tt.resp))
+				}
+				errc <- err
+			}()
+
+			c := modbus.NewClient(p)
+			c.Timeout = 5 * time.Second
+			f, err := c.Transact(tt.req)
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			var exc *modbus.ExceptionError
+			switch {
+			case tt.exception != 0:
+				if !errors.As(err, &exc) || exc.Function != tt.req.Function || exc.Code != tt.exception {
+					t.Errorf("Transact: %v, want the exception %d for function %d", err, tt.exception, tt.req.Function)
+				}
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Transact: %v, want %v", err, tt.err)
+				}
+			case err != nil:
+				t.Errorf("Transact: %v", err)
+			case f.Address != tt.want.Address || f.Function != tt.want.Function || !bytes.Equal(f.Data, tt.want.Data):
+				t.Errorf("Transact = %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransactNoResponse(t *testing.T) {
+	p, dev := serialtest.Pipe(serialtest.Config{BaudRate: 115200})
+	defer p.Close()
+	defer dev.Close()
+	c := modbus.NewClient(p)
+	c.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err := c.Transact(modbus.Frame{Address: 0x11, Function: 3, Data: unhex("00 6B 00 03")})
+	if err == nil || time.Since(start) < c.Timeout {
+		t.Errorf("Transact without a response: %v after %v, want an error after %v", err, time.Since(start), c.Timeout)
+	}
+}
+
+func TestFrameGap(t *testing.T) {
+	for _, tt := range []struct {
+		cfg      serial.Config
+		charTime time.Duration
+		gap      time.Duration
+	}{
+		{serial.Config{BaudRate: 9600}, 1041666, 3645831},
+		{serial.Config{BaudRate: 9600, DataBits: 8, Parity: serial.ParityEven}, 1145833, 4010415},
+		{serial.Config{BaudRate: 9600, DataBits: 7, Parity: serial.ParityEven}, 1041666, 3645831},
+		{serial.Config{BaudRate: 19200, StopBits: serial.TwoStopBits}, 572916, 2005206},
+		// Above 19200 baud, the gap is fixed.
+		{serial.Config{BaudRate: 38400}, 260416, 1750 * time.Microsecond},
+		{serial.Config{BaudRate: 115200}, 86805, 1750 * time.Microsecond},
+		{serial.Config{}, 0, 0},
+	} {
+		if got := modbus.CharTime(tt.cfg); got != tt.charTime {
+			t.Errorf("CharTime(%+v) = %v, want %v", tt.cfg, got, tt.charTime)
+		}
+		if got := modbus.FrameGap(tt.cfg); got != tt.gap {
+			t.Errorf("FrameGap(%+v) = %v, want %v", tt.cfg, got, tt.gap)
+		}
+	}
+}
+
+// TestTransactFrameGap checks the silence a Client keeps on the line before its requests,
+// after a response, and after a broadcast which has none.
+func TestTransactFrameGap(t *testing.T) {
+	cfg := serial.Config{BaudRate: 9600}
+	charTime, gap := modbus.CharTime(cfg), modbus.FrameGap(cfg)
+	p, dev := serialtest.Pipe(serialtest.Config{BaudRate: cfg.BaudRate})
+	defer p.Close()
+	defer dev.Close()
+
+	reqs := []struct {
+		req  modbus.Frame
+		resp string
+	}{
+		{modbus.Frame{Address: 0x11, Function: 6, Data: unhex("00 01 00 03")}, "11 06 00 01 00 03 9A 9B"},
+		{modbus.Frame{Address: 0x11, Function: 6, Data: unhex("00 01 00 03")}, "11 06 00 01 00 03 9A 9B"},
+		{modbus.Frame{Address: 0, Function: 6, Data: unhex("00 01 00 03")}, ""},
+		{modbus.Frame{Address: 0x11, Function: 6, Data: unhex("00 01 00 03")}, "11 06 00 01 00 03 9A 9B"},
+	}
+	errc := make(chan error, 1)
+	go func() {
+		var end time.Time // the end of the last frame on the line
+		for i, r := range reqs {
+			b, ts, err := readFrame(dev, 8)
+			if err != nil {
+				errc <- err
+				return
+			}
+			// ts is the arrival of the first byte, one character after the start of the frame.
+			if silence := ts.Add(-charTime).Sub(end); !end.IsZero() && silence < gap {
+				t.Errorf("request %d sent after a silence of %v, want at least %v", i, silence, gap)
+			}
+			end = ts.Add(time.Duration(len(b)-1) * charTime)
+			if r.resp != "" {
+				resp := unhex(r.resp)
+				now := time.Now()
+				if _, err := dev.Write(resp); err != nil {
+					errc <- err
+					return
+				}
+				end = now.Add(time.Duration(len(resp)) * charTime)
+			}
+		}
+		errc <- nil
+	}()
+
+	c := modbus.NewClient(p)
+	c.Timeout = 5 * time.Second
+	c.MinSilence = time.Millisecond // shorter than the gap, which then ends the responses
+	for i, r := range reqs {
+		if _, err := c.Transact(r.req); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads a frame of n bytes, and returns it with the arrival of its first byte.
+func readFrame(p serial.Port, n int) ([]byte, time.Time, error) {
+	b := make([]byte, n)
+	p.SetReadDeadline(time.Now().Add(5 * time.Second))
+	m, ts, err := p.ReadTimestamped(b)
+	if err != nil {
+		return nil, ts, err
+	}
+	_, err = io.ReadFull(p, b[m:])
+	return b, ts, err
+}
@@ -0,0 +1,203 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Mux waits for the input of many ports at once, like the lines of a gateway,
+// so that a single goroutine can serve them all.
+//
+// On Linux, the ports opened by this package are watched with an epoll instance,
+// which is waited for by the runtime poller. The other ports, like a ReconnectingPort,
+// and the ports on the other systems are watched by a goroutine each, like for Port.Events.
+// A port without a way to wait for its input, like a serialtest.Port, is watched through
+// its Events, which the Mux receives then.
+//
+// A Mux is safe for concurrent use, but Wait should be called by one goroutine at a time.
+type Mux struct {
+	muxPoller
+
+	mu      sync.Mutex
+	entries map[Port]*muxEntry
+	closed  bool
+}
+
+// muxEntry is a port added to a Mux.
+type muxEntry struct {
+	port Port
+	fd   int // the descriptor watched by the poller, or -1
+
+	// The fields below are for the ports watched by a goroutine, and guarded by Mux.mu.
+	ready  bool
+	failed bool          // the goroutine is gone with the failure of the port
+	rearm  chan struct{} // signaled by Wait, once it reported the port
+	done   chan struct{} // closed by Remove
+}
+
+// NewMux returns an empty Mux.
+func NewMux() (*Mux, error) {
+	m := &Mux{entries: make(map[Port]*muxEntry)}
+	if err := m.initPoller(); err != nil {
+		return nil, fmt.Errorf("failed to create mux: %w", err)
+	}
+	return m, nil
+}
+
+// Add adds p to the ports watched by the Mux.
+func (m *Mux) Add(p Port) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	if _, ok := m.entries[p]; ok {
+		return errors.New("serial: port already added to the mux")
+	}
+	e := &muxEntry{port: p, fd: -1}
+	polled, err := m.addPolled(e)
+	if err != nil {
+		return fmt.Errorf("failed to add port to mux: %w", err)
+	}
+	if !polled {
+		e.rearm = make(chan struct{}, 1)
+		e.done = make(chan struct{})
+		go m.watch(e)
+	}
+	m.entries[p] = e
+	return nil
+}
+
+// Remove removes p from the ports watched by the Mux. The ports should be removed before they are closed,
+// since a closed port is not reported anymore.
+func (m *Mux) Remove(p Port) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[p]
+	if !ok {
+		return errors.New("serial: port not added to the mux")
+	}
+	delete(m.entries, p)
+	if e.done != nil {
+		close(e.done)
+	}
+	if e.fd >= 0 {
+		return m.removePolled(e)
+	}
+	return nil
+}
+
+// Wait waits until some of the ports have data to read, and returns them.
+// A port is returned by every Wait until its input is read, and a failed port
+// until it is removed, so that its Read returns the error.
+//
+// Wait fails with ctx.Err() once ctx is done, and with os.ErrClosed once the Mux is closed.
+func (m *Mux) Wait(ctx context.Context) ([]Port, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.wait(ctx)
+}
+
+// Close stops watching the ports, which are left open.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	for p, e := range m.entries {
+		if e.done != nil {
+			close(e.done)
+		}
+		delete(m.entries, p)
+	}
+	return m.closePoller()
+}
+
+// watch waits for the input of a port which can not be polled, and reports it to Wait.
+func (m *Mux) watch(e *muxEntry) {
+	var events <-chan Event
+	w, ok := underlying(e.port).(dataWaiter)
+	if !ok {
+		events = e.port.Events()
+	}
+	for {
+		var err error
+		if w != nil {
+			err = w.waitData(e.done)
+		} else {
+			err = waitEvent(events, e.done)
+		}
+		m.mu.Lock()
+		select {
+		case <-e.done:
+			m.mu.Unlock()
+			return
+		default:
+		}
+		e.ready, e.failed = true, err != nil
+		m.notify()
+		m.mu.Unlock()
+		if err != nil {
+			return
+		}
+		select {
+		case <-e.rearm:
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// waitEvent waits for a DataReady event, or the failure of the port.
+func waitEvent(events <-chan Event, done <-chan struct{}) error {
+	for {
+		select {
+		case ev, ok := <-events:
+			switch {
+			case !ok || ev.Type == Closed:
+				return os.ErrClosed
+			case ev.Type == Error:
+				return ev.Err
+			case ev.Type == DataReady:
+				return nil
+			}
+		case <-done:
+			return os.ErrClosed
+		}
+	}
+}
+
+// takeWatched returns the ports reported by their goroutine, which wait again.
+// It is called with m.mu held.
+func (m *Mux) takeWatched(ready []Port) []Port {
+	for _, e := range m.entries {
+		if !e.ready {
+			continue
+		}
+		ready = append(ready, e.port)
+		if !e.failed {
+			e.ready = false
+			e.rearm <- struct{}{}
+		}
+	}
+	return ready
+}
+
+// underlying returns the port wrapped by p, like for Config.Trace or OpenContext, or p itself.
+// The wrapping ports implement unwrap, returning the port they wrap, so that the features which
+// need the port itself, like waiting for the data with Mux, see through them.
+func underlying(p Port) Port {
+	for {
+		w, ok := p.(interface{ unwrap() Port })
+		if !ok {
+			return p
+		}
+		p = w.unwrap()
+	}
+}
@@ -0,0 +1,168 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// muxEvents is the size of the batch of events received from epoll.
+const muxEvents = 64
+
+// muxPoller watches the descriptors of the ports with epoll. The epoll instance is non-blocking,
+// and waited for by the runtime poller, which reports it readable once one of the ports is.
+// The goroutines watching the other ports wake it up through a pipe, which it watches too.
+type muxPoller struct {
+	ep     *os.File
+	wake   [2]int // the blocking reads and writes of an *os.File do not suit the pipe
+	events []syscall.EpollEvent
+}
+
+func (m *Mux) initPoller() error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("epoll_create1", err)
+	}
+	if err := syscall.SetNonblock(epfd, true); err != nil {
+		syscall.Close(epfd)
+		return os.NewSyscallError("fcntl", err)
+	}
+	if err := syscall.Pipe2(m.wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		syscall.Close(epfd)
+		return os.NewSyscallError("pipe2", err)
+	}
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(m.wake[0])}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, m.wake[0], &ev); err != nil {
+		syscall.Close(epfd)
+		syscall.Close(m.wake[0])
+		syscall.Close(m.wake[1])
+		return os.NewSyscallError("epoll_ctl", err)
+	}
+	// The non-blocking descriptor is served by the runtime poller, so the deadline interrupts Wait.
+	m.ep = os.NewFile(uintptr(epfd), "epoll")
+	m.events = make([]syscall.EpollEvent, muxEvents)
+	return nil
+}
+
+// addPolled watches the descriptor of the port with epoll, if it is a port of this package.
+// The descriptor is watched level-triggered, so that the port is reported until its input is read.
+func (m *Mux) addPolled(e *muxEntry) (bool, error) {
+	p, ok := underlying(e.port).(*port)
+	if !ok {
+		return false, nil
+	}
+	err := control(p.f, func(fd uintptr) error {
+		ev := syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP, Fd: int32(fd)}
+		e.fd = int(fd)
+		return epollCtl(m.ep, syscall.EPOLL_CTL_ADD, int(fd), &ev)
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removePolled stops watching the descriptor of the port.
+func (m *Mux) removePolled(e *muxEntry) error {
+	err := epollCtl(m.ep, syscall.EPOLL_CTL_DEL, e.fd, nil)
+	if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EBADF) {
+		// The port has been closed, which removed it already.
+		return nil
+	}
+	return err
+}
+
+// notify wakes up Wait, for the ports watched by a goroutine. It is called with m.mu held.
+func (m *Mux) notify() {
+	// The pipe is drained by Wait. If it is full, Wait is woken up already.
+	syscall.Write(m.wake[1], []byte{0})
+}
+
+func (m *Mux) wait(ctx context.Context) ([]Port, error) {
+	rc, err := m.ep.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { m.ep.SetReadDeadline(time.Unix(1, 0)) })
+	defer stop()
+	defer m.ep.SetReadDeadline(time.Time{})
+
+	var ready []Port
+	var perr error
+	for {
+		// The readiness of the epoll instance is reset before the first call,
+		// so that the ports getting ready after the poll wake up the runtime poller.
+		err = rc.Read(func(epfd uintptr) bool {
+			ready, perr = m.poll(int(epfd))
+			return perr != nil || len(ready) > 0
+		})
+		switch {
+		case perr != nil:
+			return nil, perr
+		case err == nil:
+			return ready, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case m.isClosed():
+			return nil, os.ErrClosed
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			// The cancellation of the context of a previous Wait came late.
+			m.ep.SetReadDeadline(time.Time{})
+		default:
+			return nil, err
+		}
+	}
+}
+
+// poll returns the ports which are ready, without waiting.
+func (m *Mux) poll(epfd int) ([]Port, error) {
+	n, err := syscall.EpollWait(epfd, m.events, 0)
+	if err != nil && err != syscall.EINTR {
+		return nil, os.NewSyscallError("epoll_wait", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, os.ErrClosed
+	}
+	var ready []Port
+	byFd := make(map[int32]bool, n)
+	for _, ev := range m.events[:max(n, 0)] {
+		byFd[ev.Fd] = true
+	}
+	if byFd[int32(m.wake[0])] {
+		var buf [64]byte
+		for {
+			if n, err := syscall.Read(m.wake[0], buf[:]); n <= 0 || err != nil {
+				break
+			}
+		}
+	}
+	for _, e := range m.entries {
+		if e.fd >= 0 && byFd[int32(e.fd)] {
+			ready = append(ready, e.port)
+		}
+	}
+	return m.takeWatched(ready), nil
+}
+
+func (m *Mux) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+func (m *Mux) closePoller() error {
+	syscall.Close(m.wake[0])
+	syscall.Close(m.wake[1])
+	return m.ep.Close()
+}
+
+// epollCtl changes the descriptors watched by the epoll instance ep.
+func epollCtl(ep *os.File, op int, fd int, ev *syscall.EpollEvent) error {
+	return control(ep, func(epfd uintptr) error {
+		return os.NewSyscallError("epoll_ctl", syscall.EpollCtl(int(epfd), op, fd, ev))
+	})
+}
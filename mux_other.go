@@ -0,0 +1,60 @@
+//go:build !linux
+// +build !linux
+
+package serial
+
+import (
+	"context"
+	"os"
+)
+
+// muxPoller has no descriptors to poll here: all the ports are watched by a goroutine,
+// which signals changed.
+type muxPoller struct {
+	changed chan struct{} // closed and replaced when a port is ready
+}
+
+func (m *Mux) initPoller() error {
+	m.changed = make(chan struct{})
+	return nil
+}
+
+func (m *Mux) addPolled(e *muxEntry) (bool, error) {
+	return false, nil
+}
+
+func (m *Mux) removePolled(e *muxEntry) error {
+	return nil
+}
+
+// notify wakes up Wait. It is called with m.mu held.
+func (m *Mux) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *Mux) wait(ctx context.Context) ([]Port, error) {
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, os.ErrClosed
+		}
+		ready := m.takeWatched(nil)
+		changed := m.changed
+		m.mu.Unlock()
+		if len(ready) > 0 {
+			return ready, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *Mux) closePoller() error {
+	m.notify()
+	return nil
+}
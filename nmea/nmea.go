@@ -0,0 +1,134 @@
+// Package nmea reads NMEA 0183 sentences, like the ones sent by GPS receivers, from a serial port.
+package nmea
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jangocheng/serial"
+)
+
+// DefaultMaxLength is the maximum length of a sentence, unless configured otherwise.
+// NMEA 0183 limits the sentences to 82 characters, but some receivers send longer ones.
+const DefaultMaxLength = 256
+
+var (
+	// ErrChecksum is returned for a sentence whose checksum does not match.
+	ErrChecksum = errors.New("nmea: checksum mismatch")
+
+	// ErrNoChecksum is returned for a sentence without a checksum, unless Config.AllowNoChecksum is set.
+	ErrNoChecksum = errors.New("nmea: missing checksum")
+)
+
+// Sentence is a validated NMEA sentence.
+type Sentence struct {
+	// Raw is the whole sentence without the line terminator, like "$GPGGA,...*47".
+	Raw string
+
+	// Talker identifies the sender, like "GP" for GPS or "GN" for several systems.
+	// It is "P" for the proprietary sentences.
+	Talker string
+
+	// Type is the type of the sentence, like "GGA", or the rest of the address of a proprietary sentence.
+	Type string
+
+	// Fields are the fields after the address, without the checksum.
+	Fields []string
+}
+
+// Config describes how a Reader handles the input.
+type Config struct {
+	// MaxLength is the maximum length of a sentence. Zero means DefaultMaxLength.
+	MaxLength int
+
+	// AllowNoChecksum, if true, accepts the sentences without a checksum.
+	AllowNoChecksum bool
+
+	// OnNoise, if not nil, is called with the input between the sentences which is not a sentence,
+	// like the garbage received while the baud rate settles. The noise is skipped either way.
+	OnNoise func(noise []byte)
+}
+
+// Reader reads the sentences from a port.
+type Reader struct {
+	lines *serial.LineReader
+	cfg   Config
+}
+
+// NewReader returns a Reader which reads the sentences from r.
+func NewReader(r io.Reader, cfg Config) *Reader {
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = DefaultMaxLength
+	}
+	return &Reader{lines: serial.NewLineReader(r, []byte("\n"), cfg.MaxLength), cfg: cfg}
+}
+
+// ReadSentence returns the next sentence with a valid checksum.
+// The sentences failing a check, like ErrChecksum or serial.ErrLineTooLong, are returned as an error,
+// and the next call continues with the following sentence.
+func (r *Reader) ReadSentence() (Sentence, error) {
+	for {
+		line, err := r.lines.ReadLine()
+		if err != nil {
+			return Sentence{}, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		// A sentence starts with $, or ! for the encapsulated ones. The last start wins,
+		// since a sentence cut short is followed by the next one on the same line.
+		start := bytes.LastIndexAny(line, "$!")
+		if start < 0 {
+			r.noise(line)
+			continue
+		}
+		r.noise(line[:start])
+		return r.parse(string(line[start:]))
+	}
+}
+
+func (r *Reader) noise(b []byte) {
+	if len(b) > 0 && r.cfg.OnNoise != nil {
+		r.cfg.OnNoise(b)
+	}
+}
+
+// parse validates the sentence s, and splits it into its fields.
+func (r *Reader) parse(s string) (Sentence, error) {
+	body := s[1:]
+	if i := len(s) - 3; i > 0 && s[i] == '*' {
+		want, err := strconv.ParseUint(s[i+1:], 16, 8)
+		if err != nil {
+			return Sentence{}, fmt.Errorf("%w: malformed checksum in %q", ErrChecksum, s)
+		}
+		body = s[1:i]
+		if got := Checksum(body); got != byte(want) {
+			return Sentence{}, fmt.Errorf("%w: %02X computed for %q", ErrChecksum, got, s)
+		}
+	} else if !r.cfg.AllowNoChecksum {
+		return Sentence{}, fmt.Errorf("%w: %q", ErrNoChecksum, s)
+	}
+	fields := strings.Split(body, ",")
+	addr := fields[0]
+	st := Sentence{Raw: s, Fields: fields[1:]}
+	switch {
+	case strings.HasPrefix(addr, "P"):
+		st.Talker, st.Type = "P", addr[1:]
+	case len(addr) >= 3:
+		st.Talker, st.Type = addr[:2], addr[2:]
+	default:
+		return Sentence{}, fmt.Errorf("nmea: malformed address in %q", s)
+	}
+	return st, nil
+}
+
+// Checksum returns the checksum of a sentence, the XOR of the characters between $ and *.
+func Checksum(body string) byte {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return sum
+}
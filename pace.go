@@ -0,0 +1,144 @@
+package serial
+
+import (
+	"sync"
+	"time"
+)
+
+// paceInterval is the time between the chunks written by a port with Config.PaceWrites.
+const paceInterval = 10 * time.Millisecond
+
+// paced returns p, which paces its writes as configured by cfg.
+// p is opened without Config.WriteTimeout then, which paced applies too.
+func paced(p Port, cfg Config) Port {
+	if !cfg.PaceWrites {
+		return p
+	}
+	return &pacedPort{Port: p, baud: cfg.PaceBaudRate, writeTimeout: cfg.WriteTimeout, done: make(chan struct{})}
+}
+
+// pacedPort is a port which writes no faster than the characters are transmitted at a baud rate.
+type pacedPort struct {
+	Port
+	baud         int // the rate of the pacing; zero for the baud rate of the port
+	writeTimeout time.Duration
+	done         chan struct{} // closed by Close
+	doneOnce     sync.Once
+
+	mu   sync.Mutex // serializes Write
+	next time.Time  // when the data written so far is transmitted at the rate of the pacing
+
+	deadlineMu sync.Mutex
+	deadline   time.Time // set by SetWriteDeadline
+}
+
+// Write implements io.Writer
+func (p *pacedPort) Write(buf []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cfg := p.Port.Config()
+	baud := p.baud
+	if baud <= 0 {
+		baud = cfg.BaudRate
+	}
+	var timeout time.Time
+	if p.writeTimeout > 0 {
+		timeout = time.Now().Add(p.writeTimeout)
+		if err := p.Port.SetWriteDeadline(timeout); err != nil {
+			return 0, err
+		}
+		defer func() {
+			p.deadlineMu.Lock()
+			defer p.deadlineMu.Unlock()
+			p.Port.SetWriteDeadline(p.deadline)
+		}()
+	}
+	// deadline returns the end of the whole Write.
+	deadline := func() time.Time {
+		if !timeout.IsZero() {
+			return timeout
+		}
+		p.deadlineMu.Lock()
+		defer p.deadlineMu.Unlock()
+		return p.deadline
+	}
+	ct := charTime(cfg, baud)
+	if ct <= 0 {
+		return p.Port.Write(buf)
+	}
+	chunk := max(1, int(paceInterval/ct))
+	written := 0
+	for written < len(buf) {
+		if wait := time.Until(p.next); wait > 0 {
+			expired := false
+			if d := deadline(); !d.IsZero() && time.Until(d) < wait {
+				// The next chunk is not due before the deadline.
+				wait, expired = time.Until(d), true
+			}
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-p.done:
+				// The Write below fails on the closed port.
+				t.Stop()
+			}
+			if expired {
+				return written, &WriteTimeoutError{Written: written}
+			}
+		}
+		n, err := p.Port.Write(buf[written:min(written+chunk, len(buf))])
+		written += n
+		if now := time.Now(); p.next.Before(now) {
+			p.next = now
+		}
+		p.next = p.next.Add(ct * time.Duration(n))
+		if err != nil {
+			return written, writeTimeout(written, err)
+		}
+	}
+	return written, nil
+}
+
+// SetWriteDeadline implements Port
+func (p *pacedPort) SetWriteDeadline(t time.Time) error {
+	p.deadlineMu.Lock()
+	defer p.deadlineMu.Unlock()
+	if err := p.Port.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	p.deadline = t
+	return nil
+}
+
+// Config implements Port
+func (p *pacedPort) Config() Config {
+	cfg := p.Port.Config()
+	cfg.WriteTimeout = p.writeTimeout
+	return cfg
+}
+
+// Close implements io.Closer
+func (p *pacedPort) Close() error {
+	p.doneOnce.Do(func() { close(p.done) })
+	return p.Port.Close()
+}
+
+// charTime returns the time to transmit a character at baud with the framing of cfg,
+// the start, parity and stop bits included.
+func charTime(cfg Config, baud int) time.Duration {
+	if baud <= 0 {
+		return 0
+	}
+	bits := 1 + cfg.dataBits() + 1
+	if cfg.Parity != ParityNone {
+		bits++
+	}
+	if cfg.StopBits == TwoStopBits {
+		bits++
+	}
+	return time.Duration(bits) * time.Second / time.Duration(baud)
+}
+
+func (p *pacedPort) unwrap() Port {
+	return p.Port
+}
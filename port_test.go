@@ -0,0 +1,302 @@
+package serial_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jangocheng/serial"
+	"github.com/jangocheng/serial/serialtest"
+)
+
+// These tests check the concurrency guarantees documented on serial.Port.
+// They are meant to be run with the race detector: go test -race.
+
+// portPair opens a port to test, and the peer which reads what it writes.
+type portPair struct {
+	name string
+	open func(t *testing.T) (p, peer serial.Port)
+
+	// blockingWrite tells whether Write blocks while the peer does not read.
+	// The Write of a serialtest port buffers the data instead.
+	blockingWrite bool
+}
+
+var portPairs = []portPair{
+	{"pty", openPty(serial.Config{BaudRate: 115200}), true},
+	{"pty/paced", openPty(serial.Config{BaudRate: 115200, PaceWrites: true}), true},
+	{"pipe", func(t *testing.T) (serial.Port, serial.Port) {
+		p, peer := serialtest.Pipe(serialtest.Config{})
+		t.Cleanup(func() {
+			p.Close()
+			peer.Close()
+		})
+		return p, peer
+	}, false},
+}
+
+// openPty returns the function opening the slave end of a pty configured by cfg, and its master end.
+func openPty(cfg serial.Config) func(t *testing.T) (serial.Port, serial.Port) {
+	return func(t *testing.T) (serial.Port, serial.Port) {
+		master, slave, _, err := serial.OpenPty(cfg)
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skip(err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			slave.Close()
+			master.Close()
+		})
+		return slave, master
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	const (
+		writers   = 8
+		frames    = 16
+		frameSize = 300 // several chunks of the pacing at 115200 baud
+	)
+	for _, pp := range portPairs {
+		t.Run(pp.name, func(t *testing.T) {
+			p, peer := pp.open(t)
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					frame := bytes.Repeat([]byte{byte('A' + w)}, frameSize)
+					var err error
+					switch w {
+					case 0:
+						// All the frames in a single copy, with ReadFrom on the ports which implement it.
+						readers := make([]io.Reader, frames)
+						for i := range readers {
+							readers[i] = bytes.NewReader(frame)
+						}
+						_, err = io.Copy(p, slowReader{io.MultiReader(readers...)})
+					case 1:
+						for i := 0; i < frames && err == nil; i++ {
+							_, err = serial.WriteBuffers(p, [][]byte{frame[:frameSize/2], frame[frameSize/2:]})
+							time.Sleep(time.Millisecond)
+						}
+					default:
+						for i := 0; i < frames && err == nil; i++ {
+							_, err = p.Write(frame)
+							time.Sleep(time.Millisecond)
+						}
+					}
+					if err != nil {
+						t.Errorf("writer %d: %v", w, err)
+					}
+				}(w)
+			}
+
+			data := make([]byte, writers*frames*frameSize)
+			peer.SetReadDeadline(time.Now().Add(30 * time.Second))
+			_, err := io.ReadFull(peer, data)
+			wg.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := p.(io.ReaderFrom); ok {
+				// ReadFrom is a single Write.
+				run := bytes.Repeat([]byte{'A'}, frames*frameSize)
+				if !bytes.Contains(data, run) {
+					t.Error("the frames copied with ReadFrom are interleaved with the other Writes")
+				}
+			}
+			count := make(map[byte]int)
+			for off := 0; off < len(data); off += frameSize {
+				frame := data[off : off+frameSize]
+				for i, b := range frame {
+					if b != frame[0] {
+						t.Fatalf("frame at offset %d interleaved at byte %d: %q", off, i, frame)
+					}
+				}
+				count[frame[0]]++
+			}
+			for w := 0; w < writers; w++ {
+				if n := count[byte('A'+w)]; n != frames {
+					t.Errorf("writer %d: got %d frames, want %d", w, n, frames)
+				}
+			}
+		})
+	}
+}
+
+// slowReader returns the data of its reader slowly, like the other writers of the test write their frames,
+// so that they run during a copy from it. It hides the WriteTo of the reader.
+type slowReader struct {
+	r io.Reader
+}
+
+func (r slowReader) Read(buf []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return r.r.Read(buf)
+}
+
+func TestCloseUnblocksRead(t *testing.T) {
+	for _, pp := range portPairs {
+		t.Run(pp.name, func(t *testing.T) {
+			p, _ := pp.open(t)
+			done := make(chan error, 1)
+			go func() {
+				_, err := p.Read(make([]byte, 16))
+				done <- err
+			}()
+			time.Sleep(50 * time.Millisecond)
+			if err := p.Close(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Error("Read after Close succeeded")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Read still blocked after Close")
+			}
+		})
+	}
+}
+
+func TestCloseUnblocksWrite(t *testing.T) {
+	for _, pp := range portPairs {
+		t.Run(pp.name, func(t *testing.T) {
+			p, _ := pp.open(t)
+			write := func(done chan<- error) {
+				// The peer does not read, so the Write blocks once the buffers are full.
+				_, err := p.Write(make([]byte, 1<<20))
+				done <- err
+			}
+			done := make(chan error, 1)
+			if pp.blockingWrite {
+				go write(done)
+				time.Sleep(100 * time.Millisecond)
+			}
+			if err := p.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !pp.blockingWrite {
+				write(done)
+			}
+			select {
+			case err := <-done:
+				if !errors.Is(err, os.ErrClosed) {
+					t.Errorf("Write after Close: %v, want an error wrapping os.ErrClosed", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Write still blocked after Close")
+			}
+		})
+	}
+}
+
+func TestConcurrentClose(t *testing.T) {
+	const closers = 8
+	for _, pp := range portPairs {
+		t.Run(pp.name, func(t *testing.T) {
+			p, _ := pp.open(t)
+			errs := make(chan error, closers)
+			for i := 0; i < closers; i++ {
+				go func() { errs <- p.Close() }()
+			}
+			succeeded := 0
+			for i := 0; i < closers; i++ {
+				switch err := <-errs; {
+				case err == nil:
+					succeeded++
+				case !errors.Is(err, os.ErrClosed):
+					t.Errorf("Close: %v, want an error wrapping os.ErrClosed", err)
+				}
+			}
+			if succeeded != 1 {
+				t.Errorf("%d calls of Close succeeded, want 1", succeeded)
+			}
+		})
+	}
+}
+
+func TestContextClose(t *testing.T) {
+	for _, cancelFirst := range []bool{false, true} {
+		master, slave, name, err := serial.OpenPty(serial.Config{BaudRate: 115200})
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skip(err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer master.Close()
+		slave.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		p, err := serial.OpenContext(ctx, name, serial.Config{BaudRate: 115200})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cancelFirst {
+			// The context closes the port, which the first Close does not report.
+			cancel()
+		}
+		if err := p.Close(); err != nil {
+			t.Errorf("cancel first %v: Close: %v", cancelFirst, err)
+		}
+		if err := p.Close(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("cancel first %v: second Close: %v, want an error wrapping os.ErrClosed", cancelFirst, err)
+		}
+		cancel()
+	}
+}
+
+func TestCanonicalEOF(t *testing.T) {
+	disconnected := make(chan error, 1)
+	master, slave, _, err := serial.OpenPty(serial.Config{
+		BaudRate:     115200,
+		Console:      serial.ConsoleConfig{Canonical: true},
+		OnDisconnect: func(err error) { disconnected <- err },
+	})
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	buf := make([]byte, 64)
+	slave.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, read := range []func() (int, error){
+		func() (int, error) { return slave.Read(buf) },
+		func() (int, error) {
+			n, _, err := slave.ReadTimestamped(buf)
+			return n, err
+		},
+	} {
+		// Ctrl-D at the start of a line.
+		if _, err := master.Write([]byte{0x04}); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := read(); n != 0 || err != io.EOF {
+			t.Fatalf("read after Ctrl-D: %d, %v, want io.EOF", n, err)
+		}
+		if _, err := master.Write([]byte("line\n")); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := read(); err != nil || string(buf[:n]) != "line\n" {
+			t.Fatalf("read after Ctrl-D: %q, %v, want the next line", buf[:n], err)
+		}
+	}
+	select {
+	case err := <-disconnected:
+		t.Errorf("Ctrl-D reported as a disconnection: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
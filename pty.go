@@ -0,0 +1,15 @@
+package serial
+
+// OpenPty creates a pseudo-terminal pair, and returns its master end, and its slave end
+// opened and configured by cfg, like OpenWithConfig does, along with the name of the slave, like /dev/pts/3.
+// The data written to one end is read from the other one, so the code which opens a serial port
+// by name can be tested with a real tty, driven from the master end.
+//
+// The master end has no modem lines or line parameters: only Read, Write, Close, the deadlines,
+// the counters and the events work on it. Only Config.ReadTimeout applies to it.
+// Closing the master end disconnects the slave one.
+//
+// OpenPty is supported on Linux and macOS.
+func OpenPty(cfg Config) (master, slave Port, name string, err error) {
+	return openPty(cfg)
+}
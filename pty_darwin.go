@@ -0,0 +1,27 @@
+package serial
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// unlockPty grants and unlocks the slave of the pty master fd, and returns its name.
+func unlockPty(fd uintptr) (string, error) {
+	if err := rawIoctl(fd, syscall.TIOCPTYGRANT, 0); err != nil {
+		return "", err
+	}
+	if err := rawIoctl(fd, syscall.TIOCPTYUNLK, 0); err != nil {
+		return "", err
+	}
+	// TIOCPTYGNAME fills a buffer of 128 bytes.
+	var buf [128]byte
+	if err := rawIoctl(fd, syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&buf[0]))); err != nil {
+		return "", err
+	}
+	for i, c := range buf {
+		if c == 0 {
+			return string(buf[:i]), nil
+		}
+	}
+	return string(buf[:]), nil
+}
@@ -0,0 +1,20 @@
+package serial
+
+import (
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// unlockPty unlocks the slave of the pty master fd, and returns its name.
+func unlockPty(fd uintptr) (string, error) {
+	var unlock int32
+	if err := rawIoctl(fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return "", err
+	}
+	var n uint32
+	if err := rawIoctl(fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		return "", err
+	}
+	return "/dev/pts/" + strconv.FormatUint(uint64(n), 10), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+)
+
+func openPty(cfg Config) (Port, Port, string, error) {
+	return nil, nil, "", fmt.Errorf("serial: pseudo-terminals: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,34 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package serial
+
+import (
+	"os"
+	"syscall"
+)
+
+func openPty(cfg Config) (_, _ Port, _ string, err error) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer func() {
+		if err != nil {
+			m.Close()
+		}
+	}()
+	var name string
+	if err = control(m, func(fd uintptr) (err error) {
+		name, err = unlockPty(fd)
+		return err
+	}); err != nil {
+		return nil, nil, "", &os.PathError{Op: "unlockpt", Path: m.Name(), Err: err}
+	}
+	slave, err := openPort(name, cfg.device())
+	if err != nil {
+		return nil, nil, "", err
+	}
+	master := newPort(m, Config{ReadTimeout: cfg.ReadTimeout}, func() {})
+	return master, wrap(slave, name, cfg), name, nil
+}
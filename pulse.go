@@ -0,0 +1,84 @@
+package serial
+
+import (
+	"fmt"
+	"time"
+)
+
+// LineLevel is the state a LineStep sets a modem control line to.
+type LineLevel int
+
+const (
+	// LineUnchanged leaves the line as it is.
+	LineUnchanged LineLevel = iota
+	// LineOn asserts the line, like SetDTR(true). The pin of a TTL adapter goes low then.
+	LineOn
+	// LineOff deasserts the line, like SetDTR(false). The pin of a TTL adapter goes high then.
+	LineOff
+)
+
+// LineStep is a step of RunLineSequence: it sets the DTR and RTS lines, and then waits for Wait.
+type LineStep struct {
+	DTR  LineLevel
+	RTS  LineLevel
+	Wait time.Duration
+}
+
+// linesSetter is implemented by the ports which can set both DTR and RTS with a single call.
+type linesSetter interface {
+	setLines(dtr, rts bool) error
+}
+
+// RunLineSequence runs the steps in order, like the sequences which reset a board into its bootloader
+// through the DTR and RTS lines of its USB adapter. The classic reset of an ESP32, as done by esptool,
+// where RTS drives EN and DTR drives IO0, is:
+//
+//	serial.RunLineSequence(p, []serial.LineStep{
+//		{DTR: serial.LineOff, RTS: serial.LineOn, Wait: 100 * time.Millisecond}, // EN low: reset, IO0 high
+//		{DTR: serial.LineOn, RTS: serial.LineOff, Wait: 50 * time.Millisecond},  // EN high, IO0 low: bootloader
+//		{DTR: serial.LineOff},                                                   // IO0 high
+//	})
+//
+// On Linux, macOS and the BSDs, a step setting both lines changes them at once,
+// so that the board never sees the state in between.
+func RunLineSequence(p Port, steps []LineStep) error {
+	for i, s := range steps {
+		if err := setLineLevels(p, s.DTR, s.RTS); err != nil {
+			return fmt.Errorf("step %d of line sequence: %w", i, err)
+		}
+		if s.Wait > 0 {
+			time.Sleep(s.Wait)
+		}
+	}
+	return nil
+}
+
+// PulseDTR asserts DTR for d, and then deasserts it, like to reset an Arduino through its auto-reset capacitor.
+func PulseDTR(p Port, d time.Duration) error {
+	return RunLineSequence(p, []LineStep{{DTR: LineOn, Wait: d}, {DTR: LineOff}})
+}
+
+// PulseRTS asserts RTS for d, and then deasserts it.
+func PulseRTS(p Port, d time.Duration) error {
+	return RunLineSequence(p, []LineStep{{RTS: LineOn, Wait: d}, {RTS: LineOff}})
+}
+
+// setLineLevels sets DTR and RTS as given.
+func setLineLevels(p Port, dtr, rts LineLevel) error {
+	if dtr != LineUnchanged && rts != LineUnchanged {
+		if s, ok := underlying(p).(linesSetter); ok {
+			return s.setLines(dtr == LineOn, rts == LineOn)
+		}
+	}
+	if dtr != LineUnchanged {
+		if err := p.SetDTR(dtr == LineOn); err != nil {
+			return err
+		}
+	}
+	if rts != LineUnchanged {
+		if err := p.SetRTS(rts == LineOn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,656 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultMaxBuffered is the size of the write buffer of a ReconnectingPort, unless configured otherwise.
+const DefaultMaxBuffered = 64 << 10
+
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+// ReconnectConfig describes how a ReconnectingPort reopens its device.
+type ReconnectConfig struct {
+	// SerialNumber, if not empty, is the USB serial number of the device.
+	// The port is reopened under the name ListPorts reports for the device,
+	// which may change after a replug, like from /dev/ttyUSB0 to /dev/ttyUSB1.
+	// Otherwise, the port is reopened under the same name.
+	SerialNumber string
+
+	// MinBackoff and MaxBackoff bound the delay before an attempt to reopen the port,
+	// which doubles after every failed attempt. The defaults are 100ms and 10s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnReconnect, if not nil, is called with the reopened port before it is used,
+	// like to initialize the device again. If it returns an error, the port
+	// is closed, and the next attempt is made after the backoff.
+	OnReconnect func(p Port) error
+
+	// WritePolicy selects what Write does while the port is disconnected.
+	// The default is WriteFail.
+	WritePolicy WritePolicy
+
+	// MaxBuffered limits the data kept with WriteBuffer while the port is disconnected.
+	// Zero means DefaultMaxBuffered.
+	MaxBuffered int
+}
+
+// WritePolicy selects what a ReconnectingPort does with the writes while its device is away.
+type WritePolicy int
+
+const (
+	// WriteFail fails the writes with ErrPortDisconnected.
+	WriteFail WritePolicy = iota
+	// WriteBuffer keeps the data, and writes it to the port once it is reopened,
+	// before anything written later. Write fails with ErrPortDisconnected
+	// if the data does not fit into ReconnectConfig.MaxBuffered.
+	WriteBuffer
+)
+
+// ReconnectingPort is a Port which reopens its device after ErrPortDisconnected,
+// like when a USB adapter is unplugged and plugged back.
+//
+// While the device is away, Read waits for it to come back, until the read deadline
+// or Config.ReadTimeout, Write follows ReconnectConfig.WritePolicy, and the other methods
+// fail with ErrPortDisconnected. The changes of the parameters, like with SetBaudRate,
+// and the deadlines are kept across the reconnections.
+type ReconnectingPort struct {
+	rc     ReconnectConfig
+	done   chan struct{} // closed by Close
+	events *events
+
+	writeMu sync.Mutex // serializes Write
+
+	mu            sync.Mutex
+	changed       chan struct{} // closed and replaced on every change of the state
+	name          string
+	cfg           Config
+	cfgGen        uint64 // incremented on every change of cfg
+	port          Port   // nil while disconnected
+	gen           uint64 // incremented on every reconnection
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	pending       []byte // the data buffered with WriteBuffer
+}
+
+var _ Port = (*ReconnectingPort)(nil)
+
+// OpenReconnecting opens the port like OpenWithConfig, and keeps reopening it
+// as described by rc, once it is disconnected. Config.OnDisconnect, if set,
+// is called on every disconnection.
+func OpenReconnecting(name string, cfg Config, rc ReconnectConfig) (*ReconnectingPort, error) {
+	if rc.MinBackoff <= 0 {
+		rc.MinBackoff = defaultMinBackoff
+	}
+	if rc.MaxBackoff <= 0 {
+		rc.MaxBackoff = defaultMaxBackoff
+	}
+	if rc.MaxBackoff < rc.MinBackoff {
+		rc.MaxBackoff = rc.MinBackoff
+	}
+	if rc.MaxBuffered <= 0 {
+		rc.MaxBuffered = DefaultMaxBuffered
+	}
+	r := &ReconnectingPort{rc: rc, done: make(chan struct{}), events: newEvents(), changed: make(chan struct{}), name: name, cfg: cfg}
+	p, err := r.open(name, cfg, 1)
+	if err != nil {
+		return nil, err
+	}
+	r.port, r.gen = p, 1
+	return r, nil
+}
+
+// Connected reports whether the device is currently connected.
+func (r *ReconnectingPort) Connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.port != nil
+}
+
+// Read implements io.Reader
+func (r *ReconnectingPort) Read(buf []byte) (int, error) {
+	n, _, err := r.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port
+func (r *ReconnectingPort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	var timeout time.Time
+	r.mu.Lock()
+	if r.cfg.ReadTimeout > 0 {
+		timeout = time.Now().Add(r.cfg.ReadTimeout)
+	}
+	r.mu.Unlock()
+	for {
+		p, gen, err := r.waitConnected(timeout)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		n, ts, err := p.ReadTimestamped(buf)
+		if n > 0 {
+			r.events.read()
+		}
+		if err != nil && r.lost(gen, err) {
+			if n > 0 {
+				return n, ts, nil
+			}
+			continue
+		}
+		return n, ts, err
+	}
+}
+
+// Write implements io.Writer
+func (r *ReconnectingPort) Write(buf []byte) (int, error) {
+	// The part of buf buffered after a disconnection must not be preceded by another Write.
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, os.ErrClosed
+	}
+	p, gen := r.port, r.gen
+	if p == nil {
+		defer r.mu.Unlock()
+		return r.buffer(buf)
+	}
+	r.mu.Unlock()
+
+	n, err := p.Write(buf)
+	if err != nil && r.lost(gen, err) {
+		if r.rc.WritePolicy == WriteBuffer {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			m, err := r.buffer(buf[n:])
+			return n + m, err
+		}
+		if !errors.Is(err, ErrPortDisconnected) {
+			// The port was closed under the Write by the reconnection.
+			err = fmt.Errorf("%w: %w", ErrPortDisconnected, err)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer. It also stops reconnecting.
+func (r *ReconnectingPort) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return os.ErrClosed
+	}
+	r.closed = true
+	close(r.done)
+	r.events.stop()
+	p := r.port
+	r.port = nil
+	r.notify()
+	r.mu.Unlock()
+	if p != nil {
+		return p.Close()
+	}
+	return nil
+}
+
+// SetReadDeadline implements Port
+func (r *ReconnectingPort) SetReadDeadline(t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	r.readDeadline = t
+	r.notify()
+	if r.port != nil {
+		return r.port.SetReadDeadline(t)
+	}
+	return nil
+}
+
+// SetWriteDeadline implements Port
+func (r *ReconnectingPort) SetWriteDeadline(t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	r.writeDeadline = t
+	if r.port != nil {
+		return r.port.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// SetDTR implements Port
+func (r *ReconnectingPort) SetDTR(on bool) error {
+	return r.do(func(p Port) error { return p.SetDTR(on) })
+}
+
+// SetRTS implements Port
+func (r *ReconnectingPort) SetRTS(on bool) error {
+	return r.do(func(p Port) error { return p.SetRTS(on) })
+}
+
+// Status implements Port
+func (r *ReconnectingPort) Status() (ModemStatus, error) {
+	var s ModemStatus
+	err := r.do(func(p Port) (err error) {
+		s, err = p.Status()
+		return err
+	})
+	return s, err
+}
+
+// Drain implements Port
+func (r *ReconnectingPort) Drain() error {
+	return r.do(Port.Drain)
+}
+
+// ResetInput implements Port
+func (r *ReconnectingPort) ResetInput() error {
+	return r.do(Port.ResetInput)
+}
+
+// ResetOutput implements Port. It also discards the data buffered while disconnected.
+func (r *ReconnectingPort) ResetOutput() error {
+	r.mu.Lock()
+	r.pending = nil
+	r.mu.Unlock()
+	return r.do(Port.ResetOutput)
+}
+
+// Break implements Port
+func (r *ReconnectingPort) Break(d time.Duration) error {
+	return r.do(func(p Port) error { return p.Break(d) })
+}
+
+// SendXON implements Port
+func (r *ReconnectingPort) SendXON() error {
+	return r.do(func(p Port) error { return p.SendXON() })
+}
+
+// SendXOFF implements Port
+func (r *ReconnectingPort) SendXOFF() error {
+	return r.do(func(p Port) error { return p.SendXOFF() })
+}
+
+// Stats implements Port. The counters are the ones of the current connection.
+func (r *ReconnectingPort) Stats() (Stats, error) {
+	var s Stats
+	err := r.do(func(p Port) (err error) {
+		s, err = p.Stats()
+		return err
+	})
+	return s, err
+}
+
+// SetBaudRate implements Port
+func (r *ReconnectingPort) SetBaudRate(baud int) error {
+	return r.reconfigure(func(cfg *Config) { cfg.BaudRate = baud }, func(p Port) error { return p.SetBaudRate(baud) })
+}
+
+// SetDataBits implements Port
+func (r *ReconnectingPort) SetDataBits(bits int) error {
+	return r.reconfigure(func(cfg *Config) { cfg.DataBits = bits }, func(p Port) error { return p.SetDataBits(bits) })
+}
+
+// SetParity implements Port
+func (r *ReconnectingPort) SetParity(parity Parity) error {
+	return r.reconfigure(func(cfg *Config) { cfg.Parity = parity }, func(p Port) error { return p.SetParity(parity) })
+}
+
+// SetStopBits implements Port
+func (r *ReconnectingPort) SetStopBits(stopBits StopBits) error {
+	return r.reconfigure(func(cfg *Config) { cfg.StopBits = stopBits }, func(p Port) error { return p.SetStopBits(stopBits) })
+}
+
+// SetFlowControl implements Port
+func (r *ReconnectingPort) SetFlowControl(fc FlowControl) error {
+	return r.reconfigure(func(cfg *Config) { cfg.FlowControl = fc }, func(p Port) error { return p.SetFlowControl(fc) })
+}
+
+// Config implements Port. It is the configuration used to reopen the port.
+func (r *ReconnectingPort) Config() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// SaveState implements Port
+func (r *ReconnectingPort) SaveState() (*State, error) {
+	var s *State
+	err := r.do(func(p Port) (err error) {
+		s, err = p.SaveState()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.Config = r.Config()
+	return s, nil
+}
+
+// RestoreState implements Port. The parameters of the line from the state are also
+// used to reopen the port, but the rest of the saved settings only apply to the current connection.
+func (r *ReconnectingPort) RestoreState(s *State) error {
+	return r.reconfigure(func(cfg *Config) { cfg.setLine(s.Config) }, func(p Port) error { return p.RestoreState(s) })
+}
+
+// SyscallConn implements Port. The raw connection is the one of the current port,
+// which fails once the port is closed by a reconnection.
+func (r *ReconnectingPort) SyscallConn() (syscall.RawConn, error) {
+	var c syscall.RawConn
+	err := r.do(func(p Port) (err error) {
+		c, err = p.SyscallConn()
+		return err
+	})
+	return c, err
+}
+
+// Fd implements Port. The descriptor is the one of the current port, or ^uintptr(0) while it is disconnected.
+func (r *ReconnectingPort) Fd() uintptr {
+	fd := ^uintptr(0)
+	r.do(func(p Port) error {
+		fd = p.Fd()
+		return nil
+	})
+	return fd
+}
+
+// Events implements Port. The events continue across the reconnections;
+// an Error is sent when the lines can not be checked, because the device is away.
+func (r *ReconnectingPort) Events() <-chan Event {
+	return r.events.start(r, r.Status)
+}
+
+// waitData waits until the current port has data to read, waiting for the reconnections.
+func (r *ReconnectingPort) waitData(done <-chan struct{}) error {
+	for {
+		r.mu.Lock()
+		for !r.closed && r.port == nil {
+			r.wait(time.Time{})
+		}
+		p, gen, closed := r.port, r.gen, r.closed
+		r.mu.Unlock()
+		if closed {
+			return os.ErrClosed
+		}
+		w, ok := underlying(p).(dataWaiter)
+		if !ok {
+			return fmt.Errorf("waiting for data: %w", errors.ErrUnsupported)
+		}
+		if err := w.waitData(done); err == nil || !r.lost(gen, err) {
+			return err
+		}
+	}
+}
+
+// reconfigure applies a change of the parameters to the current port, if any,
+// and records it in the configuration used to reopen the port.
+// The change is applied without holding mu, since it waits for the output to be transmitted,
+// which the flow control may stop for good; Close interrupts it.
+func (r *ReconnectingPort) reconfigure(update func(cfg *Config), apply func(p Port) error) error {
+	for {
+		r.mu.Lock()
+		p, gen, closed := r.port, r.gen, r.closed
+		r.mu.Unlock()
+		if closed {
+			return os.ErrClosed
+		}
+		if p != nil {
+			if err := apply(p); err != nil {
+				return err
+			}
+		}
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return os.ErrClosed
+		}
+		if r.gen == gen {
+			update(&r.cfg)
+			r.cfgGen++
+			r.mu.Unlock()
+			return nil
+		}
+		// The port has been reopened meanwhile, with the previous configuration.
+		r.mu.Unlock()
+	}
+}
+
+// do calls fn with the current port, or fails with ErrPortDisconnected if there is none.
+func (r *ReconnectingPort) do(fn func(p Port) error) error {
+	r.mu.Lock()
+	p, closed := r.port, r.closed
+	r.mu.Unlock()
+	switch {
+	case closed:
+		return os.ErrClosed
+	case p == nil:
+		return ErrPortDisconnected
+	}
+	return fn(p)
+}
+
+// waitConnected returns the current port and its generation.
+// While the port is disconnected, it waits until the read deadline, or timeout, if not zero.
+func (r *ReconnectingPort) waitConnected(timeout time.Time) (Port, uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		if r.closed {
+			return nil, 0, os.ErrClosed
+		}
+		if r.port != nil {
+			return r.port, r.gen, nil
+		}
+		until := r.readDeadline
+		if !timeout.IsZero() {
+			until = timeout
+		}
+		if !until.IsZero() && !time.Now().Before(until) {
+			return nil, 0, os.ErrDeadlineExceeded
+		}
+		r.wait(until)
+	}
+}
+
+// lost reports whether the operation on the port of generation gen failed with err
+// because the port was disconnected, and starts reconnecting if needed.
+func (r *ReconnectingPort) lost(gen uint64, err error) bool {
+	if errors.Is(err, ErrPortDisconnected) {
+		r.disconnected(gen)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.closed && (r.port == nil || r.gen != gen)
+}
+
+// buffer keeps buf to be written once the port is reopened, if the policy allows that.
+// Must be called with mu held.
+func (r *ReconnectingPort) buffer(buf []byte) (int, error) {
+	if r.rc.WritePolicy != WriteBuffer {
+		return 0, ErrPortDisconnected
+	}
+	if len(r.pending)+len(buf) > r.rc.MaxBuffered {
+		return 0, fmt.Errorf("%w: write buffer is full", ErrPortDisconnected)
+	}
+	r.pending = append(r.pending, buf...)
+	return len(buf), nil
+}
+
+// open opens the port, which becomes the connection of generation gen.
+func (r *ReconnectingPort) open(name string, cfg Config, gen uint64) (Port, error) {
+	if gen > 1 {
+		// The reconnection retries on its own, and must not block Close.
+		cfg.WaitForDevice = false
+	}
+	onDisconnect := cfg.OnDisconnect
+	cfg.OnDisconnect = func(err error) {
+		r.disconnected(gen)
+		if onDisconnect != nil {
+			onDisconnect(err)
+		}
+	}
+	return OpenWithConfig(name, cfg)
+}
+
+// disconnected closes the port of generation gen, if it is still the current one,
+// and starts reconnecting.
+func (r *ReconnectingPort) disconnected(gen uint64) {
+	r.mu.Lock()
+	if r.closed || r.port == nil || r.gen != gen {
+		r.mu.Unlock()
+		return
+	}
+	p := r.port
+	r.port = nil
+	r.notify()
+	r.mu.Unlock()
+	// Closing the port may wait for the calls in progress, which must not hold up the others.
+	p.Close()
+	go r.reconnect(gen + 1)
+}
+
+// reconnect tries to reopen the port with an exponential backoff, until it succeeds or the port is closed.
+func (r *ReconnectingPort) reconnect(gen uint64) {
+	backoff := r.rc.MinBackoff
+	for {
+		t := time.NewTimer(backoff)
+		select {
+		case <-r.done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if r.tryReconnect(gen) {
+			return
+		}
+		if backoff *= 2; backoff > r.rc.MaxBackoff {
+			backoff = r.rc.MaxBackoff
+		}
+	}
+}
+
+// tryReconnect makes a single attempt to reopen the port. It returns false if it should be retried.
+func (r *ReconnectingPort) tryReconnect(gen uint64) bool {
+	r.mu.Lock()
+	name, cfg, cfgGen := r.name, r.cfg, r.cfgGen
+	r.mu.Unlock()
+	if sn := r.rc.SerialNumber; sn != "" {
+		var ok bool
+		if name, ok = findBySerialNumber(sn); !ok {
+			return false
+		}
+	}
+	p, err := r.open(name, cfg, gen)
+	if err != nil {
+		return false
+	}
+	if r.rc.OnReconnect != nil {
+		if err := r.rc.OnReconnect(p); err != nil {
+			p.Close()
+			return false
+		}
+	}
+
+	// The buffered data must be written before anything written later.
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		p.Close()
+		return true
+	}
+	if r.cfgGen != cfgGen {
+		// The configuration has changed since the port was opened.
+		r.mu.Unlock()
+		p.Close()
+		return false
+	}
+	if !r.readDeadline.IsZero() {
+		if err := p.SetReadDeadline(r.readDeadline); err != nil {
+			r.mu.Unlock()
+			p.Close()
+			return false
+		}
+	}
+	if !r.writeDeadline.IsZero() {
+		if err := p.SetWriteDeadline(r.writeDeadline); err != nil {
+			r.mu.Unlock()
+			p.Close()
+			return false
+		}
+	}
+	pending := r.pending
+	r.name, r.port, r.gen, r.pending = name, p, gen, nil
+	r.notify()
+	r.mu.Unlock()
+	if cfg.Metrics != nil {
+		cfg.Metrics.Reconnected(name)
+	}
+
+	// The port is in use meanwhile, so that a flush stalled by the flow control does not block
+	// the other calls, and Close interrupts it.
+	if len(pending) > 0 {
+		if n, err := p.Write(pending); err != nil {
+			r.mu.Lock()
+			if !r.closed {
+				// Keep the rest for the next connection.
+				r.pending = append(pending[n:], r.pending...)
+			}
+			r.mu.Unlock()
+			r.disconnected(gen)
+		}
+	}
+	return true
+}
+
+// findBySerialNumber returns the name of the USB port with the serial number sn.
+func findBySerialNumber(sn string) (string, bool) {
+	ports, err := ListPorts()
+	if err != nil {
+		return "", false
+	}
+	for _, info := range ports {
+		if info.IsUSB && info.SerialNumber == sn {
+			return info.Name, true
+		}
+	}
+	return "", false
+}
+
+// notify wakes up all the calls waiting for a change of the state. Must be called with mu held.
+func (r *ReconnectingPort) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// wait releases mu until the state changes or until the time t, if not zero.
+func (r *ReconnectingPort) wait(t time.Time) {
+	changed := r.changed
+	r.mu.Unlock()
+	defer r.mu.Lock()
+	if t.IsZero() {
+		<-changed
+		return
+	}
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-changed:
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,73 @@
+package serial
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stuckPort is a port whose changes of the parameters wait for the output to be transmitted,
+// which the flow control has stopped for good, until the port is closed.
+type stuckPort struct {
+	Port
+	started chan struct{} // closed once SetBaudRate waits
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (p *stuckPort) SetBaudRate(baud int) error {
+	close(p.started)
+	<-p.closed
+	return os.ErrClosed
+}
+
+func (p *stuckPort) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (p *stuckPort) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+func TestReconnectingCloseDuringReconfigure(t *testing.T) {
+	p := &stuckPort{started: make(chan struct{}), closed: make(chan struct{})}
+	r := &ReconnectingPort{done: make(chan struct{}), events: newEvents(), changed: make(chan struct{}), port: p, gen: 1}
+
+	set := make(chan error, 1)
+	go func() { set <- r.SetBaudRate(9600) }()
+	<-p.started
+
+	returned := func(what string, fn func()) {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			fn()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s blocked by the reconfiguration", what)
+		}
+	}
+	returned("Config", func() { r.Config() })
+	returned("SetReadDeadline", func() { r.SetReadDeadline(time.Now()) })
+	returned("Close", func() {
+		if err := r.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	})
+	select {
+	case err := <-set:
+		if err == nil {
+			t.Error("SetBaudRate interrupted by Close succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SetBaudRate still blocked after Close")
+	}
+	if baud := r.Config().BaudRate; baud == 9600 {
+		t.Error("the failed SetBaudRate was recorded in the configuration")
+	}
+}
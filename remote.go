@@ -0,0 +1,837 @@
+package serial
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// remoteDialTimeout limits the time to connect to a device server.
+	remoteDialTimeout = 10 * time.Second
+
+	// remoteNegotiationTimeout limits the time a device server takes to accept RFC 2217.
+	remoteNegotiationTimeout = 5 * time.Second
+
+	// maxRemoteBuffer is the amount of the received data kept until it is read.
+	// Beyond that, the data is left in the TCP connection, which throttles the server.
+	maxRemoteBuffer = 64 << 10
+)
+
+// Telnet commands and options from RFC 854, RFC 856 and RFC 858.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetBinary = 0
+	telnetSGA    = 3
+)
+
+// The COM-PORT-OPTION of RFC 2217 and its commands. The server answers with the command + 100.
+const (
+	comPortOption = 44
+
+	comSetBaudRate       = 1
+	comSetDataSize       = 2
+	comSetParity         = 3
+	comSetStopSize       = 4
+	comSetControl        = 5
+	comSetModemStateMask = 11
+	comPurgeData         = 12
+
+	comNotifyModemState = 7 + 100
+
+	// Values of comSetControl.
+	comFlowNone     = 1
+	comFlowSoftware = 2
+	comFlowHardware = 3
+	comBreakOn      = 5
+	comBreakOff     = 6
+	comDTROn        = 8
+	comDTROff       = 9
+	comRTSOn        = 11
+	comRTSOff       = 12
+
+	// The flow control of the input, separate from the one of the output, which values 1 to 3 set both.
+	comInboundFlowNone     = 14
+	comInboundFlowSoftware = 15
+
+	// Values of comPurgeData.
+	comPurgeInput  = 1
+	comPurgeOutput = 2
+
+	// Bits of the modem state.
+	comModemCTS = 0x10
+	comModemDSR = 0x20
+	comModemRI  = 0x40
+	comModemDCD = 0x80
+)
+
+// OpenRemote opens the serial port of a network device server, like ser2net or Moxa NPort,
+// at addr (host:port). The port is controlled with the Telnet COM Port Control Option
+// of RFC 2217, so the parameters of cfg and their later changes, as well as the modem lines,
+// are forwarded to the server.
+//
+// OpenWithConfig calls OpenRemote for the names like rfc2217://host:port. The names like
+// tcp://host:port open a raw TCP connection instead, which only carries the data: the parameters
+// are the ones configured on the server, and changing them or the lines fails with errors.ErrUnsupported.
+//
+// Exclusive and LockDir are ignored for the remote ports, and RS485 is not supported.
+func OpenRemote(addr string, cfg Config) (Port, error) {
+	return openRemote(addr, cfg, true)
+}
+
+func openRemote(addr string, cfg Config, rfc2217 bool) (_ Port, err error) {
+	if cfg.RS485.Enabled {
+		return nil, fmt.Errorf("RS-485 mode: %w", errors.ErrUnsupported)
+	}
+	if cfg.RestoreOnClose {
+		return nil, fmt.Errorf("restoring the settings on close: %w", errors.ErrUnsupported)
+	}
+	if cfg.MarkErrors {
+		return nil, fmt.Errorf("marking the errors: %w", errors.ErrUnsupported)
+	}
+	if cfg.LowLatency {
+		return nil, fmt.Errorf("low latency mode: %w", errors.ErrUnsupported)
+	}
+	if cfg.Console.enabled() {
+		return nil, fmt.Errorf("console mode: %w", errors.ErrUnsupported)
+	}
+	conn, err := net.DialTimeout("tcp", addr, remoteDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	p := &remotePort{
+		conn:         conn,
+		rfc2217:      rfc2217,
+		readTimeout:  cfg.ReadTimeout,
+		writeTimeout: cfg.WriteTimeout,
+		monitor:      newDisconnectMonitor(cfg.OnDisconnect),
+		events:       newEvents(),
+		changed:      make(chan struct{}),
+		cfg:          cfg,
+		willSent:     map[byte]bool{telnetBinary: true, telnetSGA: true, comPortOption: true},
+		doSent:       map[byte]bool{telnetBinary: true, telnetSGA: true},
+	}
+	defer func() {
+		if err != nil {
+			p.Close()
+		}
+	}()
+	go p.readLoop()
+	if !rfc2217 {
+		return p, nil
+	}
+
+	if err := p.negotiate(); err != nil {
+		return nil, err
+	}
+	if err := p.configure(cfg); err != nil {
+		return nil, err
+	}
+	if err := p.command(comSetModemStateMask, 0xff); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// remotePort is a serial port of a device server, reached over TCP.
+type remotePort struct {
+	conn         net.Conn
+	rfc2217      bool
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	monitor      *disconnectMonitor
+	events       *events
+	counters     counters
+
+	writeMu sync.Mutex // serializes the writes to conn
+
+	cfgMu sync.Mutex // serializes the changes of cfg
+	cfg   Config
+
+	mu            sync.Mutex
+	changed       chan struct{} // closed and replaced on every change of the state
+	data          []byte        // received, but not read yet
+	dataTime      time.Time     // when data[0] was received
+	readErr       error         // the error which ended receiving
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	modemState    byte
+	comPort       int           // 1 if the server accepted the COM port option, -1 if it refused it
+	willSent      map[byte]bool // the options we have offered (WILL) or refused (WONT)
+	doSent        map[byte]bool // the options we have asked for (DO) or refused (DONT)
+
+	// the state of the Telnet parser, used only by readLoop
+	telnetState int
+	telnetCmd   byte
+	sb          []byte
+}
+
+var _ Port = (*remotePort)(nil)
+
+// States of the Telnet parser.
+const (
+	telnetData = iota
+	telnetCommand
+	telnetOption
+	telnetSubneg
+	telnetSubnegIAC
+)
+
+// negotiate enables the binary transmission and the COM port option,
+// as recorded in willSent and doSent beforehand.
+func (p *remotePort) negotiate() error {
+	if err := p.writeRaw([]byte{
+		telnetIAC, telnetWILL, telnetBinary,
+		telnetIAC, telnetDO, telnetBinary,
+		telnetIAC, telnetWILL, telnetSGA,
+		telnetIAC, telnetDO, telnetSGA,
+		telnetIAC, telnetWILL, comPortOption,
+	}); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	deadline := time.Now().Add(remoteNegotiationTimeout)
+	for p.comPort == 0 {
+		switch {
+		case p.readErr != nil:
+			return p.readErr
+		case !time.Now().Before(deadline):
+			return errors.New("serial: the server did not answer the RFC 2217 negotiation")
+		}
+		p.wait(deadline)
+	}
+	if p.comPort < 0 {
+		return fmt.Errorf("serial: the server refused RFC 2217: %w", errors.ErrUnsupported)
+	}
+	return nil
+}
+
+// configure sends the parameters of cfg to the server.
+func (p *remotePort) configure(cfg Config) error {
+	if cfg.BaudRate <= 0 {
+		return fmt.Errorf("%w: %v", ErrUnsupportedBaudRate, cfg.BaudRate)
+	}
+	bits := cfg.dataBits()
+	if bits < 5 || bits > 8 {
+		return fmt.Errorf("unsupported data bits: %v", cfg.DataBits)
+	}
+	var parity byte
+	switch cfg.Parity {
+	case ParityNone:
+		parity = 1
+	case ParityOdd:
+		parity = 2
+	case ParityEven:
+		parity = 3
+	case ParityMark:
+		parity = 4
+	case ParitySpace:
+		parity = 5
+	default:
+		return fmt.Errorf("unsupported parity: %v", cfg.Parity)
+	}
+	var stop byte
+	switch cfg.StopBits {
+	case OneStopBit:
+		stop = 1
+	case TwoStopBits:
+		stop = 2
+	default:
+		return fmt.Errorf("unsupported stop bits: %v", cfg.StopBits)
+	}
+	flow := []byte{comFlowNone}
+	switch cfg.FlowControl {
+	case FlowNone:
+	case FlowSoftware:
+		sf := cfg.SoftwareFlow
+		if on, off := sf.chars(); on != xon || off != xoff {
+			return fmt.Errorf("XON/XOFF characters other than DC1 and DC3: %w", errors.ErrUnsupported)
+		}
+		if sf.RestartOnAny {
+			return fmt.Errorf("restarting the output on any character: %w", errors.ErrUnsupported)
+		}
+		switch sf.Direction {
+		case FlowBoth:
+			flow = []byte{comFlowSoftware}
+		case FlowOutput:
+			flow = []byte{comFlowSoftware, comInboundFlowNone}
+		case FlowInput:
+			flow = []byte{comFlowNone, comInboundFlowSoftware}
+		default:
+			return fmt.Errorf("unsupported flow direction: %v", sf.Direction)
+		}
+	case FlowHardware:
+		flow = []byte{comFlowHardware}
+	default:
+		return fmt.Errorf("unsupported flow control: %v", cfg.FlowControl)
+	}
+	baud := binary.BigEndian.AppendUint32(nil, uint32(cfg.BaudRate))
+	for _, c := range []struct {
+		cmd   byte
+		value []byte
+	}{
+		{comSetBaudRate, baud},
+		{comSetDataSize, []byte{byte(bits)}},
+		{comSetParity, []byte{parity}},
+		{comSetStopSize, []byte{stop}},
+	} {
+		if err := p.command(c.cmd, c.value...); err != nil {
+			return err
+		}
+	}
+	for _, v := range flow {
+		if err := p.command(comSetControl, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read implements io.Reader
+func (p *remotePort) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port. The time is when the data was received from the network,
+// by the read from the connection which received its first byte, or earlier.
+func (p *remotePort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	var timeout time.Time
+	if p.readTimeout > 0 {
+		timeout = time.Now().Add(p.readTimeout)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.closed {
+			return 0, time.Time{}, os.ErrClosed
+		}
+		if len(buf) == 0 {
+			return 0, time.Now(), nil
+		}
+		if len(p.data) > 0 {
+			n := copy(buf, p.data)
+			p.data = p.data[n:]
+			p.counters.read(n)
+			p.events.read()
+			p.notify()
+			// The rest of the data keeps the time: it was received by the same read, or by a later one.
+			return n, p.dataTime, nil
+		}
+		if p.readErr != nil {
+			p.counters.read(0)
+			return 0, time.Time{}, p.readErr
+		}
+		until := p.readDeadline
+		if !timeout.IsZero() {
+			until = timeout
+		}
+		if !until.IsZero() && !time.Now().Before(until) {
+			p.counters.read(0)
+			return 0, time.Time{}, os.ErrDeadlineExceeded
+		}
+		p.wait(until)
+	}
+}
+
+// Write implements io.Writer
+func (p *remotePort) Write(buf []byte) (int, error) {
+	out := buf
+	if p.rfc2217 {
+		out = escapeIAC(buf)
+	}
+	var timeout time.Time
+	if p.writeTimeout > 0 {
+		timeout = time.Now().Add(p.writeTimeout)
+	}
+	n, err := p.writeConn(out, timeout)
+	if p.rfc2217 {
+		n = unescapedLen(buf, n)
+	}
+	p.counters.write(n)
+	return n, writeTimeout(n, err)
+}
+
+// Close implements io.Closer
+func (p *remotePort) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return os.ErrClosed
+	}
+	p.closed = true
+	p.notify()
+	p.mu.Unlock()
+	p.monitor.stop()
+	p.events.stop()
+	return p.conn.Close()
+}
+
+// SetReadDeadline implements Port
+func (p *remotePort) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	p.readDeadline = t
+	p.notify()
+	return nil
+}
+
+// SetWriteDeadline implements Port
+func (p *remotePort) SetWriteDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	p.writeDeadline = t
+	// Applied to a pending write too.
+	return p.conn.SetWriteDeadline(t)
+}
+
+// SyscallConn implements Port. There is no descriptor of the remote port;
+// the one of the connection would not take the ioctls.
+func (p *remotePort) SyscallConn() (syscall.RawConn, error) {
+	return nil, fmt.Errorf("raw connection: %w", errors.ErrUnsupported)
+}
+
+// Fd implements Port
+func (p *remotePort) Fd() uintptr { return ^uintptr(0) }
+
+// SetDTR implements Port
+func (p *remotePort) SetDTR(on bool) error {
+	v := byte(comDTROff)
+	if on {
+		v = comDTROn
+	}
+	if err := p.command(comSetControl, v); err != nil {
+		return fmt.Errorf("failed to set DTR: %w", err)
+	}
+	return nil
+}
+
+// SetRTS implements Port
+func (p *remotePort) SetRTS(on bool) error {
+	v := byte(comRTSOff)
+	if on {
+		v = comRTSOn
+	}
+	if err := p.command(comSetControl, v); err != nil {
+		return fmt.Errorf("failed to set RTS: %w", err)
+	}
+	return nil
+}
+
+// Status implements Port. The state is the last one notified by the server.
+func (p *remotePort) Status() (ModemStatus, error) {
+	if !p.rfc2217 {
+		return ModemStatus{}, fmt.Errorf("failed to query modem lines: %w", errors.ErrUnsupported)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ModemStatus{}, os.ErrClosed
+	}
+	s := p.modemState
+	return ModemStatus{
+		CTS: s&comModemCTS != 0,
+		DSR: s&comModemDSR != 0,
+		DCD: s&comModemDCD != 0,
+		RI:  s&comModemRI != 0,
+	}, nil
+}
+
+// Drain implements Port. RFC 2217 can not tell when the server has transmitted the data,
+// so Drain only waits for the data to be handed to the network.
+func (p *remotePort) Drain() error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return nil
+}
+
+// ResetInput implements Port
+func (p *remotePort) ResetInput() error {
+	p.mu.Lock()
+	p.data = nil
+	p.notify()
+	p.mu.Unlock()
+	if !p.rfc2217 {
+		return nil
+	}
+	if err := p.command(comPurgeData, comPurgeInput); err != nil {
+		return fmt.Errorf("failed to reset input: %w", err)
+	}
+	return nil
+}
+
+// ResetOutput implements Port
+func (p *remotePort) ResetOutput() error {
+	if err := p.command(comPurgeData, comPurgeOutput); err != nil {
+		return fmt.Errorf("failed to reset output: %w", err)
+	}
+	return nil
+}
+
+// Break implements Port
+func (p *remotePort) Break(d time.Duration) error {
+	if err := p.command(comSetControl, comBreakOn); err != nil {
+		return fmt.Errorf("failed to start break: %w", err)
+	}
+	time.Sleep(d)
+	if err := p.command(comSetControl, comBreakOff); err != nil {
+		return fmt.Errorf("failed to stop break: %w", err)
+	}
+	return nil
+}
+
+// SendXON implements Port. The character is sent in the data, behind the output not transmitted yet.
+func (p *remotePort) SendXON() error {
+	on, _ := p.Config().SoftwareFlow.chars()
+	if _, err := p.Write([]byte{on}); err != nil {
+		return fmt.Errorf("failed to send XON: %w", err)
+	}
+	return nil
+}
+
+// SendXOFF implements Port. The character is sent in the data, behind the output not transmitted yet.
+func (p *remotePort) SendXOFF() error {
+	_, off := p.Config().SoftwareFlow.chars()
+	if _, err := p.Write([]byte{off}); err != nil {
+		return fmt.Errorf("failed to send XOFF: %w", err)
+	}
+	return nil
+}
+
+// Stats implements Port. The errors of the remote driver are not counted.
+func (p *remotePort) Stats() (Stats, error) {
+	return p.counters.stats(), nil
+}
+
+// SetBaudRate implements Port
+func (p *remotePort) SetBaudRate(baud int) error {
+	return p.reconfigure(func(cfg *Config) { cfg.BaudRate = baud })
+}
+
+// SetDataBits implements Port
+func (p *remotePort) SetDataBits(bits int) error {
+	return p.reconfigure(func(cfg *Config) { cfg.DataBits = bits })
+}
+
+// SetParity implements Port
+func (p *remotePort) SetParity(parity Parity) error {
+	return p.reconfigure(func(cfg *Config) { cfg.Parity = parity })
+}
+
+// SetStopBits implements Port
+func (p *remotePort) SetStopBits(stopBits StopBits) error {
+	return p.reconfigure(func(cfg *Config) { cfg.StopBits = stopBits })
+}
+
+// SetFlowControl implements Port
+func (p *remotePort) SetFlowControl(fc FlowControl) error {
+	return p.reconfigure(func(cfg *Config) { cfg.FlowControl = fc })
+}
+
+// Config implements Port
+func (p *remotePort) Config() Config {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	return p.cfg
+}
+
+// SaveState implements Port. The state is the configuration of the port, as the settings of the server are not queried.
+func (p *remotePort) SaveState() (*State, error) {
+	return &State{Config: p.Config()}, nil
+}
+
+// RestoreState implements Port
+func (p *remotePort) RestoreState(s *State) error {
+	return p.reconfigure(func(cfg *Config) { cfg.setLine(s.Config) })
+}
+
+// reconfigure sends the configuration of the port changed by update to the server.
+func (p *remotePort) reconfigure(update func(cfg *Config)) error {
+	if !p.rfc2217 {
+		return fmt.Errorf("failed to reconfigure port: %w", errors.ErrUnsupported)
+	}
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	cfg := p.cfg
+	update(&cfg)
+	if err := p.configure(cfg); err != nil {
+		return fmt.Errorf("failed to reconfigure port: %w", err)
+	}
+	p.cfg = cfg
+	return nil
+}
+
+// Events implements Port
+func (p *remotePort) Events() <-chan Event {
+	return p.events.start(p, p.Status)
+}
+
+// waitData waits until there is data to read, without reading it.
+func (p *remotePort) waitData(done <-chan struct{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		switch {
+		case p.closed:
+			return os.ErrClosed
+		case len(p.data) > 0:
+			return nil
+		case p.readErr != nil:
+			return p.readErr
+		}
+		p.wait(time.Time{})
+	}
+}
+
+// command sends a COM port control command with the value to the server.
+func (p *remotePort) command(cmd byte, value ...byte) error {
+	if !p.rfc2217 {
+		return errors.ErrUnsupported
+	}
+	msg := []byte{telnetIAC, telnetSB, comPortOption, cmd}
+	msg = append(msg, escapeIAC(value)...)
+	msg = append(msg, telnetIAC, telnetSE)
+	return p.writeRaw(msg)
+}
+
+// writeRaw writes buf to the connection as is.
+func (p *remotePort) writeRaw(buf []byte) error {
+	_, err := p.writeConn(buf, time.Time{})
+	return err
+}
+
+// writeConn writes buf to the connection until deadline, or the write deadline of the port if it is zero.
+func (p *remotePort) writeConn(buf []byte, deadline time.Time) (int, error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	p.mu.Lock()
+	closed := p.closed
+	if deadline.IsZero() {
+		deadline = p.writeDeadline
+	}
+	p.mu.Unlock()
+	if closed {
+		return 0, os.ErrClosed
+	}
+	if err := p.conn.SetWriteDeadline(deadline); err != nil {
+		return 0, err
+	}
+	n, err := p.conn.Write(buf)
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, p.monitor.report(err)
+	}
+	return n, err
+}
+
+// readLoop receives the data and the Telnet commands from the server, until the connection ends.
+func (p *remotePort) readLoop() {
+	buf := make([]byte, 4096)
+	for {
+		p.mu.Lock()
+		for !p.closed && len(p.data) >= maxRemoteBuffer {
+			p.wait(time.Time{})
+		}
+		p.mu.Unlock()
+
+		n, err := p.conn.Read(buf)
+		ts := time.Now()
+
+		p.mu.Lock()
+		if len(p.data) == 0 {
+			p.dataTime = ts
+		}
+		var replies []byte
+		if p.rfc2217 {
+			for _, c := range buf[:n] {
+				replies = p.parse(c, replies)
+			}
+		} else {
+			p.data = append(p.data, buf[:n]...)
+		}
+		if err != nil {
+			if p.closed {
+				err = os.ErrClosed
+			} else {
+				err = p.monitor.report(err)
+			}
+			p.readErr = err
+		}
+		p.notify()
+		p.mu.Unlock()
+
+		if len(replies) > 0 {
+			p.writeRaw(replies)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parse handles the next byte c received from the server, and appends the replies to the Telnet
+// commands to replies. Must be called with mu held.
+func (p *remotePort) parse(c byte, replies []byte) []byte {
+	switch p.telnetState {
+	case telnetData:
+		if c == telnetIAC {
+			p.telnetState = telnetCommand
+		} else {
+			p.data = append(p.data, c)
+		}
+	case telnetCommand:
+		switch c {
+		case telnetIAC:
+			p.data = append(p.data, c)
+			p.telnetState = telnetData
+		case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+			p.telnetCmd = c
+			p.telnetState = telnetOption
+		case telnetSB:
+			p.sb = p.sb[:0]
+			p.telnetState = telnetSubneg
+		default:
+			// NOP, GA and the other commands without an option.
+			p.telnetState = telnetData
+		}
+	case telnetOption:
+		replies = p.option(p.telnetCmd, c, replies)
+		p.telnetState = telnetData
+	case telnetSubneg:
+		if c == telnetIAC {
+			p.telnetState = telnetSubnegIAC
+		} else {
+			p.sb = append(p.sb, c)
+		}
+	case telnetSubnegIAC:
+		switch c {
+		case telnetIAC:
+			p.sb = append(p.sb, c)
+			p.telnetState = telnetSubneg
+		case telnetSE:
+			p.subnegotiation(p.sb)
+			p.telnetState = telnetData
+		default:
+			// A malformed subnegotiation, drop it.
+			p.telnetState = telnetData
+		}
+	}
+	return replies
+}
+
+// option handles the negotiation of the option opt. It only answers the requests
+// which change the state of the option, so the negotiation does not loop.
+func (p *remotePort) option(cmd, opt byte, replies []byte) []byte {
+	switch cmd {
+	case telnetDO, telnetDONT:
+		if opt == comPortOption {
+			if cmd == telnetDO {
+				p.comPort = 1
+			} else {
+				p.comPort = -1
+			}
+		}
+		want := cmd == telnetDO && (opt == telnetBinary || opt == telnetSGA || opt == comPortOption)
+		if sent, ok := p.willSent[opt]; !ok || sent != want {
+			p.willSent[opt] = want
+			reply := byte(telnetWONT)
+			if want {
+				reply = telnetWILL
+			}
+			replies = append(replies, telnetIAC, reply, opt)
+		}
+	case telnetWILL, telnetWONT:
+		want := cmd == telnetWILL && (opt == telnetBinary || opt == telnetSGA)
+		if sent, ok := p.doSent[opt]; !ok || sent != want {
+			p.doSent[opt] = want
+			reply := byte(telnetDONT)
+			if want {
+				reply = telnetDO
+			}
+			replies = append(replies, telnetIAC, reply, opt)
+		}
+	}
+	return replies
+}
+
+// subnegotiation handles a complete subnegotiation sb, without IAC SB and IAC SE.
+func (p *remotePort) subnegotiation(sb []byte) {
+	if len(sb) < 3 || sb[0] != comPortOption {
+		return
+	}
+	switch sb[1] {
+	case comNotifyModemState:
+		p.modemState = sb[2]
+	}
+	// The other commands acknowledge the settings, which are not checked.
+}
+
+// notify wakes up all the calls waiting for a change of the state. Must be called with mu held.
+func (p *remotePort) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// wait releases mu until the state changes or until the time t, if not zero.
+func (p *remotePort) wait(t time.Time) {
+	changed := p.changed
+	p.mu.Unlock()
+	defer p.mu.Lock()
+	if t.IsZero() {
+		<-changed
+		return
+	}
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-changed:
+	case <-timer.C:
+	}
+}
+
+// unescapedLen returns the number of bytes of buf sent, once n bytes of escapeIAC(buf) are written.
+func unescapedLen(buf []byte, n int) int {
+	for i, c := range buf {
+		w := 1
+		if c == telnetIAC {
+			w = 2
+		}
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(buf)
+}
+
+// escapeIAC doubles the IAC bytes of buf, which would start Telnet commands otherwise.
+func escapeIAC(buf []byte) []byte {
+	out := make([]byte, 0, len(buf))
+	for _, c := range buf {
+		out = append(out, c)
+		if c == telnetIAC {
+			out = append(out, telnetIAC)
+		}
+	}
+	return out
+}
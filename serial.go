@@ -1,241 +1,441 @@
 package serial
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"io"
-	"os"
+	"io/fs"
+	"strings"
 	"syscall"
-	"unsafe"
+	"time"
 )
 
 // Port describes an opened serial port.
+//
+// A Port is safe for concurrent use by multiple goroutines, typically one reading and others writing.
+// Every Write is atomic: the data of concurrent Writes is never interleaved, even when a Write
+// takes several system calls, like with Config.PaceWrites. Concurrent Reads are safe too,
+// but which one gets which data is undefined. The other methods may be called at any time.
+//
+// Close may be called while other goroutines are blocked in Read or Write:
+// those calls are unblocked and return an error. Close may be called more than once,
+// and concurrently; the calls after the first one return an error wrapping os.ErrClosed.
 type Port interface {
 	io.ReadWriteCloser
-}
 
-// Open opens a serial port with the specified name (like, /dev/ttyUSB0) and baud rate.
-// It will create a raw, local, 8N1 serial connection.
-func Open(name string, baud int) (Port, error) {
-	f, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if err != nil {
-			f.Close()
-		}
-	}()
-	tio := newRaw()
-	if baud == 250000 {
-		var ss serial_struct
-		fmt.Fprintf(os.Stderr, "sizeof(ss): %d\n", unsafe.Sizeof(ss))
-		if err = ioctlSS(f.Fd(), syscall.TIOCGSERIAL, &ss); err != nil {
-			return nil, fmt.Errorf("failed to request serial_struct: %v", err)
-		}
-		ss.flags &= ^ASYNC_SPD_MASK
-		ss.flags |= ASYNC_SPD_CUST
-		ss.custom_divisor = uint32((int(ss.baud_base) + (baud / 2)) / baud)
-		if ss.custom_divisor < 1 {
-			ss.custom_divisor = 1
-		}
-		if err = ioctlSS(f.Fd(), syscall.TIOCSSERIAL, &ss); err != nil {
-			return nil, fmt.Errorf("failed to set custom baud rate: %v", err)
-		}
-		if err = ioctlSS(f.Fd(), syscall.TIOCSSERIAL, &ss); err != nil {
-			return nil, fmt.Errorf("failed to set custom baud rate (second pass): %v", err)
-		}
-		if err = tio.setSpeed(B38400); err != nil {
-			return nil, err
-		}
-	} else {
-		br, err := convRate(baud)
-		if err != nil {
-			return nil, err
-		}
+	// ReadTimestamped is like Read, and also returns the time the data was received.
+	// The kernel does not timestamp the input of the ttys, like it does for the sockets,
+	// so the time is taken as close to the reception as possible: right after the read system call
+	// on Linux, macOS and the BSDs, before the goroutine waits to be scheduled again, and on Windows
+	// once the read completes. For the data gathered by several reads, like with Config.InterByteTimeout,
+	// or buffered before, like by a BufferedPort or a network device server, it is the time of the first part.
+	// The time has a monotonic reading, for measuring the intervals between the data.
+	ReadTimestamped(buf []byte) (n int, ts time.Time, err error)
 
-		if err = tio.setSpeed(br); err != nil {
-			return nil, err
-		}
-	}
-	if err = tio.apply(f.Fd()); err != nil {
-		return nil, err
-	}
-	tio2, err := query(f.Fd())
-	if err != nil {
-		return nil, fmt.Errorf("failed to query serial attributes: %v", err)
-	}
-	if tio.speed() != tio2.speed() && baud != 250000 {
-		return nil, fmt.Errorf("failed to set baud rate. Want: %d, got: %d", tio.speed(), tio2.speed())
-	}
+	// SetReadDeadline sets the deadline for future Read calls and any
+	// currently-blocked Read call. A zero value for t means Read will not time out.
+	// A Read that times out returns an error for which os.IsTimeout reports true.
+	SetReadDeadline(t time.Time) error
 
-	return &port{f: f}, nil
-}
+	// SetWriteDeadline sets the deadline for future Write calls and any
+	// currently-blocked Write call, like one stalled by the flow control. A zero value for t
+	// means Write will not time out. A Write that times out returns a *WriteTimeoutError.
+	SetWriteDeadline(t time.Time) error
 
-// port represents an opened serial connection.
-type port struct {
-	f *os.File
-}
+	// SetDTR sets the state of the DTR (Data Terminal Ready) line.
+	SetDTR(on bool) error
+
+	// SetRTS sets the state of the RTS (Request To Send) line.
+	SetRTS(on bool) error
+
+	// Status returns the state of the modem status lines.
+	Status() (ModemStatus, error)
+
+	// Drain waits until all data written to the port has been transmitted.
+	Drain() error
+
+	// ResetInput discards the data received but not yet read.
+	ResetInput() error
 
-// Read implements io.Reader
-func (p *port) Read(buf []byte) (int, error) { return p.f.Read(buf) }
-
-// Write implements io.Writer
-func (p *port) Write(buf []byte) (int, error) { return p.f.Write(buf) }
-
-// Close implements io.Closer
-func (p *port) Close() error { return p.f.Close() }
-
-var knownRates = map[int]uint32{
-	50:      B50,
-	75:      B75,
-	110:     B110,
-	134:     B134,
-	150:     B150,
-	200:     B200,
-	300:     B300,
-	600:     B600,
-	1200:    B1200,
-	1800:    B1800,
-	2400:    B2400,
-	4800:    B4800,
-	9600:    B9600,
-	19200:   B19200,
-	38400:   B38400,
-	57600:   B57600,
-	115200:  B115200,
-	230400:  B230400,
-	460800:  B460800,
-	500000:  B500000,
-	576000:  B576000,
-	921600:  B921600,
-	1000000: B1000000,
-	1152000: B1152000,
-	1500000: B1500000,
-	2000000: B2000000,
-	2500000: B2500000,
-	3000000: B3000000,
-	3500000: B3500000,
-	4000000: B4000000,
+	// ResetOutput discards the data written but not yet transmitted.
+	ResetOutput() error
+
+	// Break holds the transmit line in the break condition (continuous spacing) for d.
+	// A common duration is 250ms, which tcsendbreak uses.
+	Break(d time.Duration) error
+
+	// SendXON and SendXOFF send the XON and XOFF characters of Config.SoftwareFlow, like tcflow,
+	// to resume and to pause a device which honors them, like a chatty one the program needs to stop.
+	// On Linux and Windows they are sent ahead of the output which is not transmitted yet.
+	SendXON() error
+	SendXOFF() error
+
+	// Stats returns the counters of the port.
+	Stats() (Stats, error)
+
+	// SetBaudRate, SetDataBits, SetParity, SetStopBits and SetFlowControl change
+	// the parameters of the open port, like the fields of Config do on Open.
+	// The data written before is transmitted with the old parameters first,
+	// and the data received but not read yet is kept.
+	SetBaudRate(baud int) error
+	SetDataBits(bits int) error
+	SetParity(parity Parity) error
+	SetStopBits(stopBits StopBits) error
+	SetFlowControl(fc FlowControl) error
+
+	// Events returns the channel of the events of the port, which lets a program
+	// select on several ports instead of blocking a goroutine in Read for each one.
+	// The events are produced from the first call on; the later calls return the same channel.
+	// The channel is closed after the port is closed.
+	Events() <-chan Event
+
+	// Config returns the configuration of the port, with the changes made by the Set methods above.
+	Config() Config
+
+	// SaveState takes a snapshot of the settings of the port, like the termios on Unix,
+	// which RestoreState puts back later, once the previously written data is sent.
+	// The modem lines are not part of the state.
+	SaveState() (*State, error)
+	RestoreState(s *State) error
+
+	// SyscallConn returns a raw connection to the descriptor of the port, the file descriptor
+	// on Unix or the handle on Windows, for the ioctls of the drivers which this package does not cover,
+	// like the GPIOs of some USB adapters. It implements syscall.Conn. The ports of network
+	// device servers have no descriptor, and fail with an error wrapping errors.ErrUnsupported.
+	SyscallConn() (syscall.RawConn, error)
+
+	// Fd returns the descriptor of the port, or ^uintptr(0) if it has none. Unlike os.File.Fd,
+	// it leaves the descriptor non-blocking, as the port needs it, so do not change that.
+	// The descriptor is only valid until the port is closed, which SyscallConn guards against.
+	Fd() uintptr
 }
 
-// convRate converts numerical rate into the baud rate code, like B115200.
-func convRate(baud int) (uint32, error) {
-	v, ok := knownRates[baud]
-	if !ok {
-		return 0, fmt.Errorf("unsupported baud rate: %v", baud)
-	}
-	return v, nil
+// ModemStatus is the state of the modem status lines of a serial port.
+type ModemStatus struct {
+	CTS bool // Clear To Send
+	DSR bool // Data Set Ready
+	DCD bool // Data Carrier Detect
+	RI  bool // Ring Indicator
 }
 
-// termios is a low-level structure that Linux kernel will understand.
-type termios struct {
-	iflag   uint32
-	oflag   uint32
-	cflag   uint32
-	lflag   uint32
-	line    byte
-	cc      [32]byte
-	unused0 uint32
-	unused1 uint32
+// Config describes the parameters of a serial connection.
+type Config struct {
+	// BaudRate is the speed of the line, like 115200.
+	BaudRate int
+
+	// ReadTimeout, if positive, limits the time a single Read call waits for data.
+	// It takes precedence over deadlines set with SetReadDeadline.
+	// Zero means Read blocks until at least one byte is received.
+	ReadTimeout time.Duration
+
+	// WriteTimeout, if positive, limits the time a single Write call waits for the system
+	// to take the data, like while the flow control holds the output, or the device
+	// does not drain it. It takes precedence over deadlines set with SetWriteDeadline.
+	// Zero means Write blocks until all the data is written.
+	WriteTimeout time.Duration
+
+	// InterByteTimeout, if positive, makes Read keep reading after the first bytes,
+	// until the buffer is full or no byte arrives for this long, like VTIME of termios.
+	// A single Read then returns a frame of the protocols which end the frames with
+	// the silence of the line. ReadTimeout, or the read deadline, still limits the whole Read.
+	InterByteTimeout time.Duration
+
+	// DataBits is the number of data bits of a character, from 5 to 8.
+	// Zero means 8.
+	DataBits int
+
+	// Parity selects the parity bit of a character. The default is ParityNone.
+	Parity Parity
+
+	// StopBits selects the number of stop bits of a character. The default is OneStopBit.
+	StopBits StopBits
+
+	// FlowControl selects the flow control used on the line.
+	// The default is FlowNone.
+	FlowControl FlowControl
+
+	// SoftwareFlow configures the XON/XOFF flow control of FlowSoftware: its characters,
+	// and the directions it pauses. The zero value uses DC1 and DC3, in both directions.
+	SoftwareFlow SoftwareFlowConfig
+
+	// OnDisconnect, if not nil, is called once, on its own goroutine, when
+	// the device behind the port goes away. The error wraps ErrPortDisconnected.
+	// The disconnection is detected both from failing Read and Write calls,
+	// and by checking the modem lines of the port every second.
+	OnDisconnect func(err error)
+
+	// Exclusive, if true, prevents other processes from opening the port while it is open,
+	// with TIOCEXCL. Their Open fails with ErrPortBusy. Note that it does not stop the root user.
+	// On Windows, ports are always opened exclusively.
+	Exclusive bool
+
+	// LockDir, if not empty, is the directory (like /var/lock) where a UUCP style lock file
+	// LCK..<device> is created for the port, to cooperate with other programs using the same convention.
+	// If the port is locked by a running process, Open fails with ErrPortBusy.
+	// Lock files are not used on Windows.
+	LockDir string
+
+	// WaitForDevice, if true, makes Open wait until the device appears, instead of failing
+	// when it does not exist, like for a USB adapter which is not plugged in yet.
+	// OpenContext stops waiting once its context is done, the other functions wait indefinitely.
+	// See WaitForDevice.
+	WaitForDevice bool
+
+	// RestoreOnClose, if true, saves the settings of the port before they are changed by Open,
+	// and restores them on Close. That lets a program borrow a port used by others,
+	// like the console of a getty, without changing it for good.
+	// The ports of network device servers do not support it.
+	RestoreOnClose bool
+
+	// MarkErrors, if true, checks the parity of the received characters, and marks
+	// the characters received with a parity or a framing error, as well as the breaks,
+	// in the input, instead of replacing them with zeros. Read the input with MarkedReader.
+	// It is only supported on Linux, macOS and the BSDs.
+	MarkErrors bool
+
+	// LowLatency, if true, sets the low_latency flag of the tty, and the latency timer
+	// of its USB adapter, like an FTDI one, to 1 ms. The adapters buffer the input for 16 ms by default,
+	// which slows down the request/response protocols. The latency timer is only set if the user
+	// may write it, which usually needs root or a udev rule; see SetLatencyTimer.
+	// It is only supported on Linux.
+	LowLatency bool
+
+	// PaceWrites, if true, makes Write pass the data to the system in small chunks,
+	// no faster than the characters are transmitted at PaceBaudRate, or at the baud rate
+	// of the port if it is zero. It helps the slow devices without flow control,
+	// which lose the data sent in a burst. A PaceBaudRate lower than the baud rate
+	// leaves pauses between the chunks.
+	PaceWrites   bool
+	PaceBaudRate int
+
+	// Trace, if not nil, is called with all the data read from and written to the port.
+	// See HexdumpTrace.
+	Trace TraceFunc
+
+	// Metrics, if not nil, receives the measurements of the port, like the bytes transferred and the errors.
+	// See package metrics.
+	Metrics Metrics
+
+	// IdleTimeout, if positive, watches for the periods without input: once no data has been read
+	// for IdleTimeout, OnIdle is called with how long the input has been idle, and KeepAlive is written,
+	// like a poll frame making a sensor answer, or a probe keeping a link up. Both repeat every IdleTimeout
+	// while no data is read. OnIdle is called from a goroutine of the port, and the next check waits for it.
+	IdleTimeout time.Duration
+	OnIdle      func(idle time.Duration)
+	KeepAlive   []byte
+
+	// RS485 configures the RS-485 mode of the UART, which is only supported on Linux.
+	RS485 RS485Config
+
+	// Console configures the line discipline of the system for the interactive consoles
+	// of the devices, like routers or U-Boot, instead of the raw mode.
+	// It is only supported on Linux, macOS and the BSDs. See also Terminal.
+	Console ConsoleConfig
 }
 
-type serial_struct struct {
-	typ             uint32
-	line            uint32
-	port            uint32
-	irq             uint32
-	flags           int32
-	xmit_fifo_size  uint32
-	custom_divisor  uint32
-	baud_base       uint32
-	close_delay     uint16
-	io_type         byte
-	reserved_char   byte
-	hub6            int
-	closing_wait    uint16
-	closing_wait2   uint16
-	iomem_base      uintptr
-	iomem_reg_shift uint16
-	port_high       uint32
-	iomap_base      int64
+// ConsoleConfig describes the processing of the input and the output of a port by the system,
+// for talking to an interactive console. The zero value keeps the port raw.
+type ConsoleConfig struct {
+	// Canonical turns the canonical mode on: the input is edited line by line,
+	// with the erase (DEL) and kill (Ctrl-U) characters, and Read returns a whole line
+	// once its newline is received. Ctrl-D ends a line without its newline; at the start of a line,
+	// it makes Read return io.EOF, rather than ErrPortDisconnected, and the port can still be read
+	// after that. The disconnections are still reported to Config.OnDisconnect, and by Write.
+	Canonical bool
+
+	// CRToNL translates the received carriage returns into newlines (ICRNL),
+	// for the consoles ending their lines with CR.
+	CRToNL bool
+
+	// NLToCRNL translates the written newlines into CR LF (ONLCR).
+	NLToCRNL bool
+
+	// Echo sends the received characters back to the device (ECHO).
+	Echo bool
 }
 
-func newRaw() *termios {
-	return &termios{
-		cflag: CS8 | CLOCAL | CREAD | HUPCL,
-		cc:    [32]byte{VMIN: 1, VTIME: 0},
-	}
+// SoftwareFlowConfig describes the XON/XOFF flow control of a port with FlowSoftware.
+type SoftwareFlowConfig struct {
+	// XON and XOFF are the characters which restart and stop the transmission (VSTART and VSTOP).
+	// Zero means DC1 (Ctrl-Q, 0x11) and DC3 (Ctrl-S, 0x13). They are also the ones SendXON and SendXOFF send,
+	// whatever the flow control.
+	XON  byte
+	XOFF byte
+
+	// Direction selects which transmissions the characters pause. The default is FlowBoth.
+	Direction FlowDirection
+
+	// RestartOnAny, if true, restarts the output stopped by XOFF on any character received,
+	// not only on XON (IXANY). It is not supported on Windows, nor by the network device servers.
+	RestartOnAny bool
 }
 
-func (tio *termios) setSpeed(baud uint32) error {
-	if (baud & ^uint32(CBAUD)) != 0 {
-		return fmt.Errorf("setSpeed: baud=%0x, does not fit to mask: %0x", baud, CBAUD)
+// chars returns the XON and XOFF characters of c.
+func (c SoftwareFlowConfig) chars() (on, off byte) {
+	on, off = c.XON, c.XOFF
+	if on == 0 {
+		on = xon
+	}
+	if off == 0 {
+		off = xoff
 	}
-	tio.cflag &= ^uint32(CBAUD)
-	tio.cflag |= baud
-	return nil
+	return on, off
 }
 
-func (tio *termios) speed() uint32 {
-	return tio.cflag & CBAUD
+// FlowDirection selects the transmissions paused by the XON/XOFF flow control.
+type FlowDirection int
+
+const (
+	// FlowBoth pauses the transmission in both directions.
+	FlowBoth FlowDirection = iota
+	// FlowOutput pauses the output of the port once the device sends XOFF, until it sends XON (IXON).
+	FlowOutput
+	// FlowInput makes the port send XOFF to the device once its input buffer fills up,
+	// and XON once it has room again (IXOFF).
+	FlowInput
+)
+
+// enabled reports whether c changes the raw mode.
+func (c ConsoleConfig) enabled() bool {
+	return c != ConsoleConfig{}
 }
 
-// apply sets serial attributes to the fd.
-func (tio *termios) apply(fd uintptr) error {
-	// TODO(krasin): may be also support TCSETSW
-	if err := ioctl(fd, TCSETSF, tio); err != nil {
-		return err
-	}
-	//if err := fcntl(fd, syscall.F_SETFL, 0); err != nil {
-	//	return err
-	//}
-	return nil
+// RS485Config describes the RS-485 mode of a UART, where the driver switches
+// the transceiver between sending and receiving with the RTS line.
+type RS485Config struct {
+	// Enabled turns the RS-485 mode on. If false, the mode of the port is left as is.
+	Enabled bool
+
+	// RTSOnSend is the level of RTS while sending, and RTSAfterSend the level after it.
+	RTSOnSend    bool
+	RTSAfterSend bool
+
+	// DelayRTSBeforeSend and DelayRTSAfterSend are the delays between setting RTS
+	// and sending, and after sending before setting RTS back. They are rounded down to milliseconds.
+	DelayRTSBeforeSend time.Duration
+	DelayRTSAfterSend  time.Duration
+
+	// RxDuringTx keeps the receiver enabled while sending, like with a full-duplex transceiver.
+	RxDuringTx bool
 }
 
-// query gets serial attributes from the fd.
-func query(fd uintptr) (*termios, error) {
-	tio := new(termios)
-	if err := ioctl(fd, TCGETS, tio); err != nil {
-		return nil, err
+// Parity is the kind of parity bit sent after the data bits of a character.
+type Parity int
+
+const (
+	// ParityNone sends no parity bit.
+	ParityNone Parity = iota
+	// ParityOdd makes the number of ones in the character odd.
+	ParityOdd
+	// ParityEven makes the number of ones in the character even.
+	ParityEven
+	// ParityMark always sends the parity bit as 1. It marks the address characters
+	// of the 9-bit multi-drop protocols, see WriteAddressed.
+	// It is not supported on macOS and the BSDs.
+	ParityMark
+	// ParitySpace always sends the parity bit as 0, like for the data of the 9-bit protocols.
+	// It is not supported on macOS and the BSDs.
+	ParitySpace
+)
+
+// StopBits is the number of stop bits which end a character.
+type StopBits int
+
+const (
+	OneStopBit StopBits = iota
+	TwoStopBits
+)
+
+// FlowControl is the kind of flow control used on a serial line.
+type FlowControl int
+
+const (
+	// FlowNone disables flow control.
+	FlowNone FlowControl = iota
+	// FlowHardware uses the RTS/CTS handshake lines.
+	FlowHardware
+	// FlowSoftware uses the XON/XOFF characters sent in-band.
+	FlowSoftware
+)
+
+// Characters used by software flow control.
+const (
+	xon  = 0x11
+	xoff = 0x13
+)
+
+// dataBits returns the number of data bits configured by cfg.
+func (cfg *Config) dataBits() int {
+	if cfg.DataBits == 0 {
+		return 8
 	}
-	return tio, nil
+	return cfg.DataBits
 }
 
-func rawFcntl(fd uintptr, cmd int, arg uintptr) error {
-	_, _, err := syscall.RawSyscall(syscall.SYS_FCNTL, fd, uintptr(cmd), arg)
-	if err != 0 {
-		return err
-	}
-	return nil
+// Open opens a serial port with the specified name (like, /dev/ttyUSB0 or COM3) and baud rate.
+// It will create a raw, local, 8N1 serial connection.
+func Open(name string, baud int) (Port, error) {
+	return OpenWithConfig(name, Config{BaudRate: baud})
 }
 
-func fcntl(fd uintptr, cmd int, arg int) error {
-	return rawFcntl(fd, cmd, uintptr(arg))
+// OpenWithConfig opens a serial port with the specified name (like, /dev/ttyUSB0 or COM3)
+// and configures it as described by cfg.
+//
+// The names like rfc2217://host:port and tcp://host:port open the ports of network device servers,
+// as described by OpenRemote.
+func OpenWithConfig(name string, cfg Config) (Port, error) {
+	return open(context.Background(), name, cfg)
 }
 
-func rawIoctl(fd uintptr, req uint, arg uintptr) error {
-	_, _, err := syscall.RawSyscall(syscall.SYS_IOCTL, fd, uintptr(req), arg)
-	if err != 0 {
-		return err
+// open opens the port like OpenWithConfig, waiting for the device until ctx is done,
+// if cfg asks for it.
+func open(ctx context.Context, name string, cfg Config) (Port, error) {
+	p, err := openDevice(ctx, name, cfg)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return wrap(p, name, cfg), nil
 }
 
-func ioctl(fd uintptr, req uint, tio *termios) error {
-	return rawIoctl(fd, req, uintptr(unsafe.Pointer(tio)))
+// wrap adds the features of cfg implemented on top of the ports, like Trace, to the port p opened as name.
+func wrap(p Port, name string, cfg Config) Port {
+	return idled(metered(traced(paced(gapped(p, cfg), cfg), cfg.Trace), name, cfg.Metrics), cfg)
 }
 
-func ioctlSS(fd uintptr, req uint, ss *serial_struct) error {
-	return rawIoctl(fd, req, uintptr(unsafe.Pointer(ss)))
+// device returns the configuration of the port to wrap.
+func (cfg *Config) device() Config {
+	c := *cfg
+	if c.InterByteTimeout > 0 {
+		// The whole Read is limited by gapped.
+		c.ReadTimeout = 0
+	}
+	if c.PaceWrites {
+		// The whole Write is limited by paced.
+		c.WriteTimeout = 0
+	}
+	return c
 }
 
-const (
-	ASYNCB_SPD_HI  = 4  /* Use 57600 instead of 38400 bps */
-	ASYNCB_SPD_VHI = 5  /* Use 115200 instead of 38400 bps */
-	ASYNCB_SPD_SHI = 12 /* Use 230400 instead of 38400 bps */
-	ASYNC_SPD_HI   = (1 << ASYNCB_SPD_HI)
-	ASYNC_SPD_SHI  = (1 << ASYNCB_SPD_SHI)
-	ASYNC_SPD_VHI  = (1 << ASYNCB_SPD_VHI)
-	ASYNC_SPD_CUST = (ASYNC_SPD_HI | ASYNC_SPD_VHI)
-	ASYNC_SPD_MASK = (ASYNC_SPD_HI | ASYNC_SPD_VHI | ASYNC_SPD_SHI)
-)
+// openDevice opens the local or the remote port name.
+func openDevice(ctx context.Context, name string, cfg Config) (Port, error) {
+	cfg = cfg.device()
+	if addr, ok := strings.CutPrefix(name, "rfc2217://"); ok {
+		return openRemote(addr, cfg, true)
+	}
+	if addr, ok := strings.CutPrefix(name, "tcp://"); ok {
+		return openRemote(addr, cfg, false)
+	}
+	for {
+		if cfg.WaitForDevice {
+			if err := WaitForDevice(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+		p, err := openPort(name, cfg)
+		if cfg.WaitForDevice && errors.Is(err, fs.ErrNotExist) {
+			// The device went away again before it was opened.
+			continue
+		}
+		return p, err
+	}
+}
@@ -0,0 +1,276 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// fionread is FIONREAD, _IOR('f', 127, int), which returns the number of bytes in the input queue.
+const fionread = 0x4004667f
+
+// Queues of TIOCFLUSH, FREAD and FWRITE from sys/fcntl.h.
+const (
+	fread  = 0x1
+	fwrite = 0x2
+)
+
+// configure puts the serial line behind fd into raw mode with the parameters from cfg.
+// If drain is true, the parameters are changed once the pending output is transmitted,
+// and the pending input is kept. Otherwise, both are discarded.
+func configure(fd uintptr, cfg Config, drain bool) error {
+	baud := cfg.BaudRate
+	if cfg.RS485.Enabled {
+		return fmt.Errorf("RS-485 mode: %w", errors.ErrUnsupported)
+	}
+	if baud <= 0 {
+		return fmt.Errorf("%w: %v", ErrUnsupportedBaudRate, baud)
+	}
+	tio, err := queryBSD(fd)
+	if err != nil {
+		return fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	makeRaw(tio)
+	tio.Cflag &^= syscall.CSIZE
+	switch cfg.dataBits() {
+	case 5:
+		tio.Cflag |= syscall.CS5
+	case 6:
+		tio.Cflag |= syscall.CS6
+	case 7:
+		tio.Cflag |= syscall.CS7
+	case 8:
+		tio.Cflag |= syscall.CS8
+	default:
+		return fmt.Errorf("unsupported data bits: %v", cfg.DataBits)
+	}
+	switch cfg.Parity {
+	case ParityNone:
+	case ParityOdd:
+		tio.Cflag |= syscall.PARENB | syscall.PARODD
+	case ParityEven:
+		tio.Cflag |= syscall.PARENB
+	case ParityMark, ParitySpace:
+		// There is no CMSPAR in the BSD termios.
+		return fmt.Errorf("mark and space parity: %w", errors.ErrUnsupported)
+	default:
+		return fmt.Errorf("unsupported parity: %v", cfg.Parity)
+	}
+	switch cfg.StopBits {
+	case OneStopBit:
+	case TwoStopBits:
+		tio.Cflag |= syscall.CSTOPB
+	default:
+		return fmt.Errorf("unsupported stop bits: %v", cfg.StopBits)
+	}
+	// The characters are set whatever the flow control, for SendXON and SendXOFF.
+	tio.Cc[syscall.VSTART], tio.Cc[syscall.VSTOP] = cfg.SoftwareFlow.chars()
+	switch cfg.FlowControl {
+	case FlowNone:
+	case FlowHardware:
+		tio.Cflag |= crtscts
+	case FlowSoftware:
+		switch cfg.SoftwareFlow.Direction {
+		case FlowBoth:
+			tio.Iflag |= syscall.IXON | syscall.IXOFF
+		case FlowOutput:
+			tio.Iflag |= syscall.IXON
+		case FlowInput:
+			tio.Iflag |= syscall.IXOFF
+		default:
+			return fmt.Errorf("unsupported flow direction: %v", cfg.SoftwareFlow.Direction)
+		}
+		if cfg.SoftwareFlow.RestartOnAny {
+			tio.Iflag |= syscall.IXANY
+		}
+	default:
+		return fmt.Errorf("unsupported flow control: %v", cfg.FlowControl)
+	}
+	if cfg.MarkErrors {
+		tio.Iflag |= syscall.INPCK | syscall.PARMRK
+	}
+	setConsole(tio, cfg.Console)
+	speed := baud
+	if needSpeedIoctl(baud) {
+		// The termios speed is only a placeholder, the actual rate is set below.
+		speed = 9600
+	}
+	setSpeed(&tio.Ispeed, speed)
+	setSpeed(&tio.Ospeed, speed)
+	if drain {
+		err = blockingIoctl(fd, syscall.TIOCSETAW, uintptr(unsafe.Pointer(tio)))
+	} else {
+		err = ioctlBSD(fd, syscall.TIOCSETAF, tio)
+	}
+	if err != nil {
+		return err
+	}
+	if speed != baud {
+		if err := setSpeedIoctl(fd, baud); err != nil {
+			return fmt.Errorf("%w %d: %w", ErrUnsupportedBaudRate, baud, err)
+		}
+		return nil
+	}
+	tio2, err := queryBSD(fd)
+	if err != nil {
+		return fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	if int(tio2.Ospeed) != baud {
+		return fmt.Errorf("%w. Want: %d, got: %d", ErrBaudMismatch, baud, tio2.Ospeed)
+	}
+	return nil
+}
+
+// makeRaw sets tio to a raw, local, 8N1 mode, where each Read returns as soon as
+// at least one byte is available.
+func makeRaw(tio *syscall.Termios) {
+	tio.Iflag = 0
+	tio.Oflag = 0
+	tio.Lflag = 0
+	tio.Cflag = syscall.CS8 | syscall.CLOCAL | syscall.CREAD | syscall.HUPCL
+	tio.Cc[syscall.VMIN] = 1
+	tio.Cc[syscall.VTIME] = 0
+}
+
+// setConsole sets the processing of the input and the output described by c.
+func setConsole(tio *syscall.Termios, c ConsoleConfig) {
+	if c.Canonical {
+		tio.Lflag |= syscall.ICANON
+		tio.Cc[syscall.VERASE] = 0x7f
+		tio.Cc[syscall.VKILL] = 0x15
+		tio.Cc[syscall.VEOF] = 0x04
+		tio.Cc[syscall.VEOL] = 0xff
+	}
+	if c.CRToNL {
+		tio.Iflag |= syscall.ICRNL
+	}
+	if c.NLToCRNL {
+		tio.Oflag |= syscall.OPOST | syscall.ONLCR
+	}
+	if c.Echo {
+		tio.Lflag |= syscall.ECHO
+		if c.Canonical {
+			tio.Lflag |= syscall.ECHOE | syscall.ECHOK
+		}
+	}
+}
+
+// makeTerminalRaw switches the terminal behind fd to raw input, for Terminal,
+// and returns the function which restores it. The output is processed as before.
+func makeTerminalRaw(fd uintptr) (func(), error) {
+	tio, err := queryBSD(fd)
+	if err != nil {
+		return nil, err
+	}
+	saved := *tio
+	tio.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	tio.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	tio.Cc[syscall.VMIN] = 1
+	tio.Cc[syscall.VTIME] = 0
+	if err := ioctlBSD(fd, syscall.TIOCSETA, tio); err != nil {
+		return nil, err
+	}
+	return func() { ioctlBSD(fd, syscall.TIOCSETA, &saved) }, nil
+}
+
+// setSpeed stores baud into one of the speed fields of syscall.Termios,
+// which have different types across the BSDs. The BSDs use the numerical
+// rate as the speed code.
+func setSpeed[T ~int32 | ~uint32 | ~uint64](speed *T, baud int) {
+	*speed = T(baud)
+}
+
+// tcdrain waits until all output written to fd has been transmitted.
+func tcdrain(fd uintptr) error {
+	return blockingIoctl(fd, syscall.TIOCDRAIN, 0)
+}
+
+// tcflow sends the START character of fd (start == true) or the STOP one. Like tcflow of the libc,
+// it writes it, behind the output queue, since the BSDs have no ioctl for it.
+func tcflow(fd uintptr, start bool) error {
+	tio, err := queryBSD(fd)
+	if err != nil {
+		return err
+	}
+	c := tio.Cc[syscall.VSTOP]
+	if start {
+		c = tio.Cc[syscall.VSTART]
+	}
+	_, err = syscall.Write(int(fd), []byte{c})
+	return err
+}
+
+// tcflush discards the input (input == true) or the output queue of fd.
+func tcflush(fd uintptr, input bool) error {
+	var queue int32 = fwrite
+	if input {
+		queue = fread
+	}
+	return rawIoctl(fd, syscall.TIOCFLUSH, uintptr(unsafe.Pointer(&queue)))
+}
+
+// setLowLatency is not supported on the BSDs.
+func setLowLatency(fd uintptr, name string) error {
+	return errors.ErrUnsupported
+}
+
+// getSerialInfo is not supported on the BSDs.
+func getSerialInfo(fd uintptr) (SerialInfo, error) {
+	return SerialInfo{}, fmt.Errorf("serial info: %w", errors.ErrUnsupported)
+}
+
+// setSerialInfo is not supported on the BSDs.
+func setSerialInfo(fd uintptr, info SerialInfo) error {
+	return fmt.Errorf("serial info: %w", errors.ErrUnsupported)
+}
+
+// setLatencyTimer is not supported on the BSDs.
+func setLatencyTimer(name string, d time.Duration) error {
+	return fmt.Errorf("latency timer: %w", errors.ErrUnsupported)
+}
+
+// driverStats adds the counters of the driver to s. The BSDs do not report any.
+func driverStats(fd uintptr, s *Stats) error {
+	return nil
+}
+
+// sysState is the termios of a port, saved by Port.SaveState.
+type sysState struct {
+	tio *syscall.Termios
+}
+
+// saveState returns the termios of fd.
+func saveState(fd uintptr) (*sysState, error) {
+	tio, err := queryBSD(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	return &sysState{tio}, nil
+}
+
+// restoreState sets the termios of fd saved by saveState.
+// If drain is true, it waits for the output to be transmitted first.
+func restoreState(fd uintptr, s *sysState, drain bool) error {
+	if drain {
+		return blockingIoctl(fd, syscall.TIOCSETAW, uintptr(unsafe.Pointer(s.tio)))
+	}
+	return ioctlBSD(fd, syscall.TIOCSETA, s.tio)
+}
+
+// queryBSD gets serial attributes from the fd.
+func queryBSD(fd uintptr) (*syscall.Termios, error) {
+	tio := new(syscall.Termios)
+	if err := ioctlBSD(fd, syscall.TIOCGETA, tio); err != nil {
+		return nil, err
+	}
+	return tio, nil
+}
+
+func ioctlBSD(fd uintptr, req uint, tio *syscall.Termios) error {
+	return rawIoctl(fd, req, uintptr(unsafe.Pointer(tio)))
+}
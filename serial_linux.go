@@ -0,0 +1,610 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// configure puts the serial line behind fd into raw mode with the parameters from cfg.
+// If drain is true, the parameters are changed once the pending output is transmitted,
+// and the pending input is kept. Otherwise, both are discarded.
+func configure(fd uintptr, cfg Config, drain bool) error {
+	baud := cfg.BaudRate
+	tio := newRaw()
+	if err := tio.setFraming(cfg.dataBits(), cfg.Parity, cfg.StopBits); err != nil {
+		return err
+	}
+	if err := tio.setFlowControl(cfg.FlowControl, cfg.SoftwareFlow); err != nil {
+		return err
+	}
+	if cfg.MarkErrors {
+		tio.iflag |= INPCK | PARMRK
+	}
+	tio.setConsole(cfg.Console)
+	if cfg.RS485.Enabled {
+		if err := setRS485(fd, cfg.RS485); err != nil {
+			return fmt.Errorf("failed to set RS-485 mode: %w", err)
+		}
+	}
+	br, err := convRate(baud)
+	if err != nil {
+		return configureCustomRate(fd, tio, baud, drain)
+	}
+	if err = tio.setSpeed(br); err != nil {
+		return err
+	}
+	if err := tio.apply(fd, drain); err != nil {
+		return err
+	}
+	tio2, err := query(fd)
+	if err != nil {
+		return fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	if tio.speed() != tio2.speed() {
+		return fmt.Errorf("%w. Want: %d, got: %d", ErrBaudMismatch, tio.speed(), tio2.speed())
+	}
+	return nil
+}
+
+// baudTolerance is how far off, relative to the rate asked for, the baud rate set may be,
+// like when a driver rounds a custom rate to its divisors.
+const baudTolerance = 0.02
+
+// configureCustomRate applies tio with an arbitrary baud rate, which is passed
+// to the kernel as is with BOTHER. If the kernel does not support BOTHER,
+// the closest standard rate is used instead. The rate set is read back, and must be
+// within baudTolerance of baud.
+func configureCustomRate(fd uintptr, tio *termios, baud int, drain bool) error {
+	if baud <= 0 {
+		return fmt.Errorf("%w: %v", ErrUnsupportedBaudRate, baud)
+	}
+	t2 := tio.toTermios2()
+	t2.cflag &= ^uint32(CBAUD)
+	t2.cflag |= BOTHER
+	t2.ispeed = uint32(baud)
+	t2.ospeed = uint32(baud)
+	var err error
+	if drain {
+		err = blockingIoctl(fd, TCSETSW2, uintptr(unsafe.Pointer(t2)))
+	} else {
+		err = ioctl2(fd, TCSETS2, t2)
+	}
+	if err != nil {
+		if err := tio.setSpeed(closestRate(baud)); err != nil {
+			return err
+		}
+		if err := tio.apply(fd, drain); err != nil {
+			return err
+		}
+	}
+	got := new(termios2)
+	if err := ioctl2(fd, TCGETS2, got); err != nil {
+		return fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	if math.Abs(float64(got.ospeed)-float64(baud)) > baudTolerance*float64(baud) {
+		return fmt.Errorf("%w. Want: %d, got: %d", ErrBaudMismatch, baud, got.ospeed)
+	}
+	return nil
+}
+
+var knownRates = map[int]uint32{
+	50:      B50,
+	75:      B75,
+	110:     B110,
+	134:     B134,
+	150:     B150,
+	200:     B200,
+	300:     B300,
+	600:     B600,
+	1200:    B1200,
+	1800:    B1800,
+	2400:    B2400,
+	4800:    B4800,
+	9600:    B9600,
+	19200:   B19200,
+	38400:   B38400,
+	57600:   B57600,
+	115200:  B115200,
+	230400:  B230400,
+	460800:  B460800,
+	500000:  B500000,
+	576000:  B576000,
+	921600:  B921600,
+	1000000: B1000000,
+	1152000: B1152000,
+	1500000: B1500000,
+	2000000: B2000000,
+	2500000: B2500000,
+	3000000: B3000000,
+	3500000: B3500000,
+	4000000: B4000000,
+}
+
+// setRS485 enables the RS-485 mode of the UART.
+func setRS485(fd uintptr, cfg RS485Config) error {
+	rs := serial_rs485{
+		flags:                 SER_RS485_ENABLED,
+		delay_rts_before_send: uint32(cfg.DelayRTSBeforeSend / time.Millisecond),
+		delay_rts_after_send:  uint32(cfg.DelayRTSAfterSend / time.Millisecond),
+	}
+	if cfg.RTSOnSend {
+		rs.flags |= SER_RS485_RTS_ON_SEND
+	}
+	if cfg.RTSAfterSend {
+		rs.flags |= SER_RS485_RTS_AFTER_SEND
+	}
+	if cfg.RxDuringTx {
+		rs.flags |= SER_RS485_RX_DURING_TX
+	}
+	return rawIoctl(fd, TIOCSRS485, uintptr(unsafe.Pointer(&rs)))
+}
+
+// standardRates are the rates of knownRates, in increasing order.
+var standardRates = func() []int {
+	rates := make([]int, 0, len(knownRates))
+	for rate := range knownRates {
+		rates = append(rates, rate)
+	}
+	sort.Ints(rates)
+	return rates
+}()
+
+// closestRate returns the code of the standard baud rate closest to baud,
+// the lower one if baud is halfway between two of them.
+func closestRate(baud int) uint32 {
+	best, closest := -1, 0
+	for _, rate := range standardRates {
+		d := rate - baud
+		if d < 0 {
+			d = -d
+		}
+		if best < 0 || d < best {
+			best, closest = d, rate
+		}
+	}
+	return knownRates[closest]
+}
+
+// convRate converts numerical rate into the baud rate code, like B115200.
+func convRate(baud int) (uint32, error) {
+	v, ok := knownRates[baud]
+	if !ok {
+		return 0, fmt.Errorf("%w: %v", ErrUnsupportedBaudRate, baud)
+	}
+	return v, nil
+}
+
+// serial_rs485 is the structure of TIOCSRS485 from linux/serial.h.
+type serial_rs485 struct {
+	flags                 uint32
+	delay_rts_before_send uint32
+	delay_rts_after_send  uint32
+	padding               [5]uint32
+}
+
+// serial_icounter_struct is the structure of TIOCGICOUNT from linux/serial.h.
+type serial_icounter_struct struct {
+	cts, dsr, rng, dcd     int32
+	rx, tx                 int32
+	frame, overrun, parity int32
+	brk                    int32
+	buf_overrun            int32
+	reserved               [9]int32
+}
+
+type serial_struct struct {
+	typ             uint32
+	line            uint32
+	port            uint32
+	irq             uint32
+	flags           int32
+	xmit_fifo_size  uint32
+	custom_divisor  uint32
+	baud_base       uint32
+	close_delay     uint16
+	io_type         byte
+	reserved_char   byte
+	hub6            int32
+	closing_wait    uint16
+	closing_wait2   uint16
+	iomem_base      uintptr
+	iomem_reg_shift uint16
+	port_high       uint32
+	iomap_base      uintptr
+}
+
+func newRaw() *termios {
+	tio := &termios{cflag: CS8 | CLOCAL | CREAD | HUPCL}
+	tio.cc[VMIN] = 1
+	tio.cc[VTIME] = 0
+	return tio
+}
+
+func (tio *termios) setSpeed(baud uint32) error {
+	if (baud & ^uint32(CBAUD)) != 0 {
+		return fmt.Errorf("setSpeed: baud=%0x, does not fit to mask: %0x", baud, CBAUD)
+	}
+	tio.cflag &= ^uint32(CBAUD)
+	tio.cflag |= baud
+	return nil
+}
+
+func (tio *termios) setFraming(dataBits int, parity Parity, stopBits StopBits) error {
+	tio.cflag &= ^uint32(CSIZE | PARENB | PARODD | CMSPAR | CSTOPB)
+	switch dataBits {
+	case 5:
+		tio.cflag |= CS5
+	case 6:
+		tio.cflag |= CS6
+	case 7:
+		tio.cflag |= CS7
+	case 8:
+		tio.cflag |= CS8
+	default:
+		return fmt.Errorf("unsupported data bits: %v", dataBits)
+	}
+	switch parity {
+	case ParityNone:
+	case ParityOdd:
+		tio.cflag |= PARENB | PARODD
+	case ParityEven:
+		tio.cflag |= PARENB
+	case ParityMark:
+		tio.cflag |= PARENB | CMSPAR | PARODD
+	case ParitySpace:
+		tio.cflag |= PARENB | CMSPAR
+	default:
+		return fmt.Errorf("unsupported parity: %v", parity)
+	}
+	switch stopBits {
+	case OneStopBit:
+	case TwoStopBits:
+		tio.cflag |= CSTOPB
+	default:
+		return fmt.Errorf("unsupported stop bits: %v", stopBits)
+	}
+	return nil
+}
+
+func (tio *termios) setFlowControl(fc FlowControl, sf SoftwareFlowConfig) error {
+	tio.cflag &= ^uint32(CRTSCTS)
+	tio.iflag &= ^uint32(IXON | IXOFF | IXANY)
+	// The characters are set whatever the flow control, for SendXON and SendXOFF.
+	tio.cc[VSTART], tio.cc[VSTOP] = sf.chars()
+	switch fc {
+	case FlowNone:
+	case FlowHardware:
+		tio.cflag |= CRTSCTS
+	case FlowSoftware:
+		switch sf.Direction {
+		case FlowBoth:
+			tio.iflag |= IXON | IXOFF
+		case FlowOutput:
+			tio.iflag |= IXON
+		case FlowInput:
+			tio.iflag |= IXOFF
+		default:
+			return fmt.Errorf("unsupported flow direction: %v", sf.Direction)
+		}
+		if sf.RestartOnAny {
+			tio.iflag |= IXANY
+		}
+	default:
+		return fmt.Errorf("unsupported flow control: %v", fc)
+	}
+	return nil
+}
+
+// setConsole sets the processing of the input and the output described by c.
+func (tio *termios) setConsole(c ConsoleConfig) {
+	if c.Canonical {
+		tio.lflag |= ICANON
+		tio.cc[VERASE] = 0x7f
+		tio.cc[VKILL] = 0x15
+		tio.cc[VEOF] = 0x04
+		tio.cc[VEOL] = 0
+	}
+	if c.CRToNL {
+		tio.iflag |= ICRNL
+	}
+	if c.NLToCRNL {
+		tio.oflag |= OPOST | ONLCR
+	}
+	if c.Echo {
+		tio.lflag |= ECHO
+		if c.Canonical {
+			tio.lflag |= ECHOE | ECHOK
+		}
+	}
+}
+
+func (tio *termios) speed() uint32 {
+	return tio.cflag & CBAUD
+}
+
+func (tio *termios) toTermios2() *termios2 {
+	t2 := &termios2{
+		iflag: tio.iflag,
+		oflag: tio.oflag,
+		cflag: tio.cflag,
+		lflag: tio.lflag,
+		line:  tio.line,
+	}
+	copy(t2.cc[:], tio.cc[:])
+	return t2
+}
+
+// apply sets serial attributes to the fd. If drain is true, it waits for the output
+// to be transmitted first (TCSETSW), otherwise it discards the input and the output (TCSETSF).
+func (tio *termios) apply(fd uintptr, drain bool) error {
+	if drain {
+		return blockingIoctl(fd, TCSETSW, uintptr(unsafe.Pointer(tio)))
+	}
+	if err := ioctl(fd, TCSETSF, tio); err != nil {
+		return err
+	}
+	//if err := fcntl(fd, syscall.F_SETFL, 0); err != nil {
+	//	return err
+	//}
+	return nil
+}
+
+// query gets serial attributes from the fd.
+func query(fd uintptr) (*termios, error) {
+	tio := new(termios)
+	if err := ioctl(fd, TCGETS, tio); err != nil {
+		return nil, err
+	}
+	return tio, nil
+}
+
+// makeTerminalRaw switches the terminal behind fd to raw input, for Terminal,
+// and returns the function which restores it. The output is processed as before.
+func makeTerminalRaw(fd uintptr) (func(), error) {
+	tio, err := query(fd)
+	if err != nil {
+		return nil, err
+	}
+	saved := *tio
+	tio.iflag &^= IGNBRK | BRKINT | PARMRK | ISTRIP | INLCR | IGNCR | ICRNL | IXON
+	tio.lflag &^= ECHO | ECHONL | ICANON | ISIG | IEXTEN
+	tio.cc[VMIN] = 1
+	tio.cc[VTIME] = 0
+	if err := ioctl(fd, TCSETS, tio); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, TCSETS, &saved) }, nil
+}
+
+// sysState is the termios of a port, saved by Port.SaveState.
+type sysState struct {
+	t2  *termios2 // nil if the kernel does not support TCGETS2
+	tio termios
+}
+
+// saveState returns the termios of fd, with termios2 to keep the custom baud rates.
+func saveState(fd uintptr) (*sysState, error) {
+	s := new(sysState)
+	t2 := new(termios2)
+	if err := ioctl2(fd, TCGETS2, t2); err == nil {
+		s.t2 = t2
+		return s, nil
+	}
+	if err := ioctl(fd, TCGETS, &s.tio); err != nil {
+		return nil, fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	return s, nil
+}
+
+// restoreState sets the termios of fd saved by saveState.
+// If drain is true, it waits for the output to be transmitted first.
+func restoreState(fd uintptr, s *sysState, drain bool) error {
+	if s.t2 != nil {
+		if drain {
+			return blockingIoctl(fd, TCSETSW2, uintptr(unsafe.Pointer(s.t2)))
+		}
+		return ioctl2(fd, TCSETS2, s.t2)
+	}
+	if drain {
+		return blockingIoctl(fd, TCSETSW, uintptr(unsafe.Pointer(&s.tio)))
+	}
+	return ioctl(fd, TCSETS, &s.tio)
+}
+
+// setLowLatency sets the low_latency flag of the tty behind fd, and the latency timer
+// of its USB adapter, like an FTDI one, to the minimum, if the user may write it.
+// The ttys without the flag, like ptys, are not an error.
+func setLowLatency(fd uintptr, name string) error {
+	var ss serial_struct
+	if err := ioctlSS(fd, syscall.TIOCGSERIAL, &ss); err != nil {
+		if err == syscall.ENOTTY || err == syscall.EINVAL {
+			return nil
+		}
+		return err
+	}
+	ss.flags |= ASYNC_LOW_LATENCY
+	if err := ioctlSS(fd, syscall.TIOCSSERIAL, &ss); err != nil && err != syscall.ENOTTY && err != syscall.EINVAL {
+		return err
+	}
+	if err := setLatencyTimer(name, time.Millisecond); err != nil && !errors.Is(err, fs.ErrPermission) && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// The closing_wait of serial_struct meaning no wait.
+const closingWaitNone = 65535
+
+// getSerialInfo reads the serial_struct of the tty behind fd.
+func getSerialInfo(fd uintptr) (SerialInfo, error) {
+	var ss serial_struct
+	if err := ioctlSS(fd, syscall.TIOCGSERIAL, &ss); err != nil {
+		return SerialInfo{}, err
+	}
+	info := SerialInfo{
+		Type:          UARTType(ss.typ),
+		Line:          int(ss.line),
+		Port:          uint64(ss.port) | uint64(ss.port_high)<<32,
+		IRQ:           int(ss.irq),
+		Flags:         SerialFlags(ss.flags),
+		XmitFIFOSize:  int(ss.xmit_fifo_size),
+		BaseBaud:      int(ss.baud_base),
+		CustomDivisor: int(ss.custom_divisor),
+		CloseDelay:    time.Duration(ss.close_delay) * 10 * time.Millisecond,
+		ClosingWait:   time.Duration(ss.closing_wait) * 10 * time.Millisecond,
+		IOType:        int(ss.io_type),
+		IOMemBase:     ss.iomem_base,
+		IOMemRegShift: int(ss.iomem_reg_shift),
+	}
+	if ss.closing_wait == closingWaitNone {
+		info.ClosingWait = -1
+	}
+	return info, nil
+}
+
+// setSerialInfo writes info to the serial_struct of the tty behind fd.
+// The fields info does not have are kept as they are.
+func setSerialInfo(fd uintptr, info SerialInfo) error {
+	var ss serial_struct
+	if err := ioctlSS(fd, syscall.TIOCGSERIAL, &ss); err != nil {
+		return err
+	}
+	ss.typ = uint32(info.Type)
+	ss.line = uint32(info.Line)
+	ss.port = uint32(info.Port)
+	ss.port_high = uint32(info.Port >> 32)
+	ss.irq = uint32(info.IRQ)
+	ss.flags = int32(info.Flags)
+	ss.xmit_fifo_size = uint32(info.XmitFIFOSize)
+	ss.baud_base = uint32(info.BaseBaud)
+	ss.custom_divisor = uint32(info.CustomDivisor)
+	ss.close_delay = uint16(info.CloseDelay / (10 * time.Millisecond))
+	ss.closing_wait = uint16(info.ClosingWait / (10 * time.Millisecond))
+	if info.ClosingWait < 0 {
+		ss.closing_wait = closingWaitNone
+	}
+	ss.io_type = byte(info.IOType)
+	ss.iomem_base = info.IOMemBase
+	ss.iomem_reg_shift = uint16(info.IOMemRegShift)
+	return ioctlSS(fd, syscall.TIOCSSERIAL, &ss)
+}
+
+// setLatencyTimer writes the latency_timer attribute of the USB adapter behind the port name.
+func setLatencyTimer(name string, d time.Duration) error {
+	ms := d.Milliseconds()
+	if ms < 1 || ms > 255 {
+		return fmt.Errorf("latency timer out of range: %v", d)
+	}
+	dev, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	attr := filepath.Join(sysClassTTY, filepath.Base(dev), "device", "latency_timer")
+	if _, err := os.Stat(attr); err != nil {
+		return fmt.Errorf("latency timer of %s: %w", name, errors.ErrUnsupported)
+	}
+	return os.WriteFile(attr, []byte(strconv.FormatInt(ms, 10)), 0)
+}
+
+// fionread is the ioctl which returns the number of bytes in the input queue.
+const fionread = syscall.TIOCINQ
+
+// driverStats adds the counters of the driver to s.
+// The ttys which do not count (like ptys) are not an error.
+func driverStats(fd uintptr, s *Stats) error {
+	var ic serial_icounter_struct
+	if err := rawIoctl(fd, TIOCGICOUNT, uintptr(unsafe.Pointer(&ic))); err != nil {
+		if err == syscall.ENOTTY || err == syscall.EINVAL {
+			return nil
+		}
+		return err
+	}
+	s.FrameErrors = uint64(ic.frame)
+	s.ParityErrors = uint64(ic.parity)
+	s.Overruns = uint64(ic.overrun)
+	s.BufferOverruns = uint64(ic.buf_overrun)
+	s.Breaks = uint64(ic.brk)
+	return nil
+}
+
+// tcdrain waits until all output written to fd has been transmitted.
+func tcdrain(fd uintptr) error {
+	// TCSBRK with a non-zero argument is tcdrain, not a break.
+	return blockingIoctl(fd, TCSBRK, 1)
+}
+
+// tcflow sends the START character of fd (start == true) or the STOP one,
+// which the driver transmits ahead of the output queue.
+func tcflow(fd uintptr, start bool) error {
+	action := uintptr(TCIOFF)
+	if start {
+		action = TCION
+	}
+	return rawIoctl(fd, TCXONC, action)
+}
+
+// tcflush discards the input (input == true) or the output queue of fd.
+func tcflush(fd uintptr, input bool) error {
+	queue := uintptr(TCOFLUSH)
+	if input {
+		queue = TCIFLUSH
+	}
+	return rawIoctl(fd, TCFLSH, queue)
+}
+
+func rawFcntl(fd uintptr, cmd int, arg uintptr) error {
+	_, _, err := syscall.RawSyscall(syscall.SYS_FCNTL, fd, uintptr(cmd), arg)
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+func fcntl(fd uintptr, cmd int, arg int) error {
+	return rawFcntl(fd, cmd, uintptr(arg))
+}
+
+func ioctl(fd uintptr, req uint, tio *termios) error {
+	return rawIoctl(fd, req, uintptr(unsafe.Pointer(tio)))
+}
+
+func ioctl2(fd uintptr, req uint, t2 *termios2) error {
+	return rawIoctl(fd, req, uintptr(unsafe.Pointer(t2)))
+}
+
+func ioctlSS(fd uintptr, req uint, ss *serial_struct) error {
+	return rawIoctl(fd, req, uintptr(unsafe.Pointer(ss)))
+}
+
+// Flags of serial_rs485.
+const (
+	SER_RS485_ENABLED        = 1 << 0
+	SER_RS485_RTS_ON_SEND    = 1 << 1
+	SER_RS485_RTS_AFTER_SEND = 1 << 2
+	SER_RS485_RX_DURING_TX   = 1 << 4
+)
+
+const (
+	ASYNCB_LOW_LATENCY = 13 /* Request low latency behaviour */
+	ASYNC_LOW_LATENCY  = (1 << ASYNCB_LOW_LATENCY)
+)
+
+const (
+	ASYNCB_SPD_HI  = 4  /* Use 57600 instead of 38400 bps */
+	ASYNCB_SPD_VHI = 5  /* Use 115200 instead of 38400 bps */
+	ASYNCB_SPD_SHI = 12 /* Use 230400 instead of 38400 bps */
+	ASYNC_SPD_HI   = (1 << ASYNCB_SPD_HI)
+	ASYNC_SPD_SHI  = (1 << ASYNCB_SPD_SHI)
+	ASYNC_SPD_VHI  = (1 << ASYNCB_SPD_VHI)
+	ASYNC_SPD_CUST = (ASYNC_SPD_HI | ASYNC_SPD_VHI)
+	ASYNC_SPD_MASK = (ASYNC_SPD_HI | ASYNC_SPD_VHI | ASYNC_SPD_SHI)
+)
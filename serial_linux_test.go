@@ -0,0 +1,25 @@
+package serial
+
+import "testing"
+
+func TestClosestRate(t *testing.T) {
+	for _, tt := range []struct {
+		baud int
+		want uint32
+	}{
+		{1, B50},
+		{100, B110},
+		{2100, B1800}, // halfway between 1800 and 2400
+		{2101, B2400},
+		{250000, B230400},
+		{538000, B500000}, // halfway between 500000 and 576000
+		{10000000, B4000000},
+	} {
+		// The rates are compared in order, so that the ties are broken the same way every time.
+		for i := 0; i < 10; i++ {
+			if got := closestRate(tt.baud); got != tt.want {
+				t.Fatalf("closestRate(%d) = %#o, want %#o", tt.baud, got, tt.want)
+			}
+		}
+	}
+}
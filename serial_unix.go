@@ -0,0 +1,638 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func openPort(name string, cfg Config) (_ Port, err error) {
+	unlock := func() {}
+	if cfg.LockDir != "" {
+		if unlock, err = lockPort(cfg.LockDir, name); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				unlock()
+			}
+		}()
+	}
+	// O_NONBLOCK keeps open from waiting for the carrier, and lets the runtime
+	// poller serve the port. That makes deadlines work, and Close unblock pending calls.
+	f, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, openError(err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+	if f.SetReadDeadline(time.Time{}) != nil {
+		// The poller does not support this device; fall back to blocking I/O.
+		err = control(f, func(fd uintptr) error { return syscall.SetNonblock(int(fd), false) })
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Exclusive {
+		if err = control(f, func(fd uintptr) error { return rawIoctl(fd, syscall.TIOCEXCL, 0) }); err != nil {
+			return nil, fmt.Errorf("failed to get exclusive access: %w", err)
+		}
+	}
+	if cfg.LowLatency {
+		if err = control(f, func(fd uintptr) error { return setLowLatency(fd, name) }); err != nil {
+			return nil, fmt.Errorf("failed to set low latency mode: %w", err)
+		}
+	}
+	var saved *sysState
+	if cfg.RestoreOnClose {
+		if err = control(f, func(fd uintptr) (err error) { saved, err = saveState(fd); return err }); err != nil {
+			return nil, err
+		}
+	}
+	if err = control(f, func(fd uintptr) error { return configure(fd, cfg, false) }); err != nil {
+		if saved != nil {
+			control(f, func(fd uintptr) error { return restoreState(fd, saved, false) })
+		}
+		return nil, err
+	}
+	p := newPort(f, cfg, unlock)
+	p.saved = saved
+	p.monitor.watch(func() error {
+		_, err := p.modemLines()
+		return err
+	})
+	return p, nil
+}
+
+// newPort returns the port for the opened and configured file f.
+func newPort(f *os.File, cfg Config, unlock func()) *port {
+	return &port{f: f, readTimeout: cfg.ReadTimeout, writeTimeout: cfg.WriteTimeout, monitor: newDisconnectMonitor(cfg.OnDisconnect), unlock: unlock, cfg: cfg, events: newEvents()}
+}
+
+// deviceExists reports whether the device of the port name exists.
+func deviceExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// ttyBufferSize is the size of the buffer of the line discipline, which a single Read returns at most.
+const ttyBufferSize = 4096
+
+// port represents an opened serial connection.
+type port struct {
+	f            *os.File
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	monitor      *disconnectMonitor
+	unlock       func() // removes the lock file of the port
+	counters     counters
+	events       *events
+
+	cfgMu sync.Mutex // serializes the changes of cfg
+	cfg   Config
+	saved *sysState // restored by Close, for Config.RestoreOnClose
+
+	writeMu   sync.Mutex   // serializes Write, with its deadline
+	drains    atomic.Int32 // the calls waiting for the output to be transmitted
+	closeOnce sync.Once
+}
+
+// Read implements io.Reader
+func (p *port) Read(buf []byte) (int, error) {
+	if p.readTimeout > 0 {
+		if err := p.f.SetReadDeadline(time.Now().Add(p.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := p.f.Read(buf)
+	p.counters.read(n)
+	if n > 0 {
+		p.events.read()
+	}
+	return n, p.check(err)
+}
+
+// ReadTimestamped implements Port. It reads with the read system call itself, to take the time right after it.
+func (p *port) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	if p.readTimeout > 0 {
+		if err := p.f.SetReadDeadline(time.Now().Add(p.readTimeout)); err != nil {
+			return 0, time.Time{}, err
+		}
+	}
+	rc, err := p.f.SyscallConn()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	var n int
+	var ts time.Time
+	var errno error
+	err = rc.Read(func(fd uintptr) bool {
+		for {
+			n, errno = syscall.Read(int(fd), buf)
+			ts = time.Now()
+			if errno != syscall.EINTR {
+				break
+			}
+		}
+		// Wait for the input, unless there is some.
+		return errno != syscall.EAGAIN
+	})
+	switch {
+	case err != nil:
+		n = 0
+	case errno != nil:
+		n, err = 0, &os.PathError{Op: "read", Path: p.f.Name(), Err: errno}
+	case n == 0 && len(buf) > 0:
+		err = io.EOF
+	}
+	if n == 0 && err != nil {
+		ts = time.Time{}
+	}
+	p.counters.read(n)
+	if n > 0 {
+		p.events.read()
+	}
+	return n, ts, p.check(err)
+}
+
+// check converts the error of a read to ErrPortDisconnected, like monitor.check,
+// except for the end of the input typed with Ctrl-D in the canonical mode.
+func (p *port) check(err error) error {
+	if err == io.EOF && p.Config().Console.Canonical {
+		return err
+	}
+	return p.monitor.check(err)
+}
+
+// Write implements io.Writer
+func (p *port) Write(buf []byte) (int, error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.write(buf)
+}
+
+// write writes buf with the write timeout. Must be called with writeMu held.
+func (p *port) write(buf []byte) (int, error) {
+	if p.writeTimeout > 0 {
+		if err := p.f.SetWriteDeadline(time.Now().Add(p.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := p.f.Write(buf)
+	p.counters.write(n)
+	return n, writeTimeout(n, p.monitor.check(err))
+}
+
+// ReadFrom implements io.ReaderFrom, so io.Copy to the port lets the kernel copy the data
+// directly where it can, like with splice from a pipe or a socket. The copy is a single Write:
+// the concurrent Writes wait for it to end.
+func (p *port) ReadFrom(r io.Reader) (int64, error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if p.writeTimeout > 0 {
+		// The timeout applies to every write, not to the whole copy.
+		return io.Copy(writerFunc(p.write), r)
+	}
+	n, err := p.f.ReadFrom(r)
+	p.counters.write(int(n))
+	return n, writeTimeout(int(n), p.monitor.check(err))
+}
+
+// writerFunc is an io.Writer calling a function.
+type writerFunc func(buf []byte) (int, error)
+
+func (f writerFunc) Write(buf []byte) (int, error) { return f(buf) }
+
+// WriteTo implements io.WriterTo. It copies the data read from the port to w,
+// until Read fails, like with a timeout or when the port is closed.
+func (p *port) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, ttyBufferSize)
+	var total int64
+	for {
+		n, err := p.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			total += int64(m)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// writeBuffers writes bufs with writev.
+func (p *port) writeBuffers(bufs [][]byte) (int64, error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	rc, err := p.f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	bufs = append([][]byte(nil), bufs...)
+	var total int64
+	for {
+		iov := make([]syscall.Iovec, 0, min(len(bufs), maxIovecs))
+		for _, b := range bufs {
+			if len(iov) == maxIovecs {
+				break
+			}
+			if len(b) > 0 {
+				v := syscall.Iovec{Base: &b[0]}
+				v.SetLen(len(b))
+				iov = append(iov, v)
+			}
+		}
+		if len(iov) == 0 {
+			return total, nil
+		}
+		var n uintptr
+		var errno syscall.Errno
+		err := rc.Write(func(fd uintptr) bool {
+			n, _, errno = syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iov[0])), uintptr(len(iov)))
+			// Wait for the port to become writable.
+			return errno != syscall.EAGAIN
+		})
+		if err == nil && errno != 0 {
+			err = &os.PathError{Op: "writev", Path: p.f.Name(), Err: errno}
+			n = 0
+		}
+		p.counters.write(int(n))
+		total += int64(n)
+		if err != nil {
+			return total, p.monitor.check(err)
+		}
+		bufs = consumeBuffers(bufs, int64(n))
+	}
+}
+
+// Close implements io.Closer
+func (p *port) Close() error {
+	err := error(&os.PathError{Op: "close", Path: p.f.Name(), Err: os.ErrClosed})
+	p.closeOnce.Do(func() {
+		p.monitor.stop()
+		p.events.stop()
+		if p.drains.Load() > 0 {
+			// The output may never be transmitted, like when the flow control stops it,
+			// and the file is not closed until the calls waiting for it return.
+			control(p.f, func(fd uintptr) error { return tcflush(fd, false) })
+		}
+		if p.saved != nil {
+			// Do not wait for the output, which may be stuck, like by the flow control.
+			control(p.f, func(fd uintptr) error { return restoreState(fd, p.saved, false) })
+		}
+		err = p.f.Close()
+		p.unlock()
+	})
+	return err
+}
+
+// SetReadDeadline implements Port
+func (p *port) SetReadDeadline(t time.Time) error { return p.f.SetReadDeadline(t) }
+
+// SetWriteDeadline implements Port
+func (p *port) SetWriteDeadline(t time.Time) error { return p.f.SetWriteDeadline(t) }
+
+// SyscallConn implements Port. The raw connection waits for the descriptor with the runtime poller.
+func (p *port) SyscallConn() (syscall.RawConn, error) { return p.f.SyscallConn() }
+
+// Fd implements Port
+func (p *port) Fd() uintptr {
+	fd := ^uintptr(0)
+	control(p.f, func(u uintptr) error {
+		fd = u
+		return nil
+	})
+	return fd
+}
+
+// SetDTR implements Port
+func (p *port) SetDTR(on bool) error {
+	if err := p.setModemLines(syscall.TIOCM_DTR, on); err != nil {
+		return fmt.Errorf("failed to set DTR: %w", err)
+	}
+	return nil
+}
+
+// SetRTS implements Port
+func (p *port) SetRTS(on bool) error {
+	if err := p.setModemLines(syscall.TIOCM_RTS, on); err != nil {
+		return fmt.Errorf("failed to set RTS: %w", err)
+	}
+	return nil
+}
+
+// setLines sets DTR and RTS at once with TIOCMSET, for RunLineSequence.
+func (p *port) setLines(dtr, rts bool) error {
+	err := control(p.f, func(fd uintptr) error {
+		var bits int32
+		if err := rawIoctl(fd, syscall.TIOCMGET, uintptr(unsafe.Pointer(&bits))); err != nil {
+			return err
+		}
+		bits &^= syscall.TIOCM_DTR | syscall.TIOCM_RTS
+		if dtr {
+			bits |= syscall.TIOCM_DTR
+		}
+		if rts {
+			bits |= syscall.TIOCM_RTS
+		}
+		return rawIoctl(fd, syscall.TIOCMSET, uintptr(unsafe.Pointer(&bits)))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set DTR and RTS: %w", err)
+	}
+	return nil
+}
+
+// Status implements Port
+func (p *port) Status() (ModemStatus, error) {
+	bits, err := p.modemLines()
+	if err != nil {
+		return ModemStatus{}, fmt.Errorf("failed to query modem lines: %w", err)
+	}
+	return ModemStatus{
+		CTS: bits&syscall.TIOCM_CTS != 0,
+		DSR: bits&syscall.TIOCM_DSR != 0,
+		DCD: bits&syscall.TIOCM_CAR != 0,
+		RI:  bits&syscall.TIOCM_RI != 0,
+	}, nil
+}
+
+// Drain implements Port
+func (p *port) Drain() error {
+	if err := p.drain(tcdrain); err != nil {
+		return fmt.Errorf("failed to drain output: %w", err)
+	}
+	return nil
+}
+
+// ResetInput implements Port
+func (p *port) ResetInput() error {
+	if err := control(p.f, func(fd uintptr) error { return tcflush(fd, true) }); err != nil {
+		return fmt.Errorf("failed to reset input: %w", err)
+	}
+	return nil
+}
+
+// ResetOutput implements Port
+func (p *port) ResetOutput() error {
+	if err := control(p.f, func(fd uintptr) error { return tcflush(fd, false) }); err != nil {
+		return fmt.Errorf("failed to reset output: %w", err)
+	}
+	return nil
+}
+
+// Break implements Port
+func (p *port) Break(d time.Duration) error {
+	if err := control(p.f, func(fd uintptr) error { return rawIoctl(fd, syscall.TIOCSBRK, 0) }); err != nil {
+		return fmt.Errorf("failed to start break: %w", err)
+	}
+	time.Sleep(d)
+	if err := control(p.f, func(fd uintptr) error { return rawIoctl(fd, syscall.TIOCCBRK, 0) }); err != nil {
+		return fmt.Errorf("failed to stop break: %w", err)
+	}
+	return nil
+}
+
+// SendXON implements Port
+func (p *port) SendXON() error {
+	if err := control(p.f, func(fd uintptr) error { return tcflow(fd, true) }); err != nil {
+		return fmt.Errorf("failed to send XON: %w", err)
+	}
+	return nil
+}
+
+// SendXOFF implements Port
+func (p *port) SendXOFF() error {
+	if err := control(p.f, func(fd uintptr) error { return tcflow(fd, false) }); err != nil {
+		return fmt.Errorf("failed to send XOFF: %w", err)
+	}
+	return nil
+}
+
+// Stats implements Port
+func (p *port) Stats() (Stats, error) {
+	s := p.counters.stats()
+	if err := control(p.f, func(fd uintptr) error { return driverStats(fd, &s) }); err != nil {
+		return s, fmt.Errorf("failed to query driver counters: %w", err)
+	}
+	return s, nil
+}
+
+// SetBaudRate implements Port
+func (p *port) SetBaudRate(baud int) error {
+	return p.reconfigure(func(cfg *Config) { cfg.BaudRate = baud })
+}
+
+// SetDataBits implements Port
+func (p *port) SetDataBits(bits int) error {
+	return p.reconfigure(func(cfg *Config) { cfg.DataBits = bits })
+}
+
+// SetParity implements Port
+func (p *port) SetParity(parity Parity) error {
+	return p.reconfigure(func(cfg *Config) { cfg.Parity = parity })
+}
+
+// SetStopBits implements Port
+func (p *port) SetStopBits(stopBits StopBits) error {
+	return p.reconfigure(func(cfg *Config) { cfg.StopBits = stopBits })
+}
+
+// SetFlowControl implements Port
+func (p *port) SetFlowControl(fc FlowControl) error {
+	return p.reconfigure(func(cfg *Config) { cfg.FlowControl = fc })
+}
+
+// reconfigure applies the configuration of the port changed by update,
+// once the output written so far is transmitted.
+func (p *port) reconfigure(update func(cfg *Config)) error {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	cfg := p.cfg
+	update(&cfg)
+	if err := p.drain(func(fd uintptr) error { return configure(fd, cfg, true) }); err != nil {
+		return fmt.Errorf("failed to reconfigure port: %w", err)
+	}
+	p.cfg = cfg
+	return nil
+}
+
+// drain calls fn, which waits for the output to be transmitted, with the descriptor.
+// Close discards the output meanwhile, which ends the wait.
+func (p *port) drain(fn func(fd uintptr) error) error {
+	p.drains.Add(1)
+	defer p.drains.Add(-1)
+	return control(p.f, fn)
+}
+
+// Config implements Port
+func (p *port) Config() Config {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	return p.cfg
+}
+
+// SaveState implements Port. The state holds the termios of the port.
+func (p *port) SaveState() (*State, error) {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	s := &State{Config: p.cfg}
+	err := control(p.f, func(fd uintptr) (err error) { s.sys, err = saveState(fd); return err })
+	if err != nil {
+		return nil, fmt.Errorf("failed to save port state: %w", err)
+	}
+	return s, nil
+}
+
+// RestoreState implements Port
+func (p *port) RestoreState(s *State) error {
+	if s.sys == nil {
+		return p.reconfigure(func(cfg *Config) { cfg.setLine(s.Config) })
+	}
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	if err := p.drain(func(fd uintptr) error { return restoreState(fd, s.sys, true) }); err != nil {
+		return fmt.Errorf("failed to restore port state: %w", err)
+	}
+	p.cfg.setLine(s.Config)
+	return nil
+}
+
+// Events implements Port. The input is waited for with the runtime poller.
+func (p *port) Events() <-chan Event {
+	return p.events.start(p, p.Status)
+}
+
+// waitData waits until there is data to read, without reading it.
+func (p *port) waitData(done <-chan struct{}) error {
+	rc, err := p.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var qerr error
+	queued := func(fd uintptr) bool {
+		var n int32
+		if qerr = rawIoctl(fd, fionread, uintptr(unsafe.Pointer(&n))); qerr != nil {
+			return true
+		}
+		return n > 0
+	}
+	for {
+		var ready bool
+		err := control(p.f, func(fd uintptr) error {
+			ready = queued(fd)
+			return nil
+		})
+		if err == nil && !ready {
+			err = rc.Read(queued)
+		}
+		if qerr != nil {
+			return p.monitor.check(qerr)
+		}
+		if err == nil || errors.Is(err, os.ErrClosed) {
+			return err
+		}
+		// A read deadline has passed, or the poller does not support the port:
+		// check the input periodically instead.
+		t := time.NewTimer(dataCheckInterval)
+		select {
+		case <-done:
+			t.Stop()
+			return os.ErrClosed
+		case <-t.C:
+		}
+	}
+}
+
+// setModemLines raises (on == true) or lowers the modem control lines in bits.
+func (p *port) setModemLines(bits int32, on bool) error {
+	req := uint(syscall.TIOCMBIC)
+	if on {
+		req = syscall.TIOCMBIS
+	}
+	return control(p.f, func(fd uintptr) error {
+		return rawIoctl(fd, req, uintptr(unsafe.Pointer(&bits)))
+	})
+}
+
+// modemLines returns the TIOCM_* bits of the modem lines.
+func (p *port) modemLines() (int32, error) {
+	var bits int32
+	err := control(p.f, func(fd uintptr) error {
+		return rawIoctl(fd, syscall.TIOCMGET, uintptr(unsafe.Pointer(&bits)))
+	})
+	return bits, err
+}
+
+// control calls fn with the file descriptor of f.
+// Unlike f.Fd, it keeps the descriptor in non-blocking mode,
+// which is required for deadlines to work.
+func control(f *os.File, fn func(fd uintptr) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := rc.Control(func(fd uintptr) { fnErr = fn(fd) }); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// openError wraps the error of opening a port with ErrPortBusy or ErrPermissionDenied, if it applies.
+func openError(err error) error {
+	switch {
+	case errors.Is(err, syscall.EBUSY):
+		return fmt.Errorf("%w: %w", ErrPortBusy, err)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	}
+	return err
+}
+
+// isDisconnect reports whether err is caused by the disconnection of the device.
+// Reading a hung up tty returns 0 bytes, which os.File reports as io.EOF,
+// and the other operations fail with EIO.
+func isDisconnect(err error) bool {
+	return err == io.EOF ||
+		errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.ENXIO) ||
+		errors.Is(err, syscall.ENODEV)
+}
+
+// blockingIoctl is like rawIoctl, but for requests which may block for a long time.
+// Unlike RawSyscall, Syscall lets the runtime schedule other goroutines meanwhile.
+func blockingIoctl(fd uintptr, req uint, arg uintptr) error {
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), arg)
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+func rawIoctl(fd uintptr, req uint, arg uintptr) error {
+	_, _, err := syscall.RawSyscall(syscall.SYS_IOCTL, fd, uintptr(req), arg)
+	if err != 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,943 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetCommState           = modkernel32.NewProc("GetCommState")
+	procSetCommState           = modkernel32.NewProc("SetCommState")
+	procSetCommTimeouts        = modkernel32.NewProc("SetCommTimeouts")
+	procGetCommTimeouts        = modkernel32.NewProc("GetCommTimeouts")
+	procCreateEventW           = modkernel32.NewProc("CreateEventW")
+	procSetEvent               = modkernel32.NewProc("SetEvent")
+	procWaitForMultipleObjects = modkernel32.NewProc("WaitForMultipleObjects")
+	procGetOverlappedResult    = modkernel32.NewProc("GetOverlappedResult")
+	procEscapeCommFunction     = modkernel32.NewProc("EscapeCommFunction")
+	procTransmitCommChar       = modkernel32.NewProc("TransmitCommChar")
+	procGetCommModemStatus     = modkernel32.NewProc("GetCommModemStatus")
+	procPurgeComm              = modkernel32.NewProc("PurgeComm")
+	procSetCommBreak           = modkernel32.NewProc("SetCommBreak")
+	procClearCommBreak         = modkernel32.NewProc("ClearCommBreak")
+	procClearCommError         = modkernel32.NewProc("ClearCommError")
+	procSetConsoleMode         = modkernel32.NewProc("SetConsoleMode")
+)
+
+func openPort(name string, cfg Config) (Port, error) {
+	path := name
+	if !strings.HasPrefix(path, `\\.\`) {
+		// COM10 and above are only reachable through the device namespace.
+		path = `\\.\` + path
+	}
+	path16, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	h, err := syscall.CreateFile(path16, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL|syscall.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return nil, openError(&os.PathError{Op: "open", Path: name, Err: err})
+	}
+	p := &port{name: name, h: h, readTimeout: cfg.ReadTimeout, writeTimeout: cfg.WriteTimeout, monitor: newDisconnectMonitor(cfg.OnDisconnect), cfg: cfg, events: newEvents()}
+	if p.readWake, err = createEvent(false); err != nil {
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+	if p.writeWake, err = createEvent(false); err != nil {
+		syscall.CloseHandle(p.readWake)
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+	if cfg.RestoreOnClose {
+		if p.saved, err = saveState(h); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	if err = configure(h, cfg, false); err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.monitor.watch(func() error {
+		var bits uint32
+		return p.withHandle("status", func(h syscall.Handle) error {
+			return callBool(procGetCommModemStatus, uintptr(h), uintptr(unsafe.Pointer(&bits)))
+		})
+	})
+	return p, nil
+}
+
+// deviceExists reports whether the COM port name exists, by looking for it among the ports of the system.
+func deviceExists(name string) bool {
+	_, err := lookupPort(name)
+	return err == nil
+}
+
+// getSerialInfo is not supported on Windows.
+func getSerialInfo(fd uintptr) (SerialInfo, error) {
+	return SerialInfo{}, fmt.Errorf("serial info: %w", errors.ErrUnsupported)
+}
+
+// setSerialInfo is not supported on Windows.
+func setSerialInfo(fd uintptr, info SerialInfo) error {
+	return fmt.Errorf("serial info: %w", errors.ErrUnsupported)
+}
+
+// setLatencyTimer is not supported on Windows.
+func setLatencyTimer(name string, d time.Duration) error {
+	return fmt.Errorf("latency timer: %w", errors.ErrUnsupported)
+}
+
+// configure puts the COM port behind h into binary mode with the parameters from cfg.
+// If drain is true, the parameters are changed once the pending output is transmitted.
+func configure(h syscall.Handle, cfg Config, drain bool) error {
+	baud := cfg.BaudRate
+	if cfg.RS485.Enabled {
+		return fmt.Errorf("RS-485 mode: %w", errors.ErrUnsupported)
+	}
+	if cfg.MarkErrors {
+		return fmt.Errorf("marking the errors: %w", errors.ErrUnsupported)
+	}
+	if cfg.Console.enabled() {
+		return fmt.Errorf("console mode: %w", errors.ErrUnsupported)
+	}
+	if cfg.LowLatency {
+		// The latency timer of an FTDI adapter is set in the advanced settings of its driver.
+		return fmt.Errorf("low latency mode: %w", errors.ErrUnsupported)
+	}
+	if baud <= 0 {
+		return fmt.Errorf("%w: %v", ErrUnsupportedBaudRate, baud)
+	}
+	var d dcb
+	d.DCBlength = uint32(unsafe.Sizeof(d))
+	if err := getCommState(h, &d); err != nil {
+		return fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	d.BaudRate = uint32(baud)
+	d.flags = dcbBinary | dcbDtrControlEnable
+	switch cfg.FlowControl {
+	case FlowNone:
+		d.flags |= dcbRtsControlEnable
+	case FlowHardware:
+		d.flags |= dcbOutxCtsFlow | dcbRtsControlHandshake
+	case FlowSoftware:
+		d.flags |= dcbRtsControlEnable
+		switch cfg.SoftwareFlow.Direction {
+		case FlowBoth:
+			d.flags |= dcbOutX | dcbInX
+		case FlowOutput:
+			d.flags |= dcbOutX
+		case FlowInput:
+			d.flags |= dcbInX
+		default:
+			return fmt.Errorf("unsupported flow direction: %v", cfg.SoftwareFlow.Direction)
+		}
+		if cfg.SoftwareFlow.RestartOnAny {
+			return fmt.Errorf("restarting the output on any character: %w", errors.ErrUnsupported)
+		}
+	default:
+		return fmt.Errorf("unsupported flow control: %v", cfg.FlowControl)
+	}
+	// The characters are set whatever the flow control, for SendXON and SendXOFF.
+	d.XonChar, d.XoffChar = cfg.SoftwareFlow.chars()
+	if bits := cfg.dataBits(); bits >= 5 && bits <= 8 {
+		d.ByteSize = byte(bits)
+	} else {
+		return fmt.Errorf("unsupported data bits: %v", cfg.DataBits)
+	}
+	switch cfg.Parity {
+	case ParityNone:
+		d.Parity = noParity
+	case ParityOdd:
+		d.Parity = oddParity
+	case ParityEven:
+		d.Parity = evenParity
+	case ParityMark:
+		d.Parity = markParity
+	case ParitySpace:
+		d.Parity = spaceParity
+	default:
+		return fmt.Errorf("unsupported parity: %v", cfg.Parity)
+	}
+	if cfg.Parity != ParityNone {
+		d.flags |= dcbParity
+	}
+	switch cfg.StopBits {
+	case OneStopBit:
+		d.StopBits = oneStopBit
+	case TwoStopBits:
+		d.StopBits = twoStopBits
+	default:
+		return fmt.Errorf("unsupported stop bits: %v", cfg.StopBits)
+	}
+	if drain {
+		if err := syscall.FlushFileBuffers(h); err != nil {
+			return fmt.Errorf("failed to drain output: %w", err)
+		}
+	}
+	if err := setCommState(h, &d); err != nil {
+		return fmt.Errorf("failed to set serial attributes: %w", err)
+	}
+	var d2 dcb
+	d2.DCBlength = uint32(unsafe.Sizeof(d2))
+	if err := getCommState(h, &d2); err != nil {
+		return fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	if d2.BaudRate != d.BaudRate {
+		return fmt.Errorf("%w. Want: %d, got: %d", ErrBaudMismatch, d.BaudRate, d2.BaudRate)
+	}
+	// ReadFile returns as soon as at least one byte is available and waits
+	// for the first byte (almost) forever. Deadlines are implemented
+	// on top of that by waiting for the overlapped operation.
+	t := commTimeouts{
+		ReadIntervalTimeout:        maxDword,
+		ReadTotalTimeoutMultiplier: maxDword,
+		ReadTotalTimeoutConstant:   maxDword - 1,
+	}
+	if err := setCommTimeouts(h, &t); err != nil {
+		return fmt.Errorf("failed to set serial timeouts: %w", err)
+	}
+	return nil
+}
+
+// sysState is the DCB and the timeouts of a COM port, saved by Port.SaveState.
+type sysState struct {
+	dcb      dcb
+	timeouts commTimeouts
+}
+
+// saveState returns the settings of the COM port behind h.
+func saveState(h syscall.Handle) (*sysState, error) {
+	s := new(sysState)
+	s.dcb.DCBlength = uint32(unsafe.Sizeof(s.dcb))
+	if err := getCommState(h, &s.dcb); err != nil {
+		return nil, fmt.Errorf("failed to query serial attributes: %w", err)
+	}
+	if err := getCommTimeouts(h, &s.timeouts); err != nil {
+		return nil, fmt.Errorf("failed to query serial timeouts: %w", err)
+	}
+	return s, nil
+}
+
+// port represents an opened serial connection.
+type port struct {
+	name         string
+	h            syscall.Handle
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	monitor      *disconnectMonitor
+	counters     counters
+	events       *events
+
+	cfgMu sync.Mutex // serializes the changes of cfg
+	cfg   Config
+	saved *sysState // restored by Close, for Config.RestoreOnClose
+
+	// pending counts I/O operations in flight, so Close can wait for them
+	// to be canceled before it releases the handle.
+	pending sync.WaitGroup
+	drains  atomic.Int32 // the calls waiting for the output to be transmitted
+
+	// readMu and writeMu serialize Read and Write, which wait for the wake events of their direction.
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+
+	mu            sync.Mutex // guards the fields below
+	closed        bool
+	readDeadline  time.Time
+	readWake      syscall.Handle // signaled when readDeadline changes
+	writeDeadline time.Time
+	writeWake     syscall.Handle // signaled when writeDeadline changes
+}
+
+// Read implements io.Reader
+func (p *port) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port. The time is taken once the overlapped read completes.
+func (p *port) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	if len(buf) == 0 {
+		return 0, time.Now(), nil
+	}
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	var timeout time.Time
+	if p.readTimeout > 0 {
+		timeout = time.Now().Add(p.readTimeout)
+	}
+	deadline := func() time.Time {
+		if !timeout.IsZero() {
+			return timeout
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.readDeadline
+	}
+	for {
+		n, err := p.overlapped("read", buf, p.readWake, deadline, syscall.ReadFile)
+		ts := time.Now()
+		p.counters.read(n)
+		if n > 0 {
+			p.events.read()
+		}
+		// A successful read of zero bytes means the COMMTIMEOUTS expired.
+		if n > 0 || err != nil {
+			return n, ts, p.monitor.check(err)
+		}
+	}
+}
+
+// Write implements io.Writer
+func (p *port) Write(buf []byte) (int, error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	var timeout time.Time
+	if p.writeTimeout > 0 {
+		timeout = time.Now().Add(p.writeTimeout)
+	}
+	deadline := func() time.Time {
+		if !timeout.IsZero() {
+			return timeout
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.writeDeadline
+	}
+	var written int
+	defer func() { p.counters.write(written) }()
+	for written < len(buf) {
+		n, err := p.overlapped("write", buf[written:], p.writeWake, deadline, syscall.WriteFile)
+		written += n
+		if err != nil {
+			return written, writeTimeout(written, p.monitor.check(err))
+		}
+	}
+	return written, nil
+}
+
+// Close implements io.Closer
+func (p *port) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return &os.PathError{Op: "close", Path: p.name, Err: os.ErrClosed}
+	}
+	p.closed = true
+	// A Read or a Write may start its operation after the cancellation below:
+	// the wake events make it notice the close, and cancel the operation itself.
+	setEvent(p.readWake)
+	setEvent(p.writeWake)
+	p.mu.Unlock()
+	p.monitor.stop()
+	p.events.stop()
+
+	syscall.CancelIoEx(p.h, nil)
+	if p.drains.Load() > 0 {
+		// The output may never be transmitted, like when the flow control stops it,
+		// and FlushFileBuffers is not canceled.
+		callBool(procPurgeComm, uintptr(p.h), purgeTxAbort|purgeTxClear)
+	}
+	p.pending.Wait()
+	if p.saved != nil {
+		setCommState(p.h, &p.saved.dcb)
+		setCommTimeouts(p.h, &p.saved.timeouts)
+	}
+	syscall.CloseHandle(p.readWake)
+	syscall.CloseHandle(p.writeWake)
+	if err := syscall.CloseHandle(p.h); err != nil {
+		return &os.PathError{Op: "close", Path: p.name, Err: err}
+	}
+	return nil
+}
+
+// SetReadDeadline implements Port
+func (p *port) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return &os.PathError{Op: "set deadline", Path: p.name, Err: os.ErrClosed}
+	}
+	p.readDeadline = t
+	return setEvent(p.readWake)
+}
+
+// SetWriteDeadline implements Port
+func (p *port) SetWriteDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return &os.PathError{Op: "set deadline", Path: p.name, Err: os.ErrClosed}
+	}
+	p.writeDeadline = t
+	return setEvent(p.writeWake)
+}
+
+// SyscallConn implements Port. The raw connection only supports Control,
+// since the handle is opened for overlapped I/O.
+func (p *port) SyscallConn() (syscall.RawConn, error) {
+	return rawConn{p}, nil
+}
+
+// Fd implements Port
+func (p *port) Fd() uintptr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ^uintptr(0)
+	}
+	return uintptr(p.h)
+}
+
+// rawConn implements syscall.RawConn for the handle of a port.
+type rawConn struct {
+	p *port
+}
+
+// Control calls f with the handle, which Close does not release meanwhile.
+func (c rawConn) Control(f func(fd uintptr)) error {
+	return c.p.withHandle("control", func(h syscall.Handle) error {
+		f(uintptr(h))
+		return nil
+	})
+}
+
+func (c rawConn) Read(f func(fd uintptr) bool) error {
+	return fmt.Errorf("raw read: %w", errors.ErrUnsupported)
+}
+
+func (c rawConn) Write(f func(fd uintptr) bool) error {
+	return fmt.Errorf("raw write: %w", errors.ErrUnsupported)
+}
+
+// SetDTR implements Port
+func (p *port) SetDTR(on bool) error {
+	fn := uintptr(clrDTR)
+	if on {
+		fn = setDTR
+	}
+	err := p.withHandle("set DTR", func(h syscall.Handle) error { return callBool(procEscapeCommFunction, uintptr(h), fn) })
+	if err != nil {
+		return fmt.Errorf("failed to set DTR: %w", err)
+	}
+	return nil
+}
+
+// SetRTS implements Port
+func (p *port) SetRTS(on bool) error {
+	fn := uintptr(clrRTS)
+	if on {
+		fn = setRTS
+	}
+	err := p.withHandle("set RTS", func(h syscall.Handle) error { return callBool(procEscapeCommFunction, uintptr(h), fn) })
+	if err != nil {
+		return fmt.Errorf("failed to set RTS: %w", err)
+	}
+	return nil
+}
+
+// Status implements Port
+func (p *port) Status() (ModemStatus, error) {
+	var bits uint32
+	err := p.withHandle("status", func(h syscall.Handle) error {
+		return callBool(procGetCommModemStatus, uintptr(h), uintptr(unsafe.Pointer(&bits)))
+	})
+	if err != nil {
+		return ModemStatus{}, fmt.Errorf("failed to query modem lines: %w", err)
+	}
+	return ModemStatus{
+		CTS: bits&msCTSOn != 0,
+		DSR: bits&msDSROn != 0,
+		DCD: bits&msRLSDOn != 0,
+		RI:  bits&msRingOn != 0,
+	}, nil
+}
+
+// Drain implements Port
+func (p *port) Drain() error {
+	if err := p.drain("drain", syscall.FlushFileBuffers); err != nil {
+		return fmt.Errorf("failed to drain output: %w", err)
+	}
+	return nil
+}
+
+// ResetInput implements Port
+func (p *port) ResetInput() error {
+	err := p.withHandle("reset input", func(h syscall.Handle) error { return callBool(procPurgeComm, uintptr(h), purgeRxClear) })
+	if err != nil {
+		return fmt.Errorf("failed to reset input: %w", err)
+	}
+	return nil
+}
+
+// ResetOutput implements Port
+func (p *port) ResetOutput() error {
+	err := p.withHandle("reset output", func(h syscall.Handle) error { return callBool(procPurgeComm, uintptr(h), purgeTxClear) })
+	if err != nil {
+		return fmt.Errorf("failed to reset output: %w", err)
+	}
+	return nil
+}
+
+// Break implements Port
+func (p *port) Break(d time.Duration) error {
+	// The handle is not held during the break, which must not delay Close.
+	err := p.withHandle("break", func(h syscall.Handle) error { return callBool(procSetCommBreak, uintptr(h)) })
+	if err != nil {
+		return fmt.Errorf("failed to start break: %w", err)
+	}
+	time.Sleep(d)
+	err = p.withHandle("break", func(h syscall.Handle) error { return callBool(procClearCommBreak, uintptr(h)) })
+	if err != nil {
+		return fmt.Errorf("failed to stop break: %w", err)
+	}
+	return nil
+}
+
+// SendXON implements Port
+func (p *port) SendXON() error {
+	on, _ := p.Config().SoftwareFlow.chars()
+	err := p.withHandle("send XON", func(h syscall.Handle) error { return callBool(procTransmitCommChar, uintptr(h), uintptr(on)) })
+	if err != nil {
+		return fmt.Errorf("failed to send XON: %w", err)
+	}
+	return nil
+}
+
+// SendXOFF implements Port
+func (p *port) SendXOFF() error {
+	_, off := p.Config().SoftwareFlow.chars()
+	err := p.withHandle("send XOFF", func(h syscall.Handle) error { return callBool(procTransmitCommChar, uintptr(h), uintptr(off)) })
+	if err != nil {
+		return fmt.Errorf("failed to send XOFF: %w", err)
+	}
+	return nil
+}
+
+// Stats implements Port. The errors of the driver are not counted on Windows.
+func (p *port) Stats() (Stats, error) {
+	return p.counters.stats(), nil
+}
+
+// SetBaudRate implements Port
+func (p *port) SetBaudRate(baud int) error {
+	return p.reconfigure(func(cfg *Config) { cfg.BaudRate = baud })
+}
+
+// SetDataBits implements Port
+func (p *port) SetDataBits(bits int) error {
+	return p.reconfigure(func(cfg *Config) { cfg.DataBits = bits })
+}
+
+// SetParity implements Port
+func (p *port) SetParity(parity Parity) error {
+	return p.reconfigure(func(cfg *Config) { cfg.Parity = parity })
+}
+
+// SetStopBits implements Port
+func (p *port) SetStopBits(stopBits StopBits) error {
+	return p.reconfigure(func(cfg *Config) { cfg.StopBits = stopBits })
+}
+
+// SetFlowControl implements Port
+func (p *port) SetFlowControl(fc FlowControl) error {
+	return p.reconfigure(func(cfg *Config) { cfg.FlowControl = fc })
+}
+
+// reconfigure applies the configuration of the port changed by update,
+// once the output written so far is transmitted.
+func (p *port) reconfigure(update func(cfg *Config)) error {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	cfg := p.cfg
+	update(&cfg)
+	if err := p.drain("reconfigure", func(h syscall.Handle) error { return configure(h, cfg, true) }); err != nil {
+		return fmt.Errorf("failed to reconfigure port: %w", err)
+	}
+	p.cfg = cfg
+	return nil
+}
+
+// Config implements Port
+func (p *port) Config() Config {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	return p.cfg
+}
+
+// SaveState implements Port. The state holds the DCB of the port.
+func (p *port) SaveState() (*State, error) {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	var sys *sysState
+	err := p.withHandle("save state", func(h syscall.Handle) (err error) {
+		sys, err = saveState(h)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save port state: %w", err)
+	}
+	return &State{Config: p.cfg, sys: sys}, nil
+}
+
+// RestoreState implements Port. The timeouts of the port are kept, since Read depends on them.
+func (p *port) RestoreState(s *State) error {
+	if s.sys == nil {
+		return p.reconfigure(func(cfg *Config) { cfg.setLine(s.Config) })
+	}
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+	err := p.drain("restore state", func(h syscall.Handle) error {
+		if err := syscall.FlushFileBuffers(h); err != nil {
+			return err
+		}
+		d := s.sys.dcb
+		return setCommState(h, &d)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore port state: %w", err)
+	}
+	p.cfg.setLine(s.Config)
+	return nil
+}
+
+// Events implements Port. The input is checked with ClearCommError periodically.
+func (p *port) Events() <-chan Event {
+	return p.events.start(p, p.Status)
+}
+
+// waitData waits until there is data to read, without reading it.
+func (p *port) waitData(done <-chan struct{}) error {
+	t := time.NewTicker(dataCheckInterval)
+	defer t.Stop()
+	for {
+		var commErrors uint32
+		var stat comstat
+		err := p.withHandle("wait", func(h syscall.Handle) error {
+			return callBool(procClearCommError, uintptr(h), uintptr(unsafe.Pointer(&commErrors)), uintptr(unsafe.Pointer(&stat)))
+		})
+		if err != nil {
+			return p.monitor.check(err)
+		}
+		if stat.cbInQue > 0 {
+			return nil
+		}
+		select {
+		case <-done:
+			return os.ErrClosed
+		case <-t.C:
+		}
+	}
+}
+
+// withHandle calls fn with the handle, which Close does not release meanwhile,
+// or fails with os.ErrClosed once the port is closed.
+func (p *port) withHandle(op string, fn func(h syscall.Handle) error) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return &os.PathError{Op: op, Path: p.name, Err: os.ErrClosed}
+	}
+	p.pending.Add(1)
+	p.mu.Unlock()
+	defer p.pending.Done()
+	return fn(p.h)
+}
+
+// drain is like withHandle, for fn which waits for the output to be transmitted.
+// Close discards the output meanwhile, which ends the wait.
+func (p *port) drain(op string, fn func(h syscall.Handle) error) error {
+	p.drains.Add(1)
+	defer p.drains.Add(-1)
+	return p.withHandle(op, fn)
+}
+
+// overlapped runs a single overlapped ReadFile or WriteFile and waits for its completion.
+// The operation is canceled once the time returned by deadline passes.
+// The deadline is re-evaluated every time wake is signaled.
+func (p *port) overlapped(op string, buf []byte, wake syscall.Handle, deadline func() time.Time,
+	fn func(syscall.Handle, []byte, *uint32, *syscall.Overlapped) error) (int, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return 0, &os.PathError{Op: op, Path: p.name, Err: os.ErrClosed}
+	}
+	p.pending.Add(1)
+	p.mu.Unlock()
+	defer p.pending.Done()
+
+	ev, err := createEvent(true)
+	if err != nil {
+		return 0, &os.PathError{Op: op, Path: p.name, Err: err}
+	}
+	defer syscall.CloseHandle(ev)
+
+	ov := syscall.Overlapped{HEvent: ev}
+	var n uint32
+	if err := fn(p.h, buf, &n, &ov); err != nil && err != syscall.ERROR_IO_PENDING {
+		return 0, &os.PathError{Op: op, Path: p.name, Err: err}
+	}
+	timedOut := false
+	handles := []syscall.Handle{ev, wake}
+	if wake == 0 {
+		handles = handles[:1]
+	}
+wait:
+	for {
+		ms := uint32(syscall.INFINITE)
+		if d := deadline(); !d.IsZero() {
+			left := time.Until(d)
+			if left <= 0 {
+				timedOut = true
+				syscall.CancelIoEx(p.h, &ov)
+				break
+			}
+			ms = uint32((left + time.Millisecond - 1) / time.Millisecond)
+		}
+		r, err := waitForMultipleObjects(handles, ms)
+		switch {
+		case err != nil:
+			syscall.CancelIoEx(p.h, &ov)
+			break wait
+		case r == syscall.WAIT_OBJECT_0:
+			break wait
+		}
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			syscall.CancelIoEx(p.h, &ov)
+			break
+		}
+		// Either the deadline has passed or it was changed; re-evaluate it.
+	}
+	if err := getOverlappedResult(p.h, &ov, &n, true); err != nil {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		switch {
+		case err != syscall.ERROR_OPERATION_ABORTED:
+		case timedOut:
+			err = os.ErrDeadlineExceeded
+		case closed:
+			err = os.ErrClosed
+		}
+		return int(n), &os.PathError{Op: op, Path: p.name, Err: err}
+	}
+	return int(n), nil
+}
+
+// openError wraps the error of opening a port with ErrPortBusy or ErrPermissionDenied, if it applies.
+// Windows reports a COM port opened by another process as ERROR_ACCESS_DENIED.
+func openError(err error) error {
+	switch {
+	case errors.Is(err, syscall.ERROR_ACCESS_DENIED), errors.Is(err, errorSharingViolation):
+		return fmt.Errorf("%w: %w", ErrPortBusy, err)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	}
+	return err
+}
+
+// isDisconnect reports whether err is caused by the disconnection of the device.
+// The drivers of USB adapters fail the pending and the later operations
+// with different errors, once the device is unplugged.
+func isDisconnect(err error) bool {
+	for _, e := range []syscall.Errno{
+		syscall.ERROR_ACCESS_DENIED,
+		errorGenFailure,
+		errorBadCommand,
+		errorDeviceNotConnected,
+	} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// dcb is the DCB structure of the Windows API which describes the settings of a COM port.
+type dcb struct {
+	DCBlength  uint32
+	BaudRate   uint32
+	flags      uint32
+	wReserved  uint16
+	XonLim     uint16
+	XoffLim    uint16
+	ByteSize   byte
+	Parity     byte
+	StopBits   byte
+	XonChar    byte
+	XoffChar   byte
+	ErrorChar  byte
+	EofChar    byte
+	EvtChar    byte
+	wReserved1 uint16
+}
+
+// Bit fields of dcb.flags.
+const (
+	dcbBinary              = 1 << 0
+	dcbParity              = 1 << 1
+	dcbOutxCtsFlow         = 1 << 2
+	dcbOutxDsrFlow         = 1 << 3
+	dcbDtrControlEnable    = 1 << 4
+	dcbDtrControlHandshake = 2 << 4
+	dcbDtrControlMask      = 3 << 4
+	dcbDsrSensitivity      = 1 << 6
+	dcbTXContinueOnXoff    = 1 << 7
+	dcbOutX                = 1 << 8
+	dcbInX                 = 1 << 9
+	dcbErrorChar           = 1 << 10
+	dcbNull                = 1 << 11
+	dcbRtsControlEnable    = 1 << 12
+	dcbRtsControlHandshake = 2 << 12
+	dcbRtsControlToggle    = 3 << 12
+	dcbRtsControlMask      = 3 << 12
+	dcbAbortOnError        = 1 << 14
+)
+
+const (
+	noParity    = 0
+	oddParity   = 1
+	evenParity  = 2
+	markParity  = 3
+	spaceParity = 4
+
+	oneStopBit   = 0
+	one5StopBits = 1
+	twoStopBits  = 2
+
+	maxDword = 0xFFFFFFFF
+
+	errorBadCommand         syscall.Errno = 22
+	errorGenFailure         syscall.Errno = 31
+	errorSharingViolation   syscall.Errno = 32
+	errorDeviceNotConnected syscall.Errno = 1167
+
+	// Functions of EscapeCommFunction.
+	setRTS = 3
+	clrRTS = 4
+	setDTR = 5
+	clrDTR = 6
+
+	// Flags of PurgeComm.
+	purgeTxAbort = 0x0001
+	purgeTxClear = 0x0004
+	purgeRxClear = 0x0008
+
+	// Bits returned by GetCommModemStatus.
+	msCTSOn  = 0x10
+	msDSROn  = 0x20
+	msRingOn = 0x40
+	msRLSDOn = 0x80
+)
+
+// comstat is the COMSTAT structure of the Windows API.
+type comstat struct {
+	flags    uint32
+	cbInQue  uint32
+	cbOutQue uint32
+}
+
+// commTimeouts is the COMMTIMEOUTS structure of the Windows API.
+type commTimeouts struct {
+	ReadIntervalTimeout         uint32
+	ReadTotalTimeoutMultiplier  uint32
+	ReadTotalTimeoutConstant    uint32
+	WriteTotalTimeoutMultiplier uint32
+	WriteTotalTimeoutConstant   uint32
+}
+
+func getCommState(h syscall.Handle, d *dcb) error {
+	return callBool(procGetCommState, uintptr(h), uintptr(unsafe.Pointer(d)))
+}
+
+func setCommState(h syscall.Handle, d *dcb) error {
+	return callBool(procSetCommState, uintptr(h), uintptr(unsafe.Pointer(d)))
+}
+
+func getCommTimeouts(h syscall.Handle, t *commTimeouts) error {
+	return callBool(procGetCommTimeouts, uintptr(h), uintptr(unsafe.Pointer(t)))
+}
+
+func setCommTimeouts(h syscall.Handle, t *commTimeouts) error {
+	return callBool(procSetCommTimeouts, uintptr(h), uintptr(unsafe.Pointer(t)))
+}
+
+func createEvent(manualReset bool) (syscall.Handle, error) {
+	var manual uintptr
+	if manualReset {
+		manual = 1
+	}
+	r, _, err := procCreateEventW.Call(0, manual, 0, 0)
+	if r == 0 {
+		return 0, err
+	}
+	return syscall.Handle(r), nil
+}
+
+func setEvent(h syscall.Handle) error {
+	return callBool(procSetEvent, uintptr(h))
+}
+
+func waitForMultipleObjects(handles []syscall.Handle, ms uint32) (uint32, error) {
+	r, _, err := procWaitForMultipleObjects.Call(uintptr(len(handles)),
+		uintptr(unsafe.Pointer(&handles[0])), 0, uintptr(ms))
+	if uint32(r) == syscall.WAIT_FAILED {
+		return 0, err
+	}
+	return uint32(r), nil
+}
+
+func getOverlappedResult(h syscall.Handle, ov *syscall.Overlapped, n *uint32, wait bool) error {
+	var w uintptr
+	if wait {
+		w = 1
+	}
+	return callBool(procGetOverlappedResult, uintptr(h), uintptr(unsafe.Pointer(ov)),
+		uintptr(unsafe.Pointer(n)), w)
+}
+
+// The modes of the console input, for SetConsoleMode.
+const (
+	enableProcessedInput       = 0x1
+	enableLineInput            = 0x2
+	enableEchoInput            = 0x4
+	enableVirtualTerminalInput = 0x200
+)
+
+// makeTerminalRaw switches the console behind h to raw input, for Terminal,
+// and returns the function which restores it. The keys are sent as VT sequences.
+func makeTerminalRaw(h uintptr) (func(), error) {
+	var mode uint32
+	if err := syscall.GetConsoleMode(syscall.Handle(h), &mode); err != nil {
+		return nil, err
+	}
+	raw := mode&^(enableProcessedInput|enableLineInput|enableEchoInput) | enableVirtualTerminalInput
+	if err := callBool(procSetConsoleMode, h, uintptr(raw)); err != nil {
+		return nil, err
+	}
+	return func() { callBool(procSetConsoleMode, h, uintptr(mode)) }, nil
+}
+
+// callBool calls a Windows API function which returns BOOL and reports errors via GetLastError.
+func callBool(proc *syscall.LazyProc, args ...uintptr) error {
+	r, _, err := proc.Call(args...)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
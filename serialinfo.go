@@ -0,0 +1,198 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// UARTType is the kind of UART behind a port, as reported by the serial driver of Linux.
+type UARTType int
+
+// The UART types of Linux, PORT_ in its serial_core.h.
+const (
+	UARTUnknown UARTType = iota // not a UART driven by the 8250 driver, like a USB adapter or a pty
+	UART8250
+	UART16450
+	UART16550
+	UART16550A
+	UARTCirrus
+	UART16650
+	UART16650V2
+	UART16750
+	UARTStartech
+	UART16C950
+	UART16654
+	UART16850
+	UARTRSA
+)
+
+var uartTypeNames = [...]string{
+	UARTUnknown:  "unknown",
+	UART8250:     "8250",
+	UART16450:    "16450",
+	UART16550:    "16550",
+	UART16550A:   "16550A",
+	UARTCirrus:   "Cirrus",
+	UART16650:    "ST16650",
+	UART16650V2:  "ST16650V2",
+	UART16750:    "TI16750",
+	UARTStartech: "Startech",
+	UART16C950:   "16C950/954",
+	UART16654:    "ST16654",
+	UART16850:    "XR16850",
+	UARTRSA:      "RSA",
+}
+
+func (t UARTType) String() string {
+	if t >= 0 && int(t) < len(uartTypeNames) {
+		return uartTypeNames[t]
+	}
+	return "UART type " + strconv.Itoa(int(t))
+}
+
+// SerialFlags are the flags of the serial driver of Linux, ASYNC_ in its serial.h.
+type SerialFlags uint32
+
+const (
+	SerialHupNotify      SerialFlags = 1 << 0  // notify getty on hangups and closes on the callout port
+	SerialFourPort       SerialFlags = 1 << 1  // set OUT1 and OUT2 in IRQ-sharing boards
+	SerialSAK            SerialFlags = 1 << 2  // secure attention key
+	SerialSplitTermios   SerialFlags = 1 << 3  // separate termios for the dial-in and callout ports
+	SerialSpdHi          SerialFlags = 1 << 4  // 38400 bps means 57600
+	SerialSpdVHi         SerialFlags = 1 << 5  // 38400 bps means 115200
+	SerialSkipTest       SerialFlags = 1 << 6  // skip the UART test during autoconfiguration
+	SerialAutoIRQ        SerialFlags = 1 << 7  // probe the IRQ during autoconfiguration
+	SerialSessionLockout SerialFlags = 1 << 8  // lock out the callout port across different sessions
+	SerialPgrpLockout    SerialFlags = 1 << 9  // lock out the callout port across different process groups
+	SerialCalloutNoHup   SerialFlags = 1 << 10 // do not hang up when the callout port is closed
+	SerialHardPPSCD      SerialFlags = 1 << 11 // call the PPS hardpps hook on carrier detect
+	SerialSpdShi         SerialFlags = 1 << 12 // 38400 bps means 230400
+	SerialLowLatency     SerialFlags = 1 << 13 // push the input to the reader without delay
+	SerialBuggyUART      SerialFlags = 1 << 14 // the UART is buggy, do not trust its FIFO size
+	SerialAutoProbe      SerialFlags = 1 << 15 // the port was autoprobed by PCI or PnP
+
+	// SerialSpdCust means that 38400 bps is BaseBaud / CustomDivisor, see SetCustomDivisor.
+	SerialSpdCust = SerialSpdHi | SerialSpdVHi
+	// SerialSpdMask covers the flags changing the meaning of 38400 bps.
+	SerialSpdMask = SerialSpdHi | SerialSpdVHi | SerialSpdShi
+)
+
+// spdCustRate is the baud rate the serial driver of Linux replaces, according to the SPD flags.
+const spdCustRate = 38400
+
+// SerialInfo is the configuration of the serial driver of Linux for a port, its serial_struct,
+// read with the TIOCGSERIAL ioctl, and written with TIOCSSERIAL, like by setserial.
+type SerialInfo struct {
+	Type  UARTType
+	Line  int    // the index of the port in the driver, like 0 for ttyS0
+	Port  uint64 // the I/O port of the UART, if any
+	IRQ   int
+	Flags SerialFlags
+
+	XmitFIFOSize int // the size of the transmit FIFO of the UART, in bytes
+
+	// BaseBaud is the clock of the UART divided by 16: its highest baud rate, with a divisor of 1.
+	// CustomDivisor divides it for 38400 bps when Flags has SerialSpdCust.
+	BaseBaud      int
+	CustomDivisor int
+
+	// CloseDelay is how long DTR is kept low on close, before the port may be opened again.
+	// ClosingWait is how long the close waits for the output to drain, -1 for no wait, and 0 for no limit.
+	// Both are rounded to 10 ms.
+	CloseDelay  time.Duration
+	ClosingWait time.Duration
+
+	IOType        int     // how the registers are accessed, UPIO_ in serial_core.h
+	IOMemBase     uintptr // the memory address of the registers, if they are memory-mapped
+	IOMemRegShift int     // the spacing of the registers, as a power of two
+}
+
+// IsUART reports whether the port is a real UART, with registers in I/O space or memory,
+// rather than a USB adapter or a virtual tty emulating one.
+func (s SerialInfo) IsUART() bool {
+	return s.Type != UARTUnknown && (s.Port != 0 || s.IOMemBase != 0)
+}
+
+// GetSerialInfo returns the configuration of the serial driver for the port.
+// It is only supported on Linux; the ttys of the drivers without it, like ptys,
+// return an error wrapping errors.ErrUnsupported.
+func GetSerialInfo(p Port) (SerialInfo, error) {
+	var info SerialInfo
+	err := serialInfoControl(p, func(fd uintptr) error {
+		var err error
+		info, err = getSerialInfo(fd)
+		return err
+	})
+	return info, err
+}
+
+// SetSerialInfo changes the configuration of the serial driver for the port, typically as
+// modified from GetSerialInfo. Most changes need CAP_SYS_ADMIN, like the type, the I/O port,
+// the IRQ and BaseBaud; the others, like Flags and CustomDivisor, may be changed by any user
+// who can open the port. The new flags apply to the next change of the baud rate.
+func SetSerialInfo(p Port, info SerialInfo) error {
+	return serialInfoControl(p, func(fd uintptr) error {
+		return setSerialInfo(fd, info)
+	})
+}
+
+// SetCustomDivisor sets the baud rate of the port to the rate of the UART closest to baud,
+// with the custom divisor of the serial driver, the spd_cust of setserial, and returns it.
+// It is meant for the legacy UARTs whose driver only supports the standard rates through termios;
+// the others get arbitrary rates with Config.BaudRate. The port is then configured for 38400 bps,
+// which the driver replaces with the custom rate, so Config reports 38400; setting another rate
+// unsets it, but the driver keeps the flag for the next time the rate is 38400,
+// until UnsetCustomDivisor is called.
+func SetCustomDivisor(p Port, baud int) (int, error) {
+	if baud <= 0 {
+		return 0, fmt.Errorf("%w: %v", ErrUnsupportedBaudRate, baud)
+	}
+	info, err := GetSerialInfo(p)
+	if err != nil {
+		return 0, err
+	}
+	if info.BaseBaud <= 0 {
+		return 0, fmt.Errorf("custom divisor: the base baud rate of the port is unknown: %w", errors.ErrUnsupported)
+	}
+	div := max(int(math.Round(float64(info.BaseBaud)/float64(baud))), 1)
+	info.Flags = info.Flags&^SerialSpdMask | SerialSpdCust
+	info.CustomDivisor = div
+	if err := SetSerialInfo(p, info); err != nil {
+		return 0, err
+	}
+	if err := p.SetBaudRate(spdCustRate); err != nil {
+		return 0, err
+	}
+	return info.BaseBaud / div, nil
+}
+
+// UnsetCustomDivisor clears the custom divisor set by SetCustomDivisor, so that 38400 bps means 38400 again.
+func UnsetCustomDivisor(p Port) error {
+	info, err := GetSerialInfo(p)
+	if err != nil {
+		return err
+	}
+	info.Flags &^= SerialSpdMask
+	info.CustomDivisor = 0
+	return SetSerialInfo(p, info)
+}
+
+// serialInfoControl calls fn with the descriptor of the port.
+func serialInfoControl(p Port, fn func(fd uintptr) error) error {
+	rc, err := p.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("serial info: %w", err)
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) { ferr = fn(fd) }); err != nil {
+		return err
+	}
+	if ferr == syscall.ENOTTY || ferr == syscall.EINVAL {
+		return fmt.Errorf("serial info: %w", errors.ErrUnsupported)
+	}
+	return ferr
+}
@@ -0,0 +1,232 @@
+package serialtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+// DefaultDeviceInput is how much of the input a Device keeps without a match, unless configured otherwise.
+const DefaultDeviceInput = 4096
+
+// Rule is a rule of a Device: once the input matches it, the device responds.
+type Rule struct {
+	// Expect is the input the rule responds to, as it is, like []byte("AT+CSQ\r").
+	Expect []byte
+
+	// Match, if not nil, is the regexp the input is matched with, instead of Expect.
+	// Respond is then expanded with the submatches, like by regexp.Regexp.Expand: $1 is the first one,
+	// and $$ is a dollar sign. Since the input arrives bit by bit, the regexp should match its end
+	// explicitly, like a line terminator, so that it does not match a part of the command only.
+	Match *regexp.Regexp
+
+	// Respond is sent in response. It may be empty, for the commands to be consumed silently.
+	Respond []byte
+
+	// Delay is how long the device waits before responding, like a modem dialing.
+	Delay time.Duration
+
+	// Every, for a rule without Expect and Match, sends Respond unsolicited, every Every,
+	// like the sentences of a GPS receiver. Such a rule sends first after Delay, and only once if Every is zero.
+	Every time.Duration
+}
+
+// unsolicited reports whether the rule sends without input.
+func (r *Rule) unsolicited() bool {
+	return r.Match == nil && len(r.Expect) == 0
+}
+
+// Device is a scripted fake device, serving one end of a Pipe, or the master of a pty,
+// so that the code talking to a device, like an AT modem or a GPS receiver, can be tested
+// through a whole exchange without the hardware:
+//
+//	dev := &serialtest.Device{Rules: []serialtest.Rule{
+//		{Expect: []byte("AT\r"), Respond: []byte("\r\nOK\r\n")},
+//		{Match: regexp.MustCompile(`AT\+CPIN=(\d+)\r`), Respond: []byte("\r\n+CPIN: $1\r\nOK\r\n"), Delay: 50 * time.Millisecond},
+//		{Respond: []byte("$GPGGA,...*47\r\n"), Every: time.Second},
+//	}}
+//	p := dev.Pipe(serialtest.Config{BaudRate: 115200})
+//
+// The input is matched against the rules as it arrives. The match starting first wins,
+// and the first rule among the ones matching at the same position; the input up to the end
+// of the match is consumed, and the input before it is dropped as noise.
+type Device struct {
+	Rules []Rule
+
+	// MaxInput is how much of the input is kept without a match; the oldest input is dropped beyond.
+	// Zero means DefaultDeviceInput.
+	MaxInput int
+
+	// OnNoise, if not nil, is called with the input dropped without a match.
+	OnNoise func(noise []byte)
+}
+
+// Pipe returns one end of a Pipe, whose other end is served by the device until the returned port is closed.
+func (d *Device) Pipe(cfg Config) *Port {
+	a, b := Pipe(cfg)
+	go func() {
+		d.Serve(context.Background(), b)
+		b.Close()
+	}()
+	return a
+}
+
+// Serve responds to the input of p, following the rules, until the other end closes, which returns nil,
+// or until ctx is done, which returns its error. The responses are sent in order, each after its delay,
+// and the unsolicited ones meanwhile. Serve uses the read deadline of p, and clears it before returning.
+// The master of a pty reports the close of its slave as an error, like EIO on Linux, which Serve returns.
+func (d *Device) Serve(ctx context.Context, p serial.Port) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wmu sync.Mutex
+	write := func(b []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		_, err := p.Write(b)
+		return err
+	}
+	var wg sync.WaitGroup
+	errc := make(chan error, len(d.Rules))
+	for i := range d.Rules {
+		if r := &d.Rules[i]; r.unsolicited() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := d.repeat(ctx, r, write); err != nil {
+					errc <- err
+					cancel()
+				}
+			}()
+		}
+	}
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		p.SetReadDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+	defer func() {
+		if !stop() {
+			<-interrupted
+		}
+		cancel()
+		wg.Wait()
+		p.SetReadDeadline(time.Time{})
+	}()
+
+	maxInput := d.MaxInput
+	if maxInput <= 0 {
+		maxInput = DefaultDeviceInput
+	}
+	var in []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := p.Read(buf)
+		in = append(in, buf[:n]...)
+		for {
+			r, start, end, resp := d.match(in)
+			if r == nil {
+				break
+			}
+			d.noise(in[:start])
+			in = in[end:]
+			if !sleep(ctx, r.Delay) {
+				break
+			}
+			if err := write(resp); err != nil {
+				return d.served(ctx, errc, err)
+			}
+		}
+		if len(in) > maxInput {
+			d.noise(in[:len(in)-maxInput])
+			in = append(in[:0], in[len(in)-maxInput:]...)
+		}
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() == nil {
+				// Config.ReadTimeout of the port.
+				continue
+			}
+			return d.served(ctx, errc, err)
+		}
+	}
+}
+
+// served returns the outcome of Serve, ended by err.
+func (d *Device) served(ctx context.Context, errc chan error, err error) error {
+	select {
+	case err = <-errc:
+	default:
+	}
+	switch {
+	case err == io.EOF || errors.Is(err, io.ErrClosedPipe):
+		return nil
+	case ctx.Err() != nil && errors.Is(err, os.ErrDeadlineExceeded):
+		return ctx.Err()
+	}
+	return err
+}
+
+// match returns the rule matching first in the input, the position of the match, and the response.
+func (d *Device) match(in []byte) (rule *Rule, start, end int, resp []byte) {
+	start = len(in) + 1
+	for i := range d.Rules {
+		r := &d.Rules[i]
+		switch {
+		case r.Match != nil:
+			// An empty match would match forever.
+			if m := r.Match.FindSubmatchIndex(in); m != nil && m[1] > m[0] && m[0] < start {
+				rule, start, end = r, m[0], m[1]
+				resp = r.Match.Expand(nil, r.Respond, in, m)
+			}
+		case len(r.Expect) > 0:
+			if j := bytes.Index(in, r.Expect); j >= 0 && j < start {
+				rule, start, end, resp = r, j, j+len(r.Expect), r.Respond
+			}
+		}
+	}
+	return rule, start, end, resp
+}
+
+// repeat sends the unsolicited response of the rule, until ctx is done or the other end closes.
+func (d *Device) repeat(ctx context.Context, r *Rule, write func([]byte) error) error {
+	if !sleep(ctx, r.Delay) {
+		return nil
+	}
+	for {
+		if err := write(r.Respond); err != nil {
+			if errors.Is(err, io.ErrClosedPipe) || errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if r.Every <= 0 || !sleep(ctx, r.Every) {
+			return nil
+		}
+	}
+}
+
+func (d *Device) noise(b []byte) {
+	if len(b) > 0 && d.OnNoise != nil {
+		d.OnNoise(b)
+	}
+}
+
+// sleep waits for d, and reports whether ctx is still running.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
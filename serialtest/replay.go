@@ -0,0 +1,87 @@
+package serialtest
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+// ReplayConfig describes how Replay plays a capture back.
+type ReplayConfig struct {
+	// Speed scales the timing of the capture: 2 plays it twice as fast. Zero means 1, the original timing.
+	Speed float64
+
+	// IgnoreWrites, if true, plays the data read with the timing of the capture from the start,
+	// regardless of the data written to the port. Otherwise, the replay waits for the data of every
+	// recorded write to be written, and plays the data read after it with the timing relative to it,
+	// like the device would respond to the requests of the program.
+	IgnoreWrites bool
+
+	// OnMismatch, if not nil, is called when the data written differs from the recorded write,
+	// with both. The replay continues either way.
+	OnMismatch func(recorded, written []byte)
+}
+
+// Replay returns a port which plays back a capture recorded with serial.CaptureTrace, like to reproduce
+// a session of the field on a desk: it receives the data recorded as read, with the timing of the capture,
+// and takes the data written. Once the capture is played, the port reads io.EOF.
+func Replay(capture io.Reader, cfg ReplayConfig) (*Port, error) {
+	var records []serial.CaptureRecord
+	cr := serial.NewCaptureReader(capture)
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if cfg.Speed <= 0 {
+		cfg.Speed = 1
+	}
+	p, dev := Pipe(Config{})
+	go replay(dev, records, cfg)
+	return p, nil
+}
+
+// replay plays the records on the device end of the pipe, until they are played or the port is closed.
+func replay(dev *Port, records []serial.CaptureRecord, cfg ReplayConfig) {
+	defer dev.Close()
+	if cfg.IgnoreWrites {
+		go io.Copy(io.Discard, dev)
+	}
+	// The time of the replay which corresponds to the time of the capture recStart.
+	start := time.Now()
+	var recStart time.Time
+	if len(records) > 0 {
+		recStart = records[0].Time
+	}
+	for _, rec := range records {
+		switch rec.Dir {
+		case serial.DirRead:
+			at := start.Add(time.Duration(float64(rec.Time.Sub(recStart)) / cfg.Speed))
+			if d := time.Until(at); d > 0 {
+				time.Sleep(d)
+			}
+			if _, err := dev.Write(rec.Data); err != nil {
+				return
+			}
+		case serial.DirWrite:
+			if cfg.IgnoreWrites {
+				continue
+			}
+			written := make([]byte, len(rec.Data))
+			if _, err := io.ReadFull(dev, written); err != nil {
+				return
+			}
+			if cfg.OnMismatch != nil && !bytes.Equal(written, rec.Data) {
+				cfg.OnMismatch(rec.Data, written)
+			}
+			start, recStart = time.Now(), rec.Time
+		}
+	}
+}
@@ -0,0 +1,717 @@
+// Package serialtest provides an in-memory implementation of serial.Port,
+// so the code talking to serial devices can be tested without the hardware.
+package serialtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+// Config describes the simulated line between the two ends of a Pipe.
+type Config struct {
+	// BaudRate, if positive, paces the transfer: every byte takes the time
+	// of its bits at this rate to be transmitted, which is 10 bits with 8N1
+	// (the start and stop bits included). Zero means the bytes are transmitted instantly.
+	BaudRate int
+
+	// Latency is the delay between the transmission of a byte and its reception.
+	Latency time.Duration
+
+	// Faults is the noise of the line, in both directions.
+	Faults Faults
+}
+
+// Faults describes the errors of a simulated line, like to check the retries and the CRCs of a protocol.
+// The probabilities are between 0, never, and 1, always. The faults are drawn from a source seeded
+// with Seed, so that a test fails the same way every time it runs.
+type Faults struct {
+	// Corrupt, Drop and Duplicate are the probabilities of each byte written to be received
+	// with a bit flipped, to be lost, and to be received twice.
+	Corrupt   float64
+	Drop      float64
+	Duplicate float64
+
+	// Jitter, if positive, delays every Write by a random time up to Jitter,
+	// like the buffering of a USB adapter, on top of Config.Latency.
+	Jitter time.Duration
+
+	// ReadError is the probability of each Read to fail with syscall.EIO, like on a line error.
+	// The following Read continues normally.
+	ReadError float64
+
+	// Disconnect is the probability of each Read and Write to disconnect the port, like by Port.Disconnect.
+	Disconnect float64
+
+	Seed int64
+}
+
+// Pipe creates a pair of connected ports, like a null-modem cable:
+// the data written to one end is read from the other one, and the DTR and RTS
+// lines of one end drive the DSR/DCD and CTS lines of the other one.
+func Pipe(cfg Config) (*Port, *Port) {
+	pp := &pipe{changed: make(chan struct{}), rand: rand.New(rand.NewSource(cfg.Faults.Seed))}
+	ab := &line{latency: cfg.Latency, faults: cfg.Faults}
+	ba := &line{latency: cfg.Latency, faults: cfg.Faults}
+	a := &Port{pipe: pp, in: ba, out: ab, done: make(chan struct{}), dtr: true, rts: true, baud: cfg.BaudRate, dataBits: 8}
+	b := &Port{pipe: pp, in: ab, out: ba, done: make(chan struct{}), dtr: true, rts: true, baud: cfg.BaudRate, dataBits: 8}
+	a.peer, b.peer = b, a
+	a.setCharTime()
+	b.setCharTime()
+	return a, b
+}
+
+// pipe holds the state shared by both ends of a Pipe.
+type pipe struct {
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced on every change of the state
+	rand    *rand.Rand    // draws the faults
+}
+
+// fault draws whether a fault of probability prob happens. Must be called with mu held.
+func (pp *pipe) fault(prob float64) bool {
+	return prob > 0 && pp.rand.Float64() < prob
+}
+
+// noise returns buf as received through a line with the faults f. Must be called with mu held.
+func (pp *pipe) noise(buf []byte, f Faults) []byte {
+	if f.Corrupt <= 0 && f.Drop <= 0 && f.Duplicate <= 0 {
+		return buf
+	}
+	noisy := make([]byte, 0, len(buf))
+	for _, c := range buf {
+		if pp.fault(f.Drop) {
+			continue
+		}
+		if pp.fault(f.Corrupt) {
+			c ^= 1 << pp.rand.Intn(8)
+		}
+		noisy = append(noisy, c)
+		if pp.fault(f.Duplicate) {
+			noisy = append(noisy, c)
+		}
+	}
+	return noisy
+}
+
+// jitter returns the time a Write at now starts to be transmitted through a line with the faults f.
+// Must be called with mu held.
+func (pp *pipe) jitter(now time.Time, f Faults) time.Time {
+	if f.Jitter <= 0 {
+		return now
+	}
+	return now.Add(time.Duration(pp.rand.Int63n(int64(f.Jitter))))
+}
+
+// notify wakes up all the calls waiting for a change of the state. Must be called with mu held.
+func (pp *pipe) notify() {
+	close(pp.changed)
+	pp.changed = make(chan struct{})
+}
+
+// wait releases mu until the state changes or until the time t, if not zero.
+func (pp *pipe) wait(t time.Time) {
+	changed := pp.changed
+	pp.mu.Unlock()
+	defer pp.mu.Lock()
+	if t.IsZero() {
+		<-changed
+		return
+	}
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-changed:
+	case <-timer.C:
+	}
+}
+
+// Port is one end of a Pipe. It implements serial.Port.
+type Port struct {
+	pipe *pipe
+	peer *Port
+	in   *line         // the data received from the peer
+	out  *line         // the data sent to the peer
+	done chan struct{} // closed by Close
+
+	// guarded by pipe.mu
+	closed        bool
+	disconnected  bool
+	dtr, rts      bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readErr       error
+	writeErr      error
+	stats         serial.Stats
+	events        chan serial.Event
+
+	// the parameters of the line
+	baud     int
+	dataBits int
+	parity   serial.Parity
+	stopBits serial.StopBits
+	flow     serial.FlowControl
+	software serial.SoftwareFlowConfig
+}
+
+var _ serial.Port = (*Port)(nil)
+
+// InjectReadError makes the next Read return err.
+func (p *Port) InjectReadError(err error) {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.readErr = err
+	p.pipe.notify()
+}
+
+// InjectWriteError makes the next Write return err.
+func (p *Port) InjectWriteError(err error) {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.writeErr = err
+}
+
+// Disconnect makes the later Reads and Writes of the port fail with serial.ErrPortDisconnected,
+// wrapping syscall.EIO, like when the device of a port is unplugged. The data sent by the peer is lost.
+func (p *Port) Disconnect() {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.disconnected = true
+	p.pipe.notify()
+}
+
+// SetFaults changes the faults of the data written by the port from now on.
+func (p *Port) SetFaults(f Faults) {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.out.faults = f
+}
+
+// errDisconnected is returned by the operations of a disconnected port.
+var errDisconnected = fmt.Errorf("%w: %w", serial.ErrPortDisconnected, syscall.EIO)
+
+// Read implements io.Reader
+func (p *Port) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements serial.Port. The time is when the first byte read was received,
+// at the pace of the configured baud rate and latency, which may be before the call.
+func (p *Port) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.stats.Reads++
+	// The faults are drawn once per Read, however many times it waits for the data.
+	disconnect := p.pipe.fault(p.in.faults.Disconnect)
+	readError := p.pipe.fault(p.in.faults.ReadError)
+	for {
+		if p.closed {
+			return 0, time.Time{}, os.ErrClosed
+		}
+		if err := p.readErr; err != nil {
+			p.readErr = nil
+			return 0, time.Time{}, err
+		}
+		if p.disconnected || disconnect {
+			p.disconnected = true
+			p.in.chunks = nil
+			return 0, time.Time{}, errDisconnected
+		}
+		now := time.Now()
+		if len(buf) == 0 {
+			return 0, now, nil
+		}
+		ts := p.in.nextArrival()
+		if readError && p.in.available(now) {
+			return 0, time.Time{}, syscall.EIO
+		}
+		if n := p.in.read(buf, now); n > 0 {
+			p.stats.BytesRead += uint64(n)
+			p.stats.LastRead = now
+			p.pipe.notify()
+			return n, ts, nil
+		}
+		if p.peer.closed && p.in.empty() {
+			return 0, time.Time{}, io.EOF
+		}
+		until := p.in.nextArrival()
+		if d := p.readDeadline; !d.IsZero() {
+			if !now.Before(d) {
+				return 0, time.Time{}, os.ErrDeadlineExceeded
+			}
+			if until.IsZero() || d.Before(until) {
+				until = d
+			}
+		}
+		p.pipe.wait(until)
+	}
+}
+
+// Write implements io.Writer. The data is buffered, and transmitted to the peer
+// at the pace of the configured baud rate. Write does not block, but fails once
+// the write deadline has passed.
+func (p *Port) Write(buf []byte) (int, error) {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.stats.Writes++
+	if p.closed {
+		return 0, os.ErrClosed
+	}
+	if err := p.writeErr; err != nil {
+		p.writeErr = nil
+		return 0, err
+	}
+	if p.disconnected || p.pipe.fault(p.out.faults.Disconnect) {
+		p.disconnected = true
+		return 0, errDisconnected
+	}
+	if p.peer.closed {
+		return 0, io.ErrClosedPipe
+	}
+	now := time.Now()
+	if d := p.writeDeadline; !d.IsZero() && !now.Before(d) {
+		return 0, &serial.WriteTimeoutError{}
+	}
+	// The data written to a disconnected peer is lost, like on an unplugged cable.
+	if !p.peer.disconnected {
+		p.out.write(p.pipe.noise(buf, p.out.faults), p.pipe.jitter(now, p.out.faults))
+	}
+	if len(buf) > 0 {
+		p.stats.BytesWritten += uint64(len(buf))
+		p.stats.LastWrite = now
+	}
+	p.pipe.notify()
+	return len(buf), nil
+}
+
+// Close implements io.Closer. The peer reads the data already sent, and then io.EOF.
+func (p *Port) Close() error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	p.closed = true
+	close(p.done)
+	p.pipe.notify()
+	return nil
+}
+
+// SetReadDeadline implements serial.Port
+func (p *Port) SetReadDeadline(t time.Time) error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.readDeadline = t
+	p.pipe.notify()
+	return nil
+}
+
+// SetWriteDeadline implements serial.Port
+func (p *Port) SetWriteDeadline(t time.Time) error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	p.writeDeadline = t
+	return nil
+}
+
+// SetDTR implements serial.Port
+func (p *Port) SetDTR(on bool) error {
+	return p.setLine(&p.dtr, on)
+}
+
+// SetRTS implements serial.Port
+func (p *Port) SetRTS(on bool) error {
+	return p.setLine(&p.rts, on)
+}
+
+func (p *Port) setLine(l *bool, on bool) error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	*l = on
+	p.pipe.notify()
+	return nil
+}
+
+// Status implements serial.Port. The lines are wired like in a null-modem cable.
+func (p *Port) Status() (serial.ModemStatus, error) {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	if p.closed {
+		return serial.ModemStatus{}, os.ErrClosed
+	}
+	return p.status(), nil
+}
+
+// status returns the state of the lines driven by the peer. Must be called with pipe.mu held.
+func (p *Port) status() serial.ModemStatus {
+	peer := p.peer
+	return serial.ModemStatus{
+		CTS: !peer.closed && peer.rts,
+		DSR: !peer.closed && peer.dtr,
+		DCD: !peer.closed && peer.dtr,
+	}
+}
+
+// Drain implements serial.Port
+func (p *Port) Drain() error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	for {
+		if p.closed {
+			return os.ErrClosed
+		}
+		if !time.Now().Before(p.out.txEnd) {
+			return nil
+		}
+		p.pipe.wait(p.out.txEnd)
+	}
+}
+
+// ResetInput implements serial.Port
+func (p *Port) ResetInput() error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	p.in.discardReceived(time.Now())
+	return nil
+}
+
+// ResetOutput implements serial.Port
+func (p *Port) ResetOutput() error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	p.out.discardPending(time.Now())
+	p.pipe.notify()
+	return nil
+}
+
+// Break implements serial.Port
+func (p *Port) Break(d time.Duration) error {
+	p.pipe.mu.Lock()
+	closed := p.closed
+	p.pipe.mu.Unlock()
+	if closed {
+		return os.ErrClosed
+	}
+	time.Sleep(d)
+	return nil
+}
+
+// SendXON implements serial.Port. The character is written like by Write, DC1 unless
+// the configuration restored by RestoreState has another one.
+func (p *Port) SendXON() error {
+	on := p.Config().SoftwareFlow.XON
+	if on == 0 {
+		on = 0x11
+	}
+	_, err := p.Write([]byte{on})
+	return err
+}
+
+// SendXOFF implements serial.Port. The character is written like by Write, DC3 unless
+// the configuration restored by RestoreState has another one.
+func (p *Port) SendXOFF() error {
+	off := p.Config().SoftwareFlow.XOFF
+	if off == 0 {
+		off = 0x13
+	}
+	_, err := p.Write([]byte{off})
+	return err
+}
+
+// Stats implements serial.Port. The pipe has no driver, so the error counters stay zero.
+func (p *Port) Stats() (serial.Stats, error) {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	return p.stats, nil
+}
+
+// Events implements serial.Port
+func (p *Port) Events() <-chan serial.Event {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	if p.events == nil {
+		p.events = make(chan serial.Event, 16)
+		go p.reportEvents(p.events)
+	}
+	return p.events
+}
+
+// reportEvents sends the events of the port to ch, until the port is closed.
+func (p *Port) reportEvents(ch chan serial.Event) {
+	defer close(ch)
+	p.pipe.mu.Lock()
+	last := p.status()
+	reported := ^uint64(0) // the number of Read calls when DataReady was sent
+	for {
+		if p.closed {
+			p.pipe.mu.Unlock()
+			select {
+			case ch <- serial.Event{Type: serial.Closed}:
+			default:
+			}
+			return
+		}
+		now := time.Now()
+		var ev serial.Event
+		if s := p.status(); s != last {
+			last = s
+			ev = serial.Event{Type: serial.LineStateChanged, Status: s}
+		} else if p.stats.Reads != reported && p.in.available(now) {
+			reported = p.stats.Reads
+			ev = serial.Event{Type: serial.DataReady}
+		} else {
+			var until time.Time
+			if p.stats.Reads != reported {
+				until = p.in.nextArrival()
+			}
+			p.pipe.wait(until)
+			continue
+		}
+		p.pipe.mu.Unlock()
+		select {
+		case ch <- ev:
+		case <-p.done:
+		}
+		p.pipe.mu.Lock()
+	}
+}
+
+// SetBaudRate implements serial.Port. The data written afterwards is paced at the new rate.
+// Unlike the real lines, the pipe delivers the data even if the rates of both ends differ.
+func (p *Port) SetBaudRate(baud int) error {
+	if baud <= 0 {
+		return fmt.Errorf("%w: %v", serial.ErrUnsupportedBaudRate, baud)
+	}
+	return p.reconfigure(func() { p.baud = baud })
+}
+
+// SetDataBits implements serial.Port
+func (p *Port) SetDataBits(bits int) error {
+	if bits == 0 {
+		bits = 8
+	}
+	if bits < 5 || bits > 8 {
+		return fmt.Errorf("unsupported data bits: %v", bits)
+	}
+	return p.reconfigure(func() { p.dataBits = bits })
+}
+
+// SetParity implements serial.Port
+func (p *Port) SetParity(parity serial.Parity) error {
+	switch parity {
+	case serial.ParityNone, serial.ParityOdd, serial.ParityEven, serial.ParityMark, serial.ParitySpace:
+	default:
+		return fmt.Errorf("unsupported parity: %v", parity)
+	}
+	return p.reconfigure(func() { p.parity = parity })
+}
+
+// SetStopBits implements serial.Port
+func (p *Port) SetStopBits(stopBits serial.StopBits) error {
+	switch stopBits {
+	case serial.OneStopBit, serial.TwoStopBits:
+	default:
+		return fmt.Errorf("unsupported stop bits: %v", stopBits)
+	}
+	return p.reconfigure(func() { p.stopBits = stopBits })
+}
+
+// SetFlowControl implements serial.Port. The pipe does not simulate flow control.
+func (p *Port) SetFlowControl(fc serial.FlowControl) error {
+	switch fc {
+	case serial.FlowNone, serial.FlowHardware, serial.FlowSoftware:
+	default:
+		return fmt.Errorf("unsupported flow control: %v", fc)
+	}
+	return p.reconfigure(func() { p.flow = fc })
+}
+
+// Config implements serial.Port. Only the parameters of the line are set.
+func (p *Port) Config() serial.Config {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	return serial.Config{BaudRate: p.baud, DataBits: p.dataBits, Parity: p.parity, StopBits: p.stopBits, FlowControl: p.flow, SoftwareFlow: p.software}
+}
+
+// SaveState implements serial.Port. The state is the configuration of the port.
+func (p *Port) SaveState() (*serial.State, error) {
+	p.pipe.mu.Lock()
+	closed := p.closed
+	p.pipe.mu.Unlock()
+	if closed {
+		return nil, os.ErrClosed
+	}
+	return &serial.State{Config: p.Config()}, nil
+}
+
+// RestoreState implements serial.Port
+func (p *Port) RestoreState(s *serial.State) error {
+	c := s.Config
+	if c.DataBits == 0 {
+		c.DataBits = 8
+	}
+	return p.reconfigure(func() {
+		p.baud, p.dataBits, p.parity, p.stopBits, p.flow = c.BaudRate, c.DataBits, c.Parity, c.StopBits, c.FlowControl
+		p.software = c.SoftwareFlow
+	})
+}
+
+// SyscallConn implements serial.Port. The simulated port has no descriptor.
+func (p *Port) SyscallConn() (syscall.RawConn, error) {
+	return nil, fmt.Errorf("serialtest: raw connection: %w", errors.ErrUnsupported)
+}
+
+// Fd implements serial.Port. It returns ^uintptr(0), as the simulated port has no descriptor.
+func (p *Port) Fd() uintptr { return ^uintptr(0) }
+
+func (p *Port) reconfigure(update func()) error {
+	p.pipe.mu.Lock()
+	defer p.pipe.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	update()
+	p.setCharTime()
+	return nil
+}
+
+// setCharTime updates the time to transmit one byte from the parameters of the line.
+// Must be called with pipe.mu held.
+func (p *Port) setCharTime() {
+	if p.baud <= 0 {
+		p.out.charTime = 0
+		return
+	}
+	bits := 1 + p.dataBits + 1 // the start and stop bits
+	if p.parity != serial.ParityNone {
+		bits++
+	}
+	if p.stopBits == serial.TwoStopBits {
+		bits++
+	}
+	p.out.charTime = time.Duration(bits) * time.Second / time.Duration(p.baud)
+}
+
+// line is one direction of a Pipe.
+type line struct {
+	charTime time.Duration // the time to transmit one byte of the next chunk
+	latency  time.Duration
+	faults   Faults
+
+	chunks []*chunk
+	txEnd  time.Time // when the transmission of the last chunk ends
+}
+
+// chunk is the data of one Write.
+type chunk struct {
+	data     []byte
+	off      int           // the number of bytes already read
+	start    time.Time     // when the transmission of data[0] starts
+	charTime time.Duration // the time to transmit one byte
+}
+
+func (l *line) write(buf []byte, now time.Time) {
+	start := now
+	if start.Before(l.txEnd) {
+		start = l.txEnd
+	}
+	l.chunks = append(l.chunks, &chunk{data: append([]byte(nil), buf...), start: start, charTime: l.charTime})
+	l.txEnd = start.Add(time.Duration(len(buf)) * l.charTime)
+}
+
+// sent returns the number of bytes of c transmitted by the time t.
+func (l *line) sent(c *chunk, t time.Time) int {
+	if t.Before(c.start) {
+		return 0
+	}
+	if c.charTime == 0 {
+		return len(c.data)
+	}
+	n := int(t.Sub(c.start) / c.charTime)
+	if n > len(c.data) {
+		n = len(c.data)
+	}
+	return n
+}
+
+// received returns the number of bytes of c received by the time t.
+func (l *line) received(c *chunk, t time.Time) int {
+	return l.sent(c, t.Add(-l.latency))
+}
+
+func (l *line) read(buf []byte, now time.Time) int {
+	var n int
+	for len(l.chunks) > 0 && n < len(buf) {
+		c := l.chunks[0]
+		m := copy(buf[n:], c.data[c.off:l.received(c, now)])
+		c.off += m
+		n += m
+		if c.off < len(c.data) {
+			break
+		}
+		l.chunks = l.chunks[1:]
+	}
+	return n
+}
+
+// available reports whether some data has been received by now, but not read yet.
+func (l *line) available(now time.Time) bool {
+	return len(l.chunks) > 0 && l.received(l.chunks[0], now) > l.chunks[0].off
+}
+
+func (l *line) empty() bool {
+	return len(l.chunks) == 0
+}
+
+// nextArrival returns the time when the next unread byte is received, or zero if there is none.
+func (l *line) nextArrival() time.Time {
+	if len(l.chunks) == 0 {
+		return time.Time{}
+	}
+	c := l.chunks[0]
+	return c.start.Add(time.Duration(c.off+1)*c.charTime + l.latency)
+}
+
+// discardReceived drops the bytes received by now, but not read yet.
+func (l *line) discardReceived(now time.Time) {
+	for len(l.chunks) > 0 {
+		c := l.chunks[0]
+		c.off = l.received(c, now)
+		if c.off < len(c.data) {
+			return
+		}
+		l.chunks = l.chunks[1:]
+	}
+}
+
+// discardPending drops the bytes not transmitted by now.
+func (l *line) discardPending(now time.Time) {
+	kept := l.chunks[:0]
+	for _, c := range l.chunks {
+		if n := l.sent(c, now); n > c.off {
+			c.data = c.data[:n]
+			kept = append(kept, c)
+		}
+	}
+	l.chunks = kept
+	if now.Before(l.txEnd) {
+		l.txEnd = now
+	}
+}
@@ -0,0 +1,12 @@
+//go:build dragonfly || freebsd || netbsd || openbsd
+// +build dragonfly freebsd netbsd openbsd
+
+package serial
+
+// The BSDs other than Darwin take arbitrary rates directly in termios.
+
+func needSpeedIoctl(baud int) bool { return false }
+
+func setSpeedIoctl(fd uintptr, baud int) error {
+	return ErrUnsupportedBaudRate
+}
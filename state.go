@@ -0,0 +1,21 @@
+package serial
+
+// State is a snapshot of the settings of a port, taken by Port.SaveState.
+type State struct {
+	// Config is the configuration of the port when the state was saved.
+	// If the state holds no settings of the system, like for the ports of package serialtest,
+	// RestoreState applies the parameters of the line from Config instead.
+	Config Config
+
+	sys *sysState // the settings of the system, like the termios; nil if unknown
+}
+
+// setLine copies the parameters of the serial line, like the baud rate and the parity, from c to cfg.
+func (cfg *Config) setLine(c Config) {
+	cfg.BaudRate = c.BaudRate
+	cfg.DataBits = c.DataBits
+	cfg.Parity = c.Parity
+	cfg.StopBits = c.StopBits
+	cfg.FlowControl = c.FlowControl
+	cfg.SoftwareFlow = c.SoftwareFlow
+}
@@ -0,0 +1,65 @@
+package serial
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counters of an opened port.
+type Stats struct {
+	BytesRead    uint64
+	BytesWritten uint64
+	Reads        uint64 // the number of Read calls
+	Writes       uint64 // the number of Write calls
+
+	// LastRead and LastWrite are the times of the last Read and Write calls which transferred data.
+	LastRead  time.Time
+	LastWrite time.Time
+
+	// The errors and the break conditions detected by the driver
+	// since it was loaded. They are only reported on Linux.
+	FrameErrors    uint64
+	ParityErrors   uint64
+	Overruns       uint64 // the hardware FIFO overflowed
+	BufferOverruns uint64 // the tty buffer overflowed
+	Breaks         uint64
+}
+
+// counters keeps the statistics of the I/O calls of a port.
+type counters struct {
+	bytesRead, bytesWritten atomic.Uint64
+	reads, writes           atomic.Uint64
+	lastRead, lastWrite     atomic.Int64 // UnixNano
+}
+
+func (c *counters) read(n int) {
+	c.reads.Add(1)
+	if n > 0 {
+		c.bytesRead.Add(uint64(n))
+		c.lastRead.Store(time.Now().UnixNano())
+	}
+}
+
+func (c *counters) write(n int) {
+	c.writes.Add(1)
+	if n > 0 {
+		c.bytesWritten.Add(uint64(n))
+		c.lastWrite.Store(time.Now().UnixNano())
+	}
+}
+
+func (c *counters) stats() Stats {
+	s := Stats{
+		BytesRead:    c.bytesRead.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+		Reads:        c.reads.Load(),
+		Writes:       c.writes.Load(),
+	}
+	if t := c.lastRead.Load(); t != 0 {
+		s.LastRead = time.Unix(0, t)
+	}
+	if t := c.lastWrite.Load(); t != 0 {
+		s.LastWrite = time.Unix(0, t)
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package serial
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultEscape is the character which ends Terminal, unless configured otherwise: Ctrl-], like with telnet.
+const DefaultEscape = 0x1d
+
+// TerminalConfig describes the terminal connected to a port by Terminal.
+type TerminalConfig struct {
+	// In is the terminal the keys are read from. Nil means os.Stdin.
+	// If it is a terminal, it is switched to raw input meanwhile.
+	In *os.File
+
+	// Out is where the input of the port is written. Nil means os.Stdout.
+	Out io.Writer
+
+	// Escape is the character which ends Terminal. Zero means DefaultEscape.
+	Escape byte
+}
+
+// Terminal connects the port to the terminal of the program, like a minimal terminal emulator:
+// the keys typed are sent to the port as they are typed, Ctrl-C included, and the input
+// of the port is written to the terminal. It returns once the escape character is typed,
+// the input of the terminal ends, or the port fails.
+//
+// The input of the terminal can not be interrupted, so a pending read of it remains after Terminal returns,
+// and the keys it reads are dropped.
+func Terminal(p Port, cfg TerminalConfig) error {
+	in, out, escape := cfg.In, cfg.Out, cfg.Escape
+	if in == nil {
+		in = os.Stdin
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+	if escape == 0 {
+		escape = DefaultEscape
+	}
+	if rc, err := in.SyscallConn(); err == nil {
+		var restore func()
+		rc.Control(func(fd uintptr) { restore, err = makeTerminalRaw(fd) })
+		if err == nil {
+			// Otherwise, the input is not a terminal, and is sent as it is.
+			defer restore()
+		}
+	}
+
+	done := make(chan struct{})
+	errc := make(chan error, 2)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, 4096)
+		for {
+			n, err := p.Read(buf)
+			if n > 0 {
+				if _, err := out.Write(buf[:n]); err != nil {
+					errc <- err
+					return
+				}
+			}
+			if err != nil {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					// Config.ReadTimeout of the port.
+					continue
+				}
+				errc <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := in.Read(buf)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			data := buf[:n]
+			i := bytes.IndexByte(data, escape)
+			if i >= 0 {
+				data = data[:i]
+			}
+			if len(data) > 0 {
+				if _, err := p.Write(data); err != nil {
+					errc <- err
+					return
+				}
+			}
+			if i >= 0 || err == io.EOF {
+				errc <- nil
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	err := <-errc
+	close(done)
+	// Interrupt the pending Read of the port.
+	p.SetReadDeadline(time.Unix(1, 0))
+	<-readDone
+	p.SetReadDeadline(time.Time{})
+	return err
+}
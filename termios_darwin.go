@@ -0,0 +1,10 @@
+package serial
+
+// Constants from sys/termios.h and IOKit/serial/ioss.h of Darwin.
+
+const (
+	crtscts = 0x00030000 // CCTS_OFLOW | CRTS_IFLOW
+
+	// IOSSIOSPEED is _IOW('T', 2, speed_t). It sets an arbitrary baud rate on a serial port.
+	IOSSIOSPEED = 0x80085402
+)
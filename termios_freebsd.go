@@ -0,0 +1,7 @@
+package serial
+
+// Constants from sys/termios.h of FreeBSD.
+
+const (
+	crtscts = 0x00030000 // CCTS_OFLOW | CRTS_IFLOW
+)
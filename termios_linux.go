@@ -1,4 +1,5 @@
-// +build !mipsle
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !ppc64 && !ppc64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le,!ppc64,!ppc64le
 
 package serial
 
@@ -13,13 +14,17 @@ package serial
 // which can be covered by copyright.
 // ===================
 //
-// The values are the same for arm, i386 and x86_64.
-// The values for MIPS32 LE are different and provided in termios_mipsle.go.
-// Other architectures are not yet supported.
+// The values are the same for arm, aarch64, i386, x86_64, loongarch64, riscv64 and s390x,
+// which follow the generic ABI of the kernel. The values for MIPS and PowerPC are different,
+// and provided in termios_linux_mipsx.go and termios_linux_ppc64x.go.
 
 // Constants from ./arch/{arm,i386,x86_64}/bits/termios.h
 
 const (
+	// KERNEL_NCCS is the size of c_cc in the termios structures of the kernel,
+	// which is smaller than NCCS of the libc.
+	KERNEL_NCCS = 19
+
 	VINTR    = 0
 	VQUIT    = 1
 	VERASE   = 2
@@ -133,6 +138,8 @@ const (
 	HUPCL  = 0002000
 	CLOCAL = 0004000
 
+	CMSPAR = 010000000000
+
 	ISIG   = 0000001
 	ICANON = 0000002
 	ECHO   = 0000010
@@ -163,6 +170,7 @@ const (
 	TCSAFLUSH = 2
 
 	CBAUDEX = 0010000
+	BOTHER  = 0010000
 	CRTSCTS = 020000000000
 	EXTPROC = 0200000
 	XTABS   = 0014000
@@ -182,5 +190,39 @@ const (
 	TCXONC  = 0x540A
 	TCFLSH  = 0x540B
 
+	TCGETS2  = 0x802C542A
+	TCSETS2  = 0x402C542B
+	TCSETSW2 = 0x402C542C
+
 	TIOCGSID = 0x5429
+
+	TIOCGICOUNT = 0x545D
+	TIOCGRS485  = 0x542E
+	TIOCSRS485  = 0x542F
 )
+
+// termios is the structure of TCGETS and TCSETS. It is the one of the libc, which is larger than
+// the one of the kernel, with the same layout, from ./include/termios.h and ./arch/{arm,x86_64}/bits/termios.h.
+type termios struct {
+	iflag   uint32
+	oflag   uint32
+	cflag   uint32
+	lflag   uint32
+	line    byte
+	cc      [32]byte
+	unused0 uint32
+	unused1 uint32
+}
+
+// termios2 is the structure of TCGETS2 and TCSETS2, which can carry an arbitrary baud rate
+// in ispeed and ospeed when cflag has BOTHER set.
+type termios2 struct {
+	iflag  uint32
+	oflag  uint32
+	cflag  uint32
+	lflag  uint32
+	line   byte
+	cc     [KERNEL_NCCS]byte
+	ispeed uint32
+	ospeed uint32
+}
@@ -1,4 +1,6 @@
-// +build mipsle
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
 
 package serial
 
@@ -13,11 +15,15 @@ package serial
 // which can be covered by copyright.
 // ===================
 //
-// The values are the same for MIPS32 LE architecture.
+// The values are the same for the MIPS architectures, 32 and 64 bits, big and little endian.
 
 // Constants from ./arch/mips/bits/termios.h
 
 const (
+	// KERNEL_NCCS is the size of c_cc in the termios structures of the kernel,
+	// which is smaller than NCCS of the libc.
+	KERNEL_NCCS = 23
+
 	VINTR    = 0
 	VQUIT    = 1
 	VERASE   = 2
@@ -132,6 +138,8 @@ const (
 	HUPCL  = 0002000
 	CLOCAL = 0004000
 
+	CMSPAR = 010000000000
+
 	ISIG    = 0000001
 	ICANON  = 0000002
 	ECHO    = 0000010
@@ -163,6 +171,7 @@ const (
 	TCSAFLUSH = 2
 
 	CBAUDEX = 0010000
+	BOTHER  = 0010000
 	CRTSCTS = 020000000000
 	EXTPROC = 0200000
 	XTABS   = 0014000
@@ -182,5 +191,39 @@ const (
 	TCSETSW = 0x540F
 	TCSETSF = 0x5410
 
+	TCGETS2  = 0x4030542A
+	TCSETS2  = 0x8030542B
+	TCSETSW2 = 0x8030542C
+
 	TIOCGSID = 0x7416
+
+	TIOCGICOUNT = 0x5492
+	TIOCGRS485  = 0x4020542E
+	TIOCSRS485  = 0xC020542F
 )
+
+// termios is the structure of TCGETS and TCSETS. It is the one of the libc, which is larger than
+// the one of the kernel, with the same layout, from ./include/termios.h and ./arch/mips/bits/termios.h.
+type termios struct {
+	iflag   uint32
+	oflag   uint32
+	cflag   uint32
+	lflag   uint32
+	line    byte
+	cc      [32]byte
+	unused0 uint32
+	unused1 uint32
+}
+
+// termios2 is the structure of TCGETS2 and TCSETS2, which can carry an arbitrary baud rate
+// in ispeed and ospeed when cflag has BOTHER set.
+type termios2 struct {
+	iflag  uint32
+	oflag  uint32
+	cflag  uint32
+	lflag  uint32
+	line   byte
+	cc     [KERNEL_NCCS]byte
+	ispeed uint32
+	ospeed uint32
+}
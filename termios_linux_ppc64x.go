@@ -0,0 +1,219 @@
+//go:build linux && (ppc64 || ppc64le)
+// +build linux
+// +build ppc64 ppc64le
+
+package serial
+
+// The contents of this file are the direct translation of public musl-libc headers.
+// See more at http://www.musl-libc.org/
+//
+// License (an excerpt from musl-libc COPYRIGHT):
+//
+// ===================
+// All public header files (include/* and arch/*/bits/*) should be
+// treated as Public Domain as they intentionally contain no content
+// which can be covered by copyright.
+// ===================
+//
+// The values are the same for the 64-bit PowerPC architectures, big and little endian.
+
+// Constants from ./arch/powerpc64/bits/termios.h
+
+const (
+	// KERNEL_NCCS is the size of c_cc in the termios structure of the kernel,
+	// which is the same as NCCS of the libc on PowerPC.
+	KERNEL_NCCS = 19
+
+	VINTR    = 0
+	VQUIT    = 1
+	VERASE   = 2
+	VKILL    = 3
+	VEOF     = 4
+	VMIN     = 5
+	VEOL     = 6
+	VTIME    = 7
+	VEOL2    = 8
+	VSWTC    = 9
+	VWERASE  = 10
+	VREPRINT = 11
+	VSUSP    = 12
+	VSTART   = 13
+	VSTOP    = 14
+	VLNEXT   = 15
+	VDISCARD = 16
+
+	IGNBRK  = 0000001
+	BRKINT  = 0000002
+	IGNPAR  = 0000004
+	PARMRK  = 0000010
+	INPCK   = 0000020
+	ISTRIP  = 0000040
+	INLCR   = 0000100
+	IGNCR   = 0000200
+	ICRNL   = 0000400
+	IUCLC   = 0010000
+	IXON    = 0001000
+	IXANY   = 0004000
+	IXOFF   = 0002000
+	IMAXBEL = 0020000
+	IUTF8   = 0040000
+
+	OPOST  = 0000001
+	OLCUC  = 0000004
+	ONLCR  = 0000002
+	OCRNL  = 0000010
+	ONOCR  = 0000020
+	ONLRET = 0000040
+	OFILL  = 0000100
+	OFDEL  = 0000200
+	NLDLY  = 0001400
+	NL0    = 0000000
+	NL1    = 0000400
+	CRDLY  = 0030000
+	CR0    = 0000000
+	CR1    = 0010000
+	CR2    = 0020000
+	CR3    = 0030000
+	TABDLY = 0006000
+	TAB0   = 0000000
+	TAB1   = 0002000
+	TAB2   = 0004000
+	TAB3   = 0006000
+	BSDLY  = 0100000
+	BS0    = 0000000
+	BS1    = 0100000
+	FFDLY  = 0040000
+	FF0    = 0000000
+	FF1    = 0040000
+
+	VTDLY = 0200000
+	VT0   = 0000000
+	VT1   = 0200000
+
+	B0     = 0000000
+	B50    = 0000001
+	B75    = 0000002
+	B110   = 0000003
+	B134   = 0000004
+	B150   = 0000005
+	B200   = 0000006
+	B300   = 0000007
+	B600   = 0000010
+	B1200  = 0000011
+	B1800  = 0000012
+	B2400  = 0000013
+	B4800  = 0000014
+	B9600  = 0000015
+	B19200 = 0000016
+	B38400 = 0000017
+
+	B57600   = 0000020
+	B115200  = 0000021
+	B230400  = 0000022
+	B460800  = 0000023
+	B500000  = 0000024
+	B576000  = 0000025
+	B921600  = 0000026
+	B1000000 = 0000027
+	B1152000 = 0000030
+	B1500000 = 0000031
+	B2000000 = 0000032
+	B2500000 = 0000033
+	B3000000 = 0000034
+	B3500000 = 0000035
+	B4000000 = 0000036
+
+	CBAUD = 0000377
+
+	CSIZE  = 0001400
+	CS5    = 0000000
+	CS6    = 0000400
+	CS7    = 0001000
+	CS8    = 0001400
+	CSTOPB = 0002000
+	CREAD  = 0004000
+	PARENB = 0010000
+	PARODD = 0020000
+	HUPCL  = 0040000
+	CLOCAL = 0100000
+
+	CMSPAR = 010000000000
+
+	ISIG   = 0000200
+	ICANON = 0000400
+	ECHO   = 0000010
+	ECHOE  = 0000002
+	ECHOK  = 0000004
+	ECHONL = 0000020
+	NOFLSH = 020000000000
+	TOSTOP = 020000000
+	IEXTEN = 0002000
+
+	ECHOCTL = 0000100
+	ECHOPRT = 0000040
+	ECHOKE  = 0000001
+	FLUSHO  = 040000000
+	PENDIN  = 04000000000
+
+	TCOOFF = 0
+	TCOON  = 1
+	TCIOFF = 2
+	TCION  = 3
+
+	TCIFLUSH  = 0
+	TCOFLUSH  = 1
+	TCIOFLUSH = 2
+
+	TCSANOW   = 0
+	TCSADRAIN = 1
+	TCSAFLUSH = 2
+
+	CBAUDEX = 0000000
+	BOTHER  = 0000037
+	CRTSCTS = 020000000000
+	EXTPROC = 02000000000
+	XTABS   = 0006000
+)
+
+// Constants from ./arch/powerpc64/bits/ioctl.h
+const (
+	TCGETS  = 0x402C7413
+	TCSETS  = 0x802C7414
+	TCSETSW = 0x802C7415
+	TCSETSF = 0x802C7416
+	TCGETA  = 0x40147417
+	TCSETA  = 0x80147418
+	TCSETAW = 0x80147419
+	TCSETAF = 0x8014741C
+	TCSBRK  = 0x2000741D
+	TCXONC  = 0x2000741E
+	TCFLSH  = 0x2000741F
+
+	// PowerPC has no termios2: the termios of the kernel carries the baud rates,
+	// and BOTHER is set with TCSETS.
+	TCGETS2  = TCGETS
+	TCSETS2  = TCSETS
+	TCSETSW2 = TCSETSW
+
+	TIOCGSID = 0x5429
+
+	TIOCGICOUNT = 0x545D
+	TIOCGRS485  = 0x542E
+	TIOCSRS485  = 0x542F
+)
+
+// termios is the structure of TCGETS and TCSETS, from ./arch/powerpc64/bits/termios.h.
+// Unlike on the other architectures, c_cc comes before c_line, and the kernel uses the baud rates.
+type termios struct {
+	iflag  uint32
+	oflag  uint32
+	cflag  uint32
+	lflag  uint32
+	cc     [KERNEL_NCCS]byte
+	line   byte
+	ispeed uint32
+	ospeed uint32
+}
+
+// termios2 is termios, which can carry an arbitrary baud rate in ispeed and ospeed when cflag has BOTHER set.
+type termios2 = termios
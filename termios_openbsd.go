@@ -0,0 +1,7 @@
+package serial
+
+// Constants from sys/termios.h of OpenBSD.
+
+const (
+	crtscts = 0x00010000
+)
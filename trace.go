@@ -0,0 +1,131 @@
+package serial
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction tells whether the traced data was read from or written to a port.
+type Direction int
+
+const (
+	// DirRead is the data returned by Read.
+	DirRead Direction = iota + 1
+	// DirWrite is the data accepted by Write.
+	DirWrite
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirRead:
+		return "read"
+	case DirWrite:
+		return "write"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// TraceFunc is called by a port configured with Config.Trace after every Read and Write
+// which transferred any data, with the data and the time the call returned.
+// The data must not be retained after the call. A TraceFunc may be called concurrently
+// by a reading and a writing goroutine.
+type TraceFunc func(dir Direction, data []byte, t time.Time)
+
+// HexdumpTrace returns a TraceFunc which writes the data to w in the format of hexdump -C,
+// after a line with the time, the direction and the length, like:
+//
+//	15:04:05.000000 write 4 bytes
+//	00000000  41 54 0d 0a                                       |AT..|
+func HexdumpTrace(w io.Writer) TraceFunc {
+	var mu sync.Mutex
+	return func(dir Direction, data []byte, t time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "%s %v %d bytes\n%s", t.Format("15:04:05.000000"), dir, len(data), hex.Dump(data))
+	}
+}
+
+// TeeTrace returns a TraceFunc which copies the data read to rx, and the data written to tx,
+// like for a protocol analyzer. Either can be nil, and both can be the same writer,
+// which is not called concurrently. The errors of the writers are ignored, so that they do not
+// disturb the port; a slow writer slows the port down, though.
+func TeeTrace(rx, tx io.Writer) TraceFunc {
+	var mu sync.Mutex
+	return func(dir Direction, data []byte, t time.Time) {
+		w := rx
+		if dir == DirWrite {
+			w = tx
+		}
+		if w == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(data)
+	}
+}
+
+// Tee returns p, which copies the data read to rx and the data written to tx, as described by TeeTrace.
+// It suits the ports which are already open; Config.Trace does the same on Open.
+func Tee(p Port, rx, tx io.Writer) Port {
+	return traced(p, TeeTrace(rx, tx))
+}
+
+// traced returns p, which reports its data to trace, unless it is nil.
+func traced(p Port, trace TraceFunc) Port {
+	if trace == nil {
+		return p
+	}
+	return &tracePort{Port: p, trace: trace}
+}
+
+// tracePort is a port which reports the data read and written to a TraceFunc.
+type tracePort struct {
+	Port
+	trace TraceFunc
+}
+
+// Read implements io.Reader
+func (p *tracePort) Read(buf []byte) (int, error) {
+	n, _, err := p.ReadTimestamped(buf)
+	return n, err
+}
+
+// ReadTimestamped implements Port. The data is traced with the time it was received.
+func (p *tracePort) ReadTimestamped(buf []byte) (int, time.Time, error) {
+	n, ts, err := p.Port.ReadTimestamped(buf)
+	if n > 0 {
+		p.trace(DirRead, buf[:n], ts)
+	}
+	return n, ts, err
+}
+
+// Write implements io.Writer
+func (p *tracePort) Write(buf []byte) (int, error) {
+	n, err := p.Port.Write(buf)
+	if n > 0 {
+		p.trace(DirWrite, buf[:n], time.Now())
+	}
+	return n, err
+}
+
+// writeBuffers traces the part of every buffer which was written.
+func (p *tracePort) writeBuffers(bufs [][]byte) (int64, error) {
+	n, err := WriteBuffers(p.Port, bufs)
+	now := time.Now()
+	for left := n; left > 0 && len(bufs) > 0; bufs = bufs[1:] {
+		b := bufs[0][:min(int64(len(bufs[0])), left)]
+		if len(b) > 0 {
+			p.trace(DirWrite, b, now)
+		}
+		left -= int64(len(b))
+	}
+	return n, err
+}
+
+func (p *tracePort) unwrap() Port {
+	return p.Port
+}
@@ -0,0 +1,99 @@
+package serial
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrResponseTooLong is returned by Transact when no terminator is found in the maximum length of a response.
+var ErrResponseTooLong = errors.New("serial: response too long")
+
+// Response describes how Transact recognizes the end of a response.
+// One of Terminator and Length must be set.
+type Response struct {
+	// Terminator, if not empty, ends the response, like []byte("\r\nOK\r\n").
+	// It is included in the returned response.
+	Terminator []byte
+
+	// Length, if positive, is the length of the response.
+	Length int
+
+	// MaxLength limits the length of a response ended by Terminator.
+	// Zero means DefaultMaxLineLength.
+	MaxLength int
+}
+
+// Transact runs a request/response exchange on a half-duplex protocol, like AT commands:
+// it discards the stale input, writes request, and reads until the response is complete.
+// The data received after the end of the response is discarded.
+//
+// If timeout is positive, it limits the whole exchange, and the response read so far is returned
+// along with an error wrapping os.ErrDeadlineExceeded. Transact uses the read deadline
+// of the port, and clears it before returning. No one else should read from the port meanwhile.
+func Transact(p Port, request []byte, resp Response, timeout time.Duration) ([]byte, error) {
+	if len(resp.Terminator) == 0 && resp.Length <= 0 {
+		return nil, errors.New("serial: Transact needs a terminator or a length of the response")
+	}
+	maxLen := resp.Length
+	if len(resp.Terminator) > 0 {
+		if maxLen = resp.MaxLength; maxLen <= 0 {
+			maxLen = DefaultMaxLineLength
+		}
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	if err := p.ResetInput(); err != nil {
+		return nil, err
+	}
+	if _, err := p.Write(request); err != nil {
+		return nil, err
+	}
+	if err := p.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	defer p.SetReadDeadline(time.Time{})
+
+	var buf []byte
+	chunk := make([]byte, 256)
+	for {
+		n, err := p.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if end := responseEnd(buf, resp); end >= 0 {
+			return buf[:end], nil
+		}
+		if len(buf) >= maxLen {
+			return buf, ErrResponseTooLong
+		}
+		if err != nil {
+			timedOut := errors.Is(err, os.ErrDeadlineExceeded)
+			// Config.ReadTimeout may end a Read before the deadline of the exchange.
+			if timedOut && (deadline.IsZero() || time.Now().Before(deadline)) {
+				continue
+			}
+			if timedOut {
+				return buf, fmt.Errorf("serial: no complete response in %v: %w", timeout, err)
+			}
+			return buf, err
+		}
+	}
+}
+
+// responseEnd returns the length of the response at the start of buf, or -1 if it is not complete yet.
+func responseEnd(buf []byte, resp Response) int {
+	if t := resp.Terminator; len(t) > 0 {
+		if i := bytes.Index(buf, t); i >= 0 {
+			return i + len(t)
+		}
+		return -1
+	}
+	if len(buf) >= resp.Length {
+		return resp.Length
+	}
+	return -1
+}
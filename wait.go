@@ -0,0 +1,24 @@
+package serial
+
+import (
+	"context"
+	"time"
+)
+
+// devicePollInterval is how often WaitForDevice checks for the device,
+// where it can not be notified of its appearance.
+const devicePollInterval = 100 * time.Millisecond
+
+// WaitForDevice waits until the device of the port name exists, or ctx is done.
+// It returns immediately if the device is already there.
+// On Linux the directory of the device is watched with inotify, which covers
+// the links created by udev, like /dev/serial/by-id/...; elsewhere the device is polled.
+//
+// Note that udev may adjust the permissions of a new device after it appears,
+// so opening it right away may fail with ErrPermissionDenied.
+func WaitForDevice(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return waitForDevice(ctx, name)
+}
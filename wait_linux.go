@@ -0,0 +1,66 @@
+package serial
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// deviceWatchEvents are the inotify events after which the device may exist.
+// The deletion of the watched directory is included, as a closer directory
+// must be watched then.
+const deviceWatchEvents = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// waitForDevice watches the closest existing directory on the path of the device
+// with inotify, until the device exists or ctx is done.
+func waitForDevice(ctx context.Context, name string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	// The non-blocking descriptor is served by the runtime poller, so the deadline interrupts Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+	stop := context.AfterFunc(ctx, func() { f.SetReadDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	buf := make([]byte, 4096)
+	watched, wd := "", -1
+	for {
+		if dir := existingDir(filepath.Dir(name)); dir != watched {
+			if wd >= 0 {
+				syscall.InotifyRmWatch(fd, uint32(wd))
+			}
+			if wd, err = syscall.InotifyAddWatch(fd, dir, deviceWatchEvents); err != nil {
+				return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+			}
+			watched = dir
+		}
+		// Checked after the watch is added, so that the device cannot appear unnoticed in between.
+		if deviceExists(name) {
+			return nil
+		}
+		if _, err := f.Read(buf); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+// existingDir returns dir, or its closest ancestor which exists.
+func existingDir(dir string) string {
+	for {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
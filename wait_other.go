@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package serial
+
+import (
+	"context"
+	"time"
+)
+
+// waitForDevice polls for the device of the port name, until it exists or ctx is done.
+func waitForDevice(ctx context.Context, name string) error {
+	t := time.NewTicker(devicePollInterval)
+	defer t.Stop()
+	for !deviceExists(name) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+// Package xmodem implements the XMODEM and YMODEM file transfer protocols over a serial port,
+// as used by many bootloaders, like the one of STM32 devices or the loadx and loady commands of U-Boot.
+//
+// Send and Receive transfer a single file with XMODEM, in the original checksum variant,
+// XMODEM-CRC or XMODEM-1K. SendYModem and ReceiveYModem transfer a batch of files with YMODEM.
+package xmodem
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jangocheng/serial"
+	"github.com/jangocheng/serial/crc"
+)
+
+// The control characters of the protocols.
+const (
+	soh = 0x01 // the header of a 128 byte block
+	stx = 0x02 // the header of a 1024 byte block
+	eot = 0x04 // the end of the transmission
+	ack = 0x06
+	nak = 0x15
+	can = 0x18 // cancels the transfer, when sent twice
+	sub = 0x1a // pads the last block
+
+	crcRequest = 'C' // sent by the receiver instead of NAK to ask for XMODEM-CRC
+)
+
+const (
+	// DefaultTimeout is the time to wait for the other side, unless configured otherwise.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultRetries is the number of attempts of every step, unless configured otherwise.
+	DefaultRetries = 10
+
+	// crcAttempts is how many times Receive asks for XMODEM-CRC, before it falls back to the checksum.
+	crcAttempts = 3
+
+	// purgeTimeout is the silence which ends the garbage discarded after a damaged block.
+	purgeTimeout = time.Second
+)
+
+var (
+	// ErrCanceled is returned when the other side cancels the transfer.
+	ErrCanceled = errors.New("xmodem: transfer canceled by the remote side")
+
+	// ErrTooManyRetries is returned when a step of the transfer fails more times than Config.Retries.
+	ErrTooManyRetries = errors.New("xmodem: too many retries")
+)
+
+// Config describes a transfer. The zero value is a valid configuration.
+type Config struct {
+	// BlockSize is the size of the blocks to send: 128, or 1024 for XMODEM-1K.
+	// Zero means 128 for Send and 1024 for SendYModem. The receivers accept both.
+	BlockSize int
+
+	// Checksum, if true, makes Receive ask for the original XMODEM with the arithmetic checksum,
+	// instead of XMODEM-CRC. The senders use the variant asked by the receiver.
+	Checksum bool
+
+	// Timeout is the time to wait for the other side at every step. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	// Retries is the number of attempts of every step, like sending a block. Zero means DefaultRetries.
+	Retries int
+
+	// Progress, if not nil, is called after every block with the number of bytes of the file
+	// transferred so far, and its size, or -1 if it is not known.
+	Progress func(n, total int64)
+}
+
+// Send sends the data read from r with XMODEM, until r returns io.EOF.
+// The last block is padded with SUB (0x1a) characters.
+func Send(p serial.Port, r io.Reader, cfg Config) error {
+	c := newConn(p, cfg, 128)
+	defer c.done()
+	if err := c.waitStart(); err != nil {
+		return c.abort(err)
+	}
+	if err := c.sendData(r, -1); err != nil {
+		return c.abort(err)
+	}
+	return c.abort(c.sendEOT())
+}
+
+// Receive receives a file with XMODEM and writes it to w. It returns the number of bytes written,
+// which includes the padding of the last block, as XMODEM does not transfer the size of the file.
+func Receive(p serial.Port, w io.Writer, cfg Config) (int64, error) {
+	c := newConn(p, cfg, 128)
+	defer c.done()
+	c.crc = !cfg.Checksum
+	n, err := c.receiveData(w, -1, false)
+	return n, c.abort(err)
+}
+
+// conn runs a transfer on a port.
+type conn struct {
+	p         serial.Port
+	cfg       Config
+	blockSize int
+	crc       bool // the blocks are checked with CRC-16, instead of the checksum
+}
+
+func newConn(p serial.Port, cfg Config, blockSize int) *conn {
+	if cfg.BlockSize == 128 || cfg.BlockSize == 1024 {
+		blockSize = cfg.BlockSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = DefaultRetries
+	}
+	return &conn{p: p, cfg: cfg, blockSize: blockSize, crc: true}
+}
+
+// done clears the read deadline of the port, once the transfer ends.
+func (c *conn) done() {
+	c.p.SetReadDeadline(time.Time{})
+}
+
+// abort cancels the transfer on the other side, if err is not nil, and returns err.
+func (c *conn) abort(err error) error {
+	if err != nil && !errors.Is(err, ErrCanceled) {
+		c.p.Write([]byte{can, can, can})
+	}
+	return err
+}
+
+func (c *conn) progress(n, total int64) {
+	if c.cfg.Progress != nil {
+		c.cfg.Progress(n, total)
+	}
+}
+
+// waitStart waits for the receiver to ask for the transfer, and sets the variant it asked for.
+func (c *conn) waitStart() error {
+	for i := 0; i < c.cfg.Retries; i++ {
+		b, err := c.await(crcRequest, nak)
+		if isTimeout(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.crc = b == crcRequest
+		return nil
+	}
+	return fmt.Errorf("%w: the receiver did not start the transfer", ErrTooManyRetries)
+}
+
+// sendData sends the data read from r in the blocks numbered from 1. total is the size of the data, or -1.
+func (c *conn) sendData(r io.Reader, total int64) error {
+	buf := make([]byte, c.blockSize)
+	var sent int64
+	for blk := byte(1); ; blk++ {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 && err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		size := c.blockSize
+		if n <= 128 {
+			// A short last block is sent in a 128 byte block, even with XMODEM-1K.
+			size = 128
+		}
+		data := append(buf[:n:n], bytes.Repeat([]byte{sub}, size-n)...)
+		if err := c.sendBlock(blk, data); err != nil {
+			return err
+		}
+		sent += int64(n)
+		c.progress(sent, total)
+		if n < len(buf) {
+			return nil
+		}
+	}
+}
+
+// sendBlock sends a block until the receiver acknowledges it.
+func (c *conn) sendBlock(blk byte, data []byte) error {
+	header := byte(soh)
+	if len(data) == 1024 {
+		header = stx
+	}
+	packet := append([]byte{header, blk, ^blk}, data...)
+	packet = append(packet, c.check(data)...)
+	for i := 0; i < c.cfg.Retries; i++ {
+		if _, err := c.p.Write(packet); err != nil {
+			return err
+		}
+		b, err := c.await(ack, nak)
+		if isTimeout(err) || b == nak {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: block %d was not acknowledged", ErrTooManyRetries, blk)
+}
+
+// sendEOT ends the transmission of a file. The YMODEM receivers reject the first EOT with NAK.
+func (c *conn) sendEOT() error {
+	for i := 0; i < c.cfg.Retries; i++ {
+		if _, err := c.p.Write([]byte{eot}); err != nil {
+			return err
+		}
+		b, err := c.await(ack, nak)
+		if isTimeout(err) || b == nak {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("%w: the end of the transmission was not acknowledged", ErrTooManyRetries)
+}
+
+// receiveData receives the blocks numbered from 1 and writes their data to w, until the end of the transmission.
+// total is the size of the file, or -1. If it is known, the padding of the last block is not written.
+func (c *conn) receiveData(w io.Writer, total int64, ymodem bool) (int64, error) {
+	var written int64
+	expected := byte(1)
+	started := false // a block has been received, so the variant is settled
+	eots := 0
+	reply := byte(crcRequest)
+	if !c.crc {
+		reply = nak
+	}
+	for errs := 0; ; {
+		if _, err := c.p.Write([]byte{reply}); err != nil {
+			return written, err
+		}
+		h, err := c.await(soh, stx, eot)
+		if isTimeout(err) {
+			if errs++; errs >= c.cfg.Retries {
+				return written, fmt.Errorf("%w: no block received", ErrTooManyRetries)
+			}
+			if started {
+				reply = nak
+			} else if !ymodem && c.crc && errs >= crcAttempts {
+				// The sender does not support XMODEM-CRC.
+				c.crc, reply = false, nak
+			}
+			continue
+		}
+		if err != nil {
+			return written, err
+		}
+		if h == eot {
+			if eots++; ymodem && eots == 1 {
+				// Make sure it is not a damaged block, as YMODEM does.
+				reply = nak
+				continue
+			}
+			_, err := c.p.Write([]byte{ack})
+			return written, err
+		}
+		blk, data, err := c.readBlock(h)
+		if err != nil {
+			if !isTimeout(err) && !errors.Is(err, errDamaged) {
+				return written, err
+			}
+			if errs++; errs >= c.cfg.Retries {
+				return written, fmt.Errorf("%w: %w", ErrTooManyRetries, err)
+			}
+			c.purge()
+			reply = nak
+			continue
+		}
+		switch blk {
+		case expected:
+			if total >= 0 && int64(len(data)) > total-written {
+				data = data[:total-written]
+			}
+			if _, err := w.Write(data); err != nil {
+				return written, err
+			}
+			written += int64(len(data))
+			c.progress(written, total)
+			started, expected, errs, eots = true, expected+1, 0, 0
+		case expected - 1:
+			// The acknowledgment of the previous block has been lost.
+		default:
+			return written, fmt.Errorf("xmodem: block %d received instead of %d", blk, expected)
+		}
+		reply = ack
+	}
+}
+
+// errDamaged is returned by readBlock for the blocks with a wrong number or check.
+var errDamaged = errors.New("xmodem: damaged block")
+
+// readBlock reads the rest of a block after its header, and returns its number and data.
+func (c *conn) readBlock(header byte) (byte, []byte, error) {
+	size := 128
+	if header == stx {
+		size = 1024
+	}
+	checkLen := 1
+	if c.crc {
+		checkLen = 2
+	}
+	packet := make([]byte, 2+size+checkLen)
+	if err := c.readFull(packet, time.Now().Add(c.cfg.Timeout)); err != nil {
+		return 0, nil, err
+	}
+	blk, data := packet[0], packet[2:2+size]
+	if packet[1] != ^blk || !bytes.Equal(packet[2+size:], c.check(data)) {
+		return 0, nil, errDamaged
+	}
+	return blk, data, nil
+}
+
+// check returns the checksum or the CRC of the block data.
+func (c *conn) check(data []byte) []byte {
+	if c.crc {
+		sum := crc.CRC16XModem(data)
+		return []byte{byte(sum >> 8), byte(sum)}
+	}
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return []byte{sum}
+}
+
+// await reads until one of the bytes in want, which it returns, skipping the others.
+// Two CAN characters in a row cancel the transfer.
+func (c *conn) await(want ...byte) (byte, error) {
+	deadline := time.Now().Add(c.cfg.Timeout)
+	cancels := 0
+	for {
+		var b [1]byte
+		if err := c.readFull(b[:], deadline); err != nil {
+			return 0, err
+		}
+		if bytes.IndexByte(want, b[0]) >= 0 {
+			return b[0], nil
+		}
+		if b[0] != can {
+			cancels = 0
+		} else if cancels++; cancels == 2 {
+			return 0, ErrCanceled
+		}
+	}
+}
+
+// purge discards the input, until the line is silent for purgeTimeout.
+func (c *conn) purge() {
+	end := time.Now().Add(c.cfg.Timeout)
+	buf := make([]byte, 1024)
+	for time.Now().Before(end) {
+		if err := c.readFull(buf[:1], time.Now().Add(purgeTimeout)); err != nil {
+			return
+		}
+	}
+}
+
+// readFull reads len(buf) bytes before the deadline.
+func (c *conn) readFull(buf []byte, deadline time.Time) error {
+	if err := c.p.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	for len(buf) > 0 {
+		n, err := c.p.Read(buf)
+		buf = buf[n:]
+		if err != nil {
+			// Config.ReadTimeout of the port may end a Read before the deadline.
+			if isTimeout(err) && time.Now().Before(deadline) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,442 @@
+package xmodem_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jangocheng/serial"
+	"github.com/jangocheng/serial/crc"
+	"github.com/jangocheng/serial/serialtest"
+	"github.com/jangocheng/serial/xmodem"
+)
+
+const (
+	soh = 0x01
+	stx = 0x02
+	eot = 0x04
+	ack = 0x06
+	nak = 0x15
+	can = 0x18
+	sub = 0x1a
+)
+
+// tap records the writes of a port.
+type tap struct {
+	serial.Port
+	mu     sync.Mutex
+	writes [][]byte
+}
+
+func (t *tap) Write(buf []byte) (int, error) {
+	t.mu.Lock()
+	t.writes = append(t.writes, append([]byte(nil), buf...))
+	t.mu.Unlock()
+	return t.Port.Write(buf)
+}
+
+// written returns the writes recorded so far.
+func (t *tap) written() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.writes
+}
+
+// pipe returns the ports of the sender and of the receiver, connected without delays.
+func pipe(t *testing.T) (*tap, *tap) {
+	a, b := serialtest.Pipe(serialtest.Config{})
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return &tap{Port: a}, &tap{Port: b}
+}
+
+// data returns n bytes of test data.
+func data(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7 + i/251)
+	}
+	return b
+}
+
+// block returns a block on the wire, checked with the CRC or the checksum.
+func block(blk byte, data []byte, useCRC bool) []byte {
+	header := byte(soh)
+	if len(data) == 1024 {
+		header = stx
+	}
+	b := append([]byte{header, blk, ^blk}, data...)
+	if useCRC {
+		sum := crc.CRC16XModem(data)
+		return append(b, byte(sum>>8), byte(sum))
+	}
+	var sum byte
+	for _, c := range data {
+		sum += c
+	}
+	return append(b, sum)
+}
+
+// padded returns the data, padded with SUB to the blocks it is sent in.
+func padded(data []byte, blockSize int) []byte {
+	n := len(data) % blockSize
+	if n == 0 {
+		return data
+	}
+	size := blockSize
+	if n <= 128 {
+		size = 128
+	}
+	return append(append([]byte(nil), data...), bytes.Repeat([]byte{sub}, size-n)...)
+}
+
+func TestTransfer(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		for _, blockSize := range []int{128, 1024} {
+			for _, size := range []int{0, 1, 128, 129, 1000, 1024, 3000} {
+				name := fmt.Sprintf("checksum=%v/block=%d/size=%d", checksum, blockSize, size)
+				t.Run(name, func(t *testing.T) {
+					sp, rp := pipe(t)
+					want := data(size)
+					var progress []int64
+					sent := make(chan error, 1)
+					go func() {
+						sent <- xmodem.Send(sp, bytes.NewReader(want), xmodem.Config{
+							BlockSize: blockSize,
+							Timeout:   5 * time.Second,
+							Progress:  func(n, total int64) { progress = append(progress, n) },
+						})
+					}()
+					var got bytes.Buffer
+					n, err := xmodem.Receive(rp, &got, xmodem.Config{Checksum: checksum, Timeout: 5 * time.Second})
+					if err != nil {
+						t.Fatalf("Receive: %v", err)
+					}
+					if err := <-sent; err != nil {
+						t.Fatalf("Send: %v", err)
+					}
+					if want := padded(want, blockSize); n != int64(len(want)) || !bytes.Equal(got.Bytes(), want) {
+						t.Errorf("received %d bytes % x, want % x", n, got.Bytes(), want)
+					}
+					if len(progress) > 0 && progress[len(progress)-1] != int64(size) {
+						t.Errorf("progress %v, want %d at the end", progress, size)
+					}
+
+					// The receiver asks for the variant, which the sender uses.
+					start := byte('C')
+					checkLen := 2
+					if checksum {
+						start, checkLen = nak, 1
+					}
+					if w := rp.written(); len(w) == 0 || w[0][0] != start {
+						t.Errorf("the receiver started with %q, want %q", w, start)
+					}
+					for _, w := range sp.written() {
+						if w[0] == soh && len(w) != 3+128+checkLen || w[0] == stx && len(w) != 3+1024+checkLen {
+							t.Errorf("block of %d bytes sent, with %d bytes of check", len(w), checkLen)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+// script runs the other side of a transfer: it reads what it expects, and writes its replies.
+type script struct {
+	t *testing.T
+	p serial.Port
+}
+
+// expect reads the bytes of want.
+func (s script) expect(want []byte) bool {
+	got := make([]byte, len(want))
+	s.p.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(s.p, got); err != nil || !bytes.Equal(got, want) {
+		s.t.Errorf("received % x, %v, want % x", got, err, want)
+		return false
+	}
+	return true
+}
+
+func (s script) send(b ...byte) {
+	if _, err := s.p.Write(b); err != nil {
+		s.t.Error(err)
+	}
+}
+
+func TestSendRetransmit(t *testing.T) {
+	for _, useCRC := range []bool{false, true} {
+		sp, rp := pipe(t)
+		want := data(200)
+		sent := make(chan error, 1)
+		go func() { sent <- xmodem.Send(sp, bytes.NewReader(want), xmodem.Config{Timeout: 5 * time.Second}) }()
+
+		s := script{t, rp}
+		if useCRC {
+			s.send('C')
+		} else {
+			s.send(nak)
+		}
+		first := block(1, want[:128], useCRC)
+		second := block(2, padded(want, 128)[128:], useCRC)
+		// Every block is sent again after a NAK, and the garbage before the replies is skipped.
+		if s.expect(first) {
+			s.send(nak)
+		}
+		if s.expect(first) {
+			s.send('x', ack)
+		}
+		if s.expect(second) {
+			s.send(nak)
+		}
+		if s.expect(second) {
+			s.send(ack)
+		}
+		if s.expect([]byte{eot}) {
+			s.send(ack)
+		}
+		if err := <-sent; err != nil {
+			t.Errorf("crc=%v: Send: %v", useCRC, err)
+		}
+	}
+}
+
+func TestReceiveRetransmit(t *testing.T) {
+	sp, rp := pipe(t)
+	want := data(256)
+	type result struct {
+		n   int64
+		err error
+	}
+	received := make(chan result, 1)
+	var got bytes.Buffer
+	go func() {
+		n, err := xmodem.Receive(rp, &got, xmodem.Config{Timeout: 2 * time.Second})
+		received <- result{n, err}
+	}()
+
+	s := script{t, sp}
+	s.expect([]byte{'C'})
+	damaged := block(1, want[:128], true)
+	damaged[10] ^= 1
+	s.send(damaged...)
+	// The receiver asks for the damaged block again, once the line is silent.
+	s.expect([]byte{nak})
+	s.send(block(1, want[:128], true)...)
+	s.expect([]byte{ack})
+	// A block sent again, as if its acknowledgment had been lost, is acknowledged and dropped.
+	s.send(block(1, want[:128], true)...)
+	s.expect([]byte{ack})
+	s.send(block(2, want[128:], true)...)
+	s.expect([]byte{ack})
+	s.send(eot)
+	s.expect([]byte{ack})
+
+	r := <-received
+	if r.err != nil || r.n != int64(len(want)) || !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("Receive = %d, %v, data % x, want % x", r.n, r.err, got.Bytes(), want)
+	}
+}
+
+func TestReceiveChecksumFallback(t *testing.T) {
+	// A sender which only knows the checksum ignores the requests for XMODEM-CRC, until the NAK.
+	sp, rp := pipe(t)
+	want := data(128)
+	received := make(chan error, 1)
+	var got bytes.Buffer
+	go func() {
+		_, err := xmodem.Receive(rp, &got, xmodem.Config{Timeout: 200 * time.Millisecond})
+		received <- err
+	}()
+	s := script{t, sp}
+	s.expect([]byte{'C', 'C', 'C', nak})
+	s.send(block(1, want, false)...)
+	s.expect([]byte{ack})
+	s.send(eot)
+	s.expect([]byte{ack})
+	if err := <-received; err != nil || !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("Receive: %v, data % x, want % x", err, got.Bytes(), want)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	t.Run("receiver cancels", func(t *testing.T) {
+		sp, rp := pipe(t)
+		sent := make(chan error, 1)
+		go func() { sent <- xmodem.Send(sp, bytes.NewReader(data(1000)), xmodem.Config{Timeout: 5 * time.Second}) }()
+		s := script{t, rp}
+		s.send('C')
+		s.expect(block(1, data(128), true))
+		s.send(can, can)
+		if err := <-sent; !errors.Is(err, xmodem.ErrCanceled) {
+			t.Errorf("Send: %v, want ErrCanceled", err)
+		}
+		// The transfer canceled by the remote side is not canceled back.
+		for _, w := range sp.written() {
+			if bytes.Equal(w, []byte{can, can, can}) {
+				t.Errorf("the sender canceled a transfer canceled by the receiver: % x", w)
+			}
+		}
+	})
+	t.Run("sender cancels", func(t *testing.T) {
+		sp, rp := pipe(t)
+		received := make(chan error, 1)
+		go func() {
+			_, err := xmodem.Receive(rp, io.Discard, xmodem.Config{Timeout: 5 * time.Second})
+			received <- err
+		}()
+		s := script{t, sp}
+		s.expect([]byte{'C'})
+		s.send(block(1, data(128), true)...)
+		s.expect([]byte{ack})
+		s.send(can, can)
+		if err := <-received; !errors.Is(err, xmodem.ErrCanceled) {
+			t.Errorf("Receive: %v, want ErrCanceled", err)
+		}
+	})
+	t.Run("a single CAN", func(t *testing.T) {
+		// A single CAN, like a noise, does not cancel the transfer.
+		sp, rp := pipe(t)
+		sent := make(chan error, 1)
+		go func() { sent <- xmodem.Send(sp, bytes.NewReader(data(10)), xmodem.Config{Timeout: 5 * time.Second}) }()
+		s := script{t, rp}
+		s.send(can, 'C')
+		if s.expect(block(1, padded(data(10), 128), true)) {
+			s.send(can, ack)
+		}
+		if s.expect([]byte{eot}) {
+			s.send(ack)
+		}
+		if err := <-sent; err != nil {
+			t.Errorf("Send: %v", err)
+		}
+	})
+	t.Run("failure cancels the remote side", func(t *testing.T) {
+		sp, rp := pipe(t)
+		failure := errors.New("read failure")
+		sent := make(chan error, 1)
+		go func() {
+			r := io.MultiReader(bytes.NewReader(data(1024)), errReader{failure})
+			sent <- xmodem.Send(sp, r, xmodem.Config{Timeout: 5 * time.Second})
+		}()
+		_, err := xmodem.Receive(rp, io.Discard, xmodem.Config{Timeout: 5 * time.Second})
+		if !errors.Is(err, xmodem.ErrCanceled) {
+			t.Errorf("Receive: %v, want ErrCanceled", err)
+		}
+		if err := <-sent; !errors.Is(err, failure) {
+			t.Errorf("Send: %v, want %v", err, failure)
+		}
+	})
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestYModem(t *testing.T) {
+	sp, rp := pipe(t)
+	modTime := time.Unix(1700000000, 0)
+	files := []xmodem.File{
+		{Name: "firmware.bin", Size: 3000, ModTime: modTime, Data: bytes.NewReader(data(3000))},
+		{Name: "config.txt", Size: 100, Data: bytes.NewReader(data(100))},
+		{Name: "empty", Size: 0, Data: bytes.NewReader(nil)},
+		{Name: "unknown size", Size: -1, Data: bytes.NewReader(data(200))},
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- xmodem.SendYModem(sp, files, xmodem.Config{Timeout: 5 * time.Second}) }()
+
+	type received struct {
+		name    string
+		size    int64
+		modTime time.Time
+		data    *bytes.Buffer
+	}
+	var got []received
+	err := xmodem.ReceiveYModem(rp, func(name string, size int64, modTime time.Time) (io.Writer, error) {
+		got = append(got, received{name, size, modTime, new(bytes.Buffer)})
+		return got[len(got)-1].data, nil
+	}, xmodem.Config{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("ReceiveYModem: %v", err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("SendYModem: %v", err)
+	}
+
+	want := []received{
+		{"firmware.bin", 3000, modTime, bytes.NewBuffer(data(3000))},
+		{"config.txt", 100, time.Time{}, bytes.NewBuffer(data(100))},
+		{"empty", 0, time.Time{}, new(bytes.Buffer)},
+		// Without the size, the padding of the last block is kept.
+		{"unknown size", -1, time.Time{}, bytes.NewBuffer(padded(data(200), 1024))},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d files received, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.name != w.name || g.size != w.size || !g.modTime.Equal(w.modTime) || !bytes.Equal(g.data.Bytes(), w.data.Bytes()) {
+			t.Errorf("file %d: %q of %d bytes modified at %v, %d bytes received; want %q of %d bytes modified at %v, %d bytes",
+				i, g.name, g.size, g.modTime, g.data.Len(), w.name, w.size, w.modTime, w.data.Len())
+		}
+	}
+
+	// Block 0 holds the name, the size in decimal and the modification time in octal, padded with zeros.
+	header := append([]byte("firmware.bin\x003000 "+strconv.FormatInt(modTime.Unix(), 8)), make([]byte, 128)...)[:128]
+	if w := sp.written(); len(w) == 0 || !bytes.Equal(w[0], block(0, header, true)) {
+		t.Errorf("block 0 sent: %q, want %q", w[0], block(0, header, true))
+	}
+	// The batch ends with an empty block 0.
+	if w := sp.written(); !bytes.Equal(w[len(w)-1], block(0, make([]byte, 128), true)) {
+		t.Errorf("last block sent: % x, want an empty block 0", w[len(w)-1])
+	}
+}
+
+func TestReceiveYModemHeader(t *testing.T) {
+	sp, rp := pipe(t)
+	type file struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	files := make(chan file, 2)
+	received := make(chan error, 1)
+	go func() {
+		received <- xmodem.ReceiveYModem(rp, func(name string, size int64, modTime time.Time) (io.Writer, error) {
+			files <- file{name, size, modTime}
+			return io.Discard, nil
+		}, xmodem.Config{Timeout: 5 * time.Second})
+	}()
+
+	s := script{t, sp}
+	s.expect([]byte{'C'})
+	// A 1024 byte block 0, with a name longer than a 128 byte block, and the size alone.
+	name := string(bytes.Repeat([]byte{'n'}, 200))
+	header := append([]byte(name+"\x0010"), make([]byte, 1024)...)[:1024]
+	s.send(block(0, header, true)...)
+	s.expect([]byte{ack, 'C'})
+	s.send(block(1, padded(data(10), 128), true)...)
+	s.expect([]byte{ack})
+	// The first EOT is rejected, to make sure it is not a damaged block.
+	s.send(eot)
+	s.expect([]byte{nak})
+	s.send(eot)
+	s.expect([]byte{ack, 'C'})
+	s.send(block(0, make([]byte, 128), true)...)
+	s.expect([]byte{ack})
+
+	if err := <-received; err != nil {
+		t.Fatalf("ReceiveYModem: %v", err)
+	}
+	if f := <-files; f.name != name || f.size != 10 || !f.modTime.IsZero() {
+		t.Errorf("file %q of %d bytes modified at %v, want %q of 10 bytes", f.name, f.size, f.modTime, name)
+	}
+}
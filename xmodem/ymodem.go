@@ -0,0 +1,183 @@
+package xmodem
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jangocheng/serial"
+)
+
+// File is a file sent with YMODEM.
+type File struct {
+	// Name is the name of the file, without the directory.
+	Name string
+
+	// Size is the size of the data, or -1 if it is not known.
+	// The receiver uses it to drop the padding of the last block.
+	Size int64
+
+	// ModTime, if not zero, is the modification time of the file.
+	ModTime time.Time
+
+	// Data is the content of the file, which is read until io.EOF.
+	Data io.Reader
+}
+
+// header returns block 0 of the file, which describes it.
+func (f *File) header() ([]byte, error) {
+	h := []byte(f.Name)
+	h = append(h, 0)
+	if f.Size >= 0 {
+		h = strconv.AppendInt(h, f.Size, 10)
+		if !f.ModTime.IsZero() {
+			h = append(h, ' ')
+			h = strconv.AppendInt(h, f.ModTime.Unix(), 8)
+		}
+	}
+	size := 128
+	if len(h) > 128 {
+		size = 1024
+	}
+	if len(h) > size {
+		return nil, fmt.Errorf("xmodem: file name too long: %q", f.Name)
+	}
+	return append(h, make([]byte, size-len(h))...), nil
+}
+
+// SendYModem sends the files with YMODEM, in a single batch.
+func SendYModem(p serial.Port, files []File, cfg Config) error {
+	c := newConn(p, cfg, 1024)
+	defer c.done()
+	for _, f := range files {
+		header, err := f.header()
+		if err != nil {
+			return c.abort(err)
+		}
+		if err := c.waitStart(); err != nil {
+			return c.abort(err)
+		}
+		if err := c.sendBlock(0, header); err != nil {
+			return c.abort(err)
+		}
+		if err := c.waitStart(); err != nil {
+			return c.abort(err)
+		}
+		if err := c.sendData(f.Data, f.Size); err != nil {
+			return c.abort(err)
+		}
+		if err := c.sendEOT(); err != nil {
+			return c.abort(err)
+		}
+	}
+	// An empty block 0 ends the batch.
+	if err := c.waitStart(); err != nil {
+		return c.abort(err)
+	}
+	return c.abort(c.sendBlock(0, make([]byte, 128)))
+}
+
+// ReceiveYModem receives a batch of files with YMODEM. For every file, it calls create
+// with the name, the size (or -1 if it is not known) and the modification time (or zero) of the file,
+// and writes the file to the returned writer. If the writer is an io.Closer, it is closed
+// once the file is received.
+func ReceiveYModem(p serial.Port, create func(name string, size int64, modTime time.Time) (io.Writer, error), cfg Config) error {
+	c := newConn(p, cfg, 1024)
+	defer c.done()
+	for {
+		header, err := c.receiveHeader()
+		if err != nil {
+			return c.abort(err)
+		}
+		name, size, modTime, err := parseHeader(header)
+		if err != nil {
+			return c.abort(err)
+		}
+		if name == "" {
+			return nil
+		}
+		w, err := create(name, size, modTime)
+		if err != nil {
+			return c.abort(err)
+		}
+		_, err = c.receiveData(w, size, true)
+		if cl, ok := w.(io.Closer); ok {
+			if cerr := cl.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			return c.abort(err)
+		}
+	}
+}
+
+// receiveHeader asks for block 0 of the next file, and returns its data.
+func (c *conn) receiveHeader() ([]byte, error) {
+	for i := 0; i < c.cfg.Retries; i++ {
+		if _, err := c.p.Write([]byte{crcRequest}); err != nil {
+			return nil, err
+		}
+		h, err := c.await(soh, stx, eot)
+		if isTimeout(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h == eot {
+			// The acknowledgment of the end of the previous file has been lost.
+			if _, err := c.p.Write([]byte{ack}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		blk, data, err := c.readBlock(h)
+		if err != nil && !isTimeout(err) && !errors.Is(err, errDamaged) {
+			return nil, err
+		}
+		if err != nil || blk != 0 {
+			c.purge()
+			continue
+		}
+		if _, err := c.p.Write([]byte{ack}); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: no file header received", ErrTooManyRetries)
+}
+
+// parseHeader parses block 0 of YMODEM. An empty name ends the batch.
+func parseHeader(header []byte) (name string, size int64, modTime time.Time, err error) {
+	size = -1
+	nameEnd := bytes.IndexByte(header, 0)
+	if nameEnd < 0 {
+		return "", 0, time.Time{}, errors.New("xmodem: malformed file header")
+	}
+	name = string(header[:nameEnd])
+	info := header[nameEnd+1:]
+	if end := bytes.IndexByte(info, 0); end >= 0 {
+		info = info[:end]
+	}
+	fields := strings.Fields(string(info))
+	if len(fields) > 0 {
+		if size, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+			return "", 0, time.Time{}, fmt.Errorf("xmodem: malformed file size: %w", err)
+		}
+	}
+	if len(fields) > 1 {
+		sec, err := strconv.ParseInt(fields[1], 8, 64)
+		if err != nil {
+			return "", 0, time.Time{}, fmt.Errorf("xmodem: malformed modification time: %w", err)
+		}
+		if sec != 0 {
+			modTime = time.Unix(sec, 0)
+		}
+	}
+	return name, size, modTime, nil
+}